@@ -0,0 +1,406 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package classification
+
+/* -------------------------------------------------------------------------- */
+
+import   "context"
+import   "math"
+import   "sort"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/options"
+import . "github.com/pbenner/ngstat/track"
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/autodiff/statistics"
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+// Assignment of named models to sequences and regions of a genome. Bins
+// within regions whose class (meta column `name') is contained in Classes
+// are classified with the model of the class, where later regions take
+// precedence if regions overlap. All remaining bins of a sequence are
+// classified with the model given in Seqnames, or with the Default model if
+// the sequence is not listed. Bins that are assigned the empty model name
+// are not classified and set to NaN. RegionsFile is the file from which
+// regions were imported, which is recorded in the run report.
+type ModelAssignment struct {
+  Default     string
+  Seqnames    map[string]string
+  Regions     GRanges
+  RegionsFile string
+  Classes     map[string]string
+}
+
+func NewModelAssignment(defaultModel string) ModelAssignment {
+  return ModelAssignment{
+    Default : defaultModel,
+    Seqnames: make(map[string]string),
+    Classes : make(map[string]string) }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Names of all models used by the assignment in alphabetical order.
+func (a ModelAssignment) Models() []string {
+  m := make(map[string]bool)
+  m[a.Default] = true
+  for _, model := range a.Seqnames {
+    m[model] = true
+  }
+  for _, model := range a.Classes {
+    m[model] = true
+  }
+  r := []string{}
+  for model := range m {
+    if model != "" {
+      r = append(r, model)
+    }
+  }
+  sort.Strings(r)
+  return r
+}
+
+// Model of all bins of a sequence that are not covered by any region.
+func (a ModelAssignment) SeqnameModel(seqname string) string {
+  if model, ok := a.Seqnames[seqname]; ok {
+    return model
+  }
+  return a.Default
+}
+
+// Check that all models used by the assignment are available.
+func (a ModelAssignment) Validate(isAvailable func(string) bool) error {
+  for _, model := range a.Models() {
+    if !isAvailable(model) {
+      return NewArgumentError("no classifier given for model `%s'", model)
+    }
+  }
+  if len(a.Classes) > 0 && a.Regions.Length() > 0 {
+    if _, ok := a.Regions.GetMeta("name").([]string); !ok {
+      return NewArgumentError("regions have no classes (meta column `name')")
+    }
+  }
+  return nil
+}
+
+func (a ModelAssignment) report(fname string) {
+  report := GetRunReport()
+  if report == nil {
+    return
+  }
+  // copy maps, since the assignment may be modified after the run
+  seqnames := make(map[string]string)
+  for name, model := range a.Seqnames {
+    seqnames[name] = model
+  }
+  classes := make(map[string]string)
+  for class, model := range a.Classes {
+    classes[class] = model
+  }
+  report.AddModelAssignment(RunReportModelAssignment{
+    Function   : fname,
+    Default    : a.Default,
+    Seqnames   : seqnames,
+    Classes    : classes,
+    Regions    : a.Regions.Length(),
+    RegionsFile: a.RegionsFile })
+}
+
+/* -------------------------------------------------------------------------- */
+
+// A range of bins [from, to) classified with the same model.
+type modelSegment struct {
+  from  int
+  to    int
+  model string
+}
+
+// Split the bins of a sequence into segments with the same model.
+func (a ModelAssignment) segments(seqname string, nbins, binSize int) []modelSegment {
+  r := []modelSegment{modelSegment{0, nbins, a.SeqnameModel(seqname)}}
+  classes, ok := a.Regions.GetMeta("name").([]string); if !ok || len(a.Classes) == 0 {
+    return r
+  }
+  for i := 0; i < a.Regions.Length(); i++ {
+    if a.Regions.Seqnames[i] != seqname {
+      continue
+    }
+    model, ok := a.Classes[classes[i]]; if !ok {
+      continue
+    }
+    from := MaxInt(a.Regions.Ranges[i].From/binSize, 0)
+    to   := MinInt((a.Regions.Ranges[i].To+binSize-1)/binSize, nbins)
+    if from >= to {
+      continue
+    }
+    // cut the new segment out of all existing segments
+    tmp := make([]modelSegment, 0, len(r)+2)
+    for _, s := range r {
+      if s.to <= from || s.from >= to {
+        tmp = append(tmp, s)
+        continue
+      }
+      if s.from < from {
+        tmp = append(tmp, modelSegment{s.from, from, s.model})
+      }
+      if s.to > to {
+        tmp = append(tmp, modelSegment{to, s.to, s.model})
+      }
+    }
+    tmp = append(tmp, modelSegment{from, to, model})
+    r = tmp
+  }
+  sort.Slice(r, func(i, j int) bool { return r[i].from < r[j].from })
+  return r
+}
+
+// Regions of all segments of a model.
+type modelRegions struct {
+  seqnames []string
+  from     []int
+  to       []int
+}
+
+func (r *modelRegions) add(seqname string, from, to int) {
+  r.seqnames = append(r.seqnames, seqname)
+  r.from     = append(r.from, from)
+  r.to       = append(r.to, to)
+}
+
+func (r *modelRegions) granges() GRanges {
+  return NewGRanges(r.seqnames, r.from, r.to, nil)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Classify each sequence with the models given by the assignment. The
+// classify function is called once for every model with all options, a
+// seqname filter that selects the sequences where the model is used and
+// regions that restrict classification to the bins assigned to the model.
+// Results are then copied to the bins assigned to the model.
+func classifyAssigned(ctx context.Context, config SessionConfig, fname string, assignment ModelAssignment, track Track, k int, options []Option, classify func(model string, options []Option) ([]MutableTrack, error)) ([]MutableTrack, error) {
+  // all options except regions are accepted here, they are checked by
+  // the classify function
+  opts, err := ParseOptions(fname, ^RegionsOption, options); if err != nil {
+    return nil, err
+  }
+  genome  := opts.FilterTrack(track).GetGenome()
+  binSize := track.GetBinSize()
+  result  := allocClassificationTracks(k, genome, binSize)
+
+  // segments and models of all sequences
+  segments := make(map[string][]modelSegment)
+  seqnames := make(map[string][]string)
+  // bins (in base pairs) assigned to each model
+  regions  := make(map[string]*modelRegions)
+  for i, name := range genome.Seqnames {
+    nbins := DivIntUp(genome.Lengths[i], binSize)
+    segments[name] = assignment.segments(name, nbins, binSize)
+    for _, s := range segments[name] {
+      if s.model == "" {
+        continue
+      }
+      if n := len(seqnames[s.model]); n == 0 || seqnames[s.model][n-1] != name {
+        seqnames[s.model] = append(seqnames[s.model], name)
+      }
+      if regions[s.model] == nil {
+        regions[s.model] = &modelRegions{}
+      }
+      regions[s.model].add(name, s.from*binSize, s.to*binSize)
+    }
+    // bins without model are missing values
+    dst, err := getClassificationSequences(result, name); if err != nil {
+      return nil, err
+    }
+    for _, seq := range dst {
+      for j := 0; j < seq.NBins(); j++ {
+        seq.SetBin(j, math.NaN())
+      }
+    }
+  }
+  for _, model := range assignment.Models() {
+    if len(seqnames[model]) == 0 {
+      continue
+    }
+    if err := ContextError(ctx); err != nil {
+      return nil, err
+    }
+    tmp, err := classify(model, append(options[0:len(options):len(options)], WithSeqnames(seqnames[model]...), WithRegions(regions[model].granges()))); if err != nil {
+      return nil, err
+    }
+    for _, name := range seqnames[model] {
+      src, err := getClassificationSequences(tmp, name); if err != nil {
+        return nil, err
+      }
+      dst, err := getClassificationSequences(result, name); if err != nil {
+        return nil, err
+      }
+      for _, s := range segments[name] {
+        if s.model != model {
+          continue
+        }
+        for j := range dst {
+          for i := s.from; i < s.to && i < dst[j].NBins(); i++ {
+            dst[j].SetBin(i, src[j].AtBin(i))
+          }
+        }
+      }
+    }
+  }
+  assignment.report(fname)
+  return result, nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Run BatchClassifySingleTrack with the classifiers given by a model
+// assignment, e.g. to use a separate background model for sex chromosomes or
+// to skip chrM. Classifiers are identified by the model names of the
+// assignment, which is recorded in the run report.
+func BatchClassifySingleTrackAssigned(config SessionConfig, classifiers map[string]VectorBatchClassifier, assignment ModelAssignment, track Track, options ...Option) (MutableTrack, error) {
+  return BatchClassifySingleTrackAssignedContext(context.Background(), config, classifiers, assignment, track, options...)
+}
+
+func BatchClassifySingleTrackAssignedContext(ctx context.Context, config SessionConfig, classifiers map[string]VectorBatchClassifier, assignment ModelAssignment, track Track, options ...Option) (MutableTrack, error) {
+  if err := assignment.Validate(func(model string) bool { _, ok := classifiers[model]; return ok }); err != nil {
+    return nil, err
+  }
+  result, err := classifyAssigned(ctx, config, "BatchClassifySingleTrackAssigned", assignment, track, 1, options, func(model string, options []Option) ([]MutableTrack, error) {
+    return batchClassifySingleTrack(ctx, config, "BatchClassifySingleTrackAssigned", VectorBatchClassifierList{classifiers[model]}, track, options)
+  }); if err != nil {
+    return nil, err
+  }
+  return result[0], nil
+}
+
+// Run BatchClassifySingleTrackMultiOutput with the classifiers given by a
+// model assignment. All classifiers must have the same number of outputs.
+func BatchClassifySingleTrackMultiOutputAssigned(config SessionConfig, classifiers map[string]VectorBatchMultiOutputClassifier, assignment ModelAssignment, track Track, options ...Option) ([]MutableTrack, error) {
+  return BatchClassifySingleTrackMultiOutputAssignedContext(context.Background(), config, classifiers, assignment, track, options...)
+}
+
+func BatchClassifySingleTrackMultiOutputAssignedContext(ctx context.Context, config SessionConfig, classifiers map[string]VectorBatchMultiOutputClassifier, assignment ModelAssignment, track Track, options ...Option) ([]MutableTrack, error) {
+  if err := assignment.Validate(func(model string) bool { _, ok := classifiers[model]; return ok }); err != nil {
+    return nil, err
+  }
+  k := -1
+  for _, model := range assignment.Models() {
+    if n := classifiers[model].NOutputs(); k == -1 {
+      k = n
+    } else
+    if k != n {
+      return nil, NewDimensionError(k, n, "classifier of model `%s' has invalid number of outputs", model)
+    }
+  }
+  if k == -1 {
+    return nil, NewArgumentError("model assignment does not use any model")
+  }
+  return classifyAssigned(ctx, config, "BatchClassifySingleTrackMultiOutputAssigned", assignment, track, k, options, func(model string, options []Option) ([]MutableTrack, error) {
+    return batchClassifySingleTrack(ctx, config, "BatchClassifySingleTrackMultiOutputAssigned", classifiers[model], track, options)
+  })
+}
+
+// Run ClassifySingleTrack with the classifiers given by a model assignment.
+func ClassifySingleTrackAssigned(config SessionConfig, classifiers map[string]VectorClassifier, assignment ModelAssignment, track Track, options ...Option) (MutableTrack, error) {
+  return ClassifySingleTrackAssignedContext(context.Background(), config, classifiers, assignment, track, options...)
+}
+
+func ClassifySingleTrackAssignedContext(ctx context.Context, config SessionConfig, classifiers map[string]VectorClassifier, assignment ModelAssignment, track Track, options ...Option) (MutableTrack, error) {
+  if err := assignment.Validate(func(model string) bool { _, ok := classifiers[model]; return ok }); err != nil {
+    return nil, err
+  }
+  result, err := classifyAssigned(ctx, config, "ClassifySingleTrackAssigned", assignment, track, 1, options, func(model string, options []Option) ([]MutableTrack, error) {
+    r, err := ClassifySingleTrackContext(ctx, config, classifiers[model], track, options...)
+    return []MutableTrack{r}, err
+  }); if err != nil {
+    return nil, err
+  }
+  return result[0], nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Run BatchClassifyMultiTrack with the classifiers given by a model
+// assignment.
+func BatchClassifyMultiTrackAssigned(config SessionConfig, classifiers map[string]MatrixBatchClassifier, assignment ModelAssignment, tracks []Track, transposed bool, options ...Option) (MutableTrack, error) {
+  return BatchClassifyMultiTrackAssignedContext(context.Background(), config, classifiers, assignment, tracks, transposed, options...)
+}
+
+func BatchClassifyMultiTrackAssignedContext(ctx context.Context, config SessionConfig, classifiers map[string]MatrixBatchClassifier, assignment ModelAssignment, tracks []Track, transposed bool, options ...Option) (MutableTrack, error) {
+  if len(tracks) == 0 {
+    return nil, nil
+  }
+  if err := assignment.Validate(func(model string) bool { _, ok := classifiers[model]; return ok }); err != nil {
+    return nil, err
+  }
+  result, err := classifyAssigned(ctx, config, "BatchClassifyMultiTrackAssigned", assignment, tracks[0], 1, options, func(model string, options []Option) ([]MutableTrack, error) {
+    return batchClassifyMultiTrack(ctx, config, "BatchClassifyMultiTrackAssigned", MatrixBatchClassifierList{classifiers[model]}, tracks, transposed, options)
+  }); if err != nil {
+    return nil, err
+  }
+  return result[0], nil
+}
+
+// Run ClassifyMultiTrack with the classifiers given by a model assignment.
+func ClassifyMultiTrackAssigned(config SessionConfig, classifiers map[string]MatrixClassifier, assignment ModelAssignment, tracks []Track, transposed bool, options ...Option) (MutableTrack, error) {
+  return ClassifyMultiTrackAssignedContext(context.Background(), config, classifiers, assignment, tracks, transposed, options...)
+}
+
+func ClassifyMultiTrackAssignedContext(ctx context.Context, config SessionConfig, classifiers map[string]MatrixClassifier, assignment ModelAssignment, tracks []Track, transposed bool, options ...Option) (MutableTrack, error) {
+  if len(tracks) == 0 {
+    return nil, nil
+  }
+  if err := assignment.Validate(func(model string) bool { _, ok := classifiers[model]; return ok }); err != nil {
+    return nil, err
+  }
+  result, err := classifyAssigned(ctx, config, "ClassifyMultiTrackAssigned", assignment, tracks[0], 1, options, func(model string, options []Option) ([]MutableTrack, error) {
+    r, err := ClassifyMultiTrackContext(ctx, config, classifiers[model], tracks, transposed, options...)
+    return []MutableTrack{r}, err
+  }); if err != nil {
+    return nil, err
+  }
+  return result[0], nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+func ImportAndBatchClassifySingleTrackAssigned(config SessionConfig, classifiers map[string]VectorBatchClassifier, assignment ModelAssignment, trackFile string, options ...Option) (MutableTrack, error) {
+  return ImportAndBatchClassifySingleTrackAssignedContext(context.Background(), config, classifiers, assignment, trackFile, options...)
+}
+
+func ImportAndBatchClassifySingleTrackAssignedContext(ctx context.Context, config SessionConfig, classifiers map[string]VectorBatchClassifier, assignment ModelAssignment, trackFile string, options ...Option) (MutableTrack, error) {
+  track, err := ImportTrack(config, trackFile); if err != nil {
+    return nil, err
+  }
+  return BatchClassifySingleTrackAssignedContext(ctx, config, classifiers, assignment, track, options...)
+}
+
+func ImportAndBatchClassifySingleTrackMultiOutputAssigned(config SessionConfig, classifiers map[string]VectorBatchMultiOutputClassifier, assignment ModelAssignment, trackFile string, options ...Option) ([]MutableTrack, error) {
+  return ImportAndBatchClassifySingleTrackMultiOutputAssignedContext(context.Background(), config, classifiers, assignment, trackFile, options...)
+}
+
+func ImportAndBatchClassifySingleTrackMultiOutputAssignedContext(ctx context.Context, config SessionConfig, classifiers map[string]VectorBatchMultiOutputClassifier, assignment ModelAssignment, trackFile string, options ...Option) ([]MutableTrack, error) {
+  track, err := ImportTrack(config, trackFile); if err != nil {
+    return nil, err
+  }
+  return BatchClassifySingleTrackMultiOutputAssignedContext(ctx, config, classifiers, assignment, track, options...)
+}
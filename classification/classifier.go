@@ -0,0 +1,285 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package classification
+
+/* -------------------------------------------------------------------------- */
+
+import   "fmt"
+
+import . "github.com/pbenner/ngstat/track"
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/autodiff"
+import . "github.com/pbenner/autodiff/statistics"
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+// Batch classifier that computes several values for each window, e.g. the
+// posterior probabilities of all mixture components or HMM states. Results
+// are stored in r, which has dimension NOutputs().
+type VectorBatchMultiOutputClassifier interface {
+  Eval(r Vector, x ConstVector) error
+  Dim() int
+  NOutputs() int
+  CloneVectorBatchMultiOutputClassifier() VectorBatchMultiOutputClassifier
+}
+
+type MatrixBatchMultiOutputClassifier interface {
+  Eval(r Vector, x ConstMatrix) error
+  Dims() (int, int)
+  NOutputs() int
+  CloneMatrixBatchMultiOutputClassifier() MatrixBatchMultiOutputClassifier
+}
+
+// Classifier of variable dimension that computes several values for each
+// position of a sequence, e.g. the posterior probabilities of all HMM
+// states. The j-th output is stored in r[j], which has the same dimension
+// as the data.
+type VectorMultiOutputClassifier interface {
+  Eval(r []Vector, x ConstVector) error
+  Dim() int
+  NOutputs() int
+  CloneVectorMultiOutputClassifier() VectorMultiOutputClassifier
+}
+
+type MatrixMultiOutputClassifier interface {
+  Eval(r []Vector, x ConstMatrix) error
+  Dims() (int, int)
+  NOutputs() int
+  CloneMatrixMultiOutputClassifier() MatrixMultiOutputClassifier
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Multi-output classifier where the j-th output is computed by the j-th
+// classifier of the list. All classifiers must have the same dimension.
+type VectorBatchClassifierList []VectorBatchClassifier
+
+func NewVectorBatchClassifierList(classifiers ...VectorBatchClassifier) (VectorBatchClassifierList, error) {
+  if len(classifiers) == 0 {
+    return nil, NewArgumentError("no classifiers given")
+  }
+  for j := 1; j < len(classifiers); j++ {
+    if n1, n2 := classifiers[0].Dim(), classifiers[j].Dim(); n1 != n2 {
+      return nil, NewDimensionError(n1, n2, "classifiers `1' and `%d' have different dimensions", j+1)
+    }
+  }
+  return VectorBatchClassifierList(classifiers), nil
+}
+
+func (obj VectorBatchClassifierList) Eval(r Vector, x ConstVector) error {
+  for j, classifier := range obj {
+    if err := classifier.Eval(r.At(j), x); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (obj VectorBatchClassifierList) Dim() int {
+  return obj[0].Dim()
+}
+
+func (obj VectorBatchClassifierList) NOutputs() int {
+  return len(obj)
+}
+
+func (obj VectorBatchClassifierList) CloneVectorBatchMultiOutputClassifier() VectorBatchMultiOutputClassifier {
+  r := make(VectorBatchClassifierList, len(obj))
+  for j, classifier := range obj {
+    r[j] = classifier.CloneVectorBatchClassifier()
+  }
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+type MatrixBatchClassifierList []MatrixBatchClassifier
+
+func NewMatrixBatchClassifierList(classifiers ...MatrixBatchClassifier) (MatrixBatchClassifierList, error) {
+  if len(classifiers) == 0 {
+    return nil, NewArgumentError("no classifiers given")
+  }
+  for j := 1; j < len(classifiers); j++ {
+    n1, m1 := classifiers[0].Dims()
+    n2, m2 := classifiers[j].Dims()
+    if n1 != n2 || m1 != m2 {
+      return nil, NewDimensionError(n1*m1, n2*m2, "classifiers `1' and `%d' have different dimensions", j+1)
+    }
+  }
+  return MatrixBatchClassifierList(classifiers), nil
+}
+
+func (obj MatrixBatchClassifierList) Eval(r Vector, x ConstMatrix) error {
+  for j, classifier := range obj {
+    if err := classifier.Eval(r.At(j), x); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (obj MatrixBatchClassifierList) Dims() (int, int) {
+  return obj[0].Dims()
+}
+
+func (obj MatrixBatchClassifierList) NOutputs() int {
+  return len(obj)
+}
+
+func (obj MatrixBatchClassifierList) CloneMatrixBatchMultiOutputClassifier() MatrixBatchMultiOutputClassifier {
+  r := make(MatrixBatchClassifierList, len(obj))
+  for j, classifier := range obj {
+    r[j] = classifier.CloneMatrixBatchClassifier()
+  }
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Multi-output classifier of variable dimension where the j-th output is
+// computed by the j-th classifier of the list.
+type VectorClassifierList []VectorClassifier
+
+func (obj VectorClassifierList) Eval(r []Vector, x ConstVector) error {
+  for j, classifier := range obj {
+    if err := classifier.Eval(r[j], x); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (obj VectorClassifierList) Dim() int {
+  return obj[0].Dim()
+}
+
+func (obj VectorClassifierList) NOutputs() int {
+  return len(obj)
+}
+
+func (obj VectorClassifierList) CloneVectorMultiOutputClassifier() VectorMultiOutputClassifier {
+  r := make(VectorClassifierList, len(obj))
+  for j, classifier := range obj {
+    r[j] = classifier.CloneVectorClassifier()
+  }
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+type MatrixClassifierList []MatrixClassifier
+
+func (obj MatrixClassifierList) Eval(r []Vector, x ConstMatrix) error {
+  for j, classifier := range obj {
+    if err := classifier.Eval(r[j], x); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (obj MatrixClassifierList) Dims() (int, int) {
+  return obj[0].Dims()
+}
+
+func (obj MatrixClassifierList) NOutputs() int {
+  return len(obj)
+}
+
+func (obj MatrixClassifierList) CloneMatrixMultiOutputClassifier() MatrixMultiOutputClassifier {
+  r := make(MatrixClassifierList, len(obj))
+  for j, classifier := range obj {
+    r[j] = classifier.CloneMatrixClassifier()
+  }
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Allocate one result track for each output of a classifier.
+func allocClassificationTracks(k int, genome Genome, binSize int) []MutableTrack {
+  r := make([]MutableTrack, k)
+  for j := 0; j < k; j++ {
+    if k == 1 {
+      r[j] = AllocSimpleTrack("classification", genome, binSize)
+    } else {
+      r[j] = AllocSimpleTrack(fmt.Sprintf("classification.%d", j+1), genome, binSize)
+    }
+  }
+  return r
+}
+
+func getClassificationSequences(tracks []MutableTrack, seqname string) ([]TrackSequence, error) {
+  r := make([]TrackSequence, len(tracks))
+  for j, track := range tracks {
+    if seq, err := track.GetSequence(seqname); err != nil {
+      return nil, err
+    } else {
+      r[j] = seq
+    }
+  }
+  return r, nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Regions (in base pairs) that contain all windows required for computing
+// the results of bins within the given regions. Windows are anchored at
+// bins that lie entirely within regions, extended by the range of anchors
+// from which results are aggregated.
+func classificationWindowRegions(regions GRanges, parameters WindowParameters, aggregation WindowAggregation, binSize int) GRanges {
+  // bins before and after an anchor covered by the window
+  o1, o2 := WindowOffsets(parameters.Size, parameters.Anchor)
+  // anchors before and after a bin from which results are aggregated
+  e1, e2 := o2, o1
+  if aggregation == WindowAggregateCenter {
+    d1, d2 := WindowOffsets(parameters.Step, WindowAnchorCenter)
+    e1, e2 = d2, d1
+  }
+  from := make([]int, regions.Length())
+  to   := make([]int, regions.Length())
+  for i := 0; i < regions.Length(); i++ {
+    r := regions.Ranges[i]
+    from[i] = MaxInt(DivIntUp(r.From, binSize)-e1-o1, 0)*binSize
+    to  [i] = MaxInt(r.To/binSize+e2+o2, 0)*binSize
+  }
+  return NewGRanges(regions.Seqnames, from, to, nil)
+}
+
+// Ranges of bins [from, to) for each sequence that overlap the given
+// regions.
+func classificationBinRegions(regions GRanges, binSize int) map[string][][2]int {
+  r := make(map[string][][2]int)
+  for i := 0; i < regions.Length(); i++ {
+    name := regions.Seqnames[i]
+    r[name] = append(r[name], [2]int{regions.Ranges[i].From/binSize, DivIntUp(regions.Ranges[i].To, binSize)})
+  }
+  return r
+}
+
+// Check if bins [from, to) overlap any of the ranges.
+func overlapsBinRegions(ranges [][2]int, from, to int) bool {
+  for _, r := range ranges {
+    if r[0] < to && r[1] > from {
+      return true
+    }
+  }
+  return false
+}
@@ -18,13 +18,15 @@ package classification
 
 /* -------------------------------------------------------------------------- */
 
-import   "fmt"
+import   "context"
 import   "math"
+import   "sync/atomic"
 
 import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/options"
 import . "github.com/pbenner/autodiff/statistics"
 import . "github.com/pbenner/ngstat/track"
-import . "github.com/pbenner/ngstat/trackDataTransform"
 import . "github.com/pbenner/ngstat/utility"
 
 import . "github.com/pbenner/autodiff"
@@ -33,22 +35,43 @@ import   "github.com/pbenner/threadpool"
 
 /* -------------------------------------------------------------------------- */
 
-func ClassifyMultiTrackData(config SessionConfig, classifier MatrixBatchClassifier, data []Matrix, transposed bool, args ...interface{}) ([]float64, error) {
-
-  var f MultiTrackBatchDataTransform
+// temporary memory of a single job
+type matrixBatchScratch struct {
+  c MatrixBatchMultiOutputClassifier
+  r Vector
+  y Matrix
+}
 
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case MultiTrackBatchDataTransform:
-      f = a
+func newMatrixBatchScratch(exec *ExecutionContext, classifier MatrixBatchMultiOutputClassifier, transform bool, m1, m2 int) *ScratchPool {
+  return exec.NewScratchPool(func() interface{} {
+    s := matrixBatchScratch{}
+    s.c = classifier.CloneMatrixBatchMultiOutputClassifier()
+    s.r = NullDenseVector(Float64Type, classifier.NOutputs())
+    if transform {
+      s.y = NullDenseMatrix(Float64Type, m1, m2)
     }
+    return s
+  })
+}
+
+/* -------------------------------------------------------------------------- */
+
+func ClassifyMultiTrackData(config SessionConfig, classifier MatrixBatchClassifier, data []Matrix, transposed bool, options ...Option) ([]float64, error) {
+  return ClassifyMultiTrackDataContext(context.Background(), config, classifier, data, transposed, options...)
+}
+
+func ClassifyMultiTrackDataContext(ctx context.Context, config SessionConfig, classifier MatrixBatchClassifier, data []Matrix, transposed bool, options ...Option) ([]float64, error) {
+
+  opts, err := ParseOptions("ClassifyMultiTrackData", MultiTrackBatchTransformOption | ThreadsOption | ExecutionContextOption, options); if err != nil {
+    return nil, err
   }
+  f := opts.MultiTrackBatchTransform
   n1, n2 := classifier.Dims()
   m1, m2 := n1, n2
 
   if f != nil {
     if t1, t2, t3, t4 := f.Dims(); t3 != m1 || t4 != m2 {
-      return nil, fmt.Errorf("data transform output dimensions do not match classifier dimension")
+      return nil, NewDimensionError(m1*m2, t3*t4, "data transform output dimensions do not match classifier dimension")
     } else {
       n1 = t1
       n2 = t2
@@ -57,40 +80,37 @@ func ClassifyMultiTrackData(config SessionConfig, classifier MatrixBatchClassifi
   // check data
   for d := 0; d < len(data); d++ {
     if n, _ := data[d].Dims(); n != n1 {
-      return nil, fmt.Errorf("data record `%d' has invalid number of rows", d)
+      return nil, NewDimensionError(n1, n, "data record `%d' has invalid number of rows", d)
     }
     if _, n := data[d].Dims(); n != n2 {
-      return nil, fmt.Errorf("data record `%d' has invalid number of columns", d)
+      return nil, NewDimensionError(n2, n, "data record `%d' has invalid number of columns", d)
     }
   }
 
-  // temporary memory for each thread
-  r := NullDenseVector(Float64Type, config.Threads)
-  // each thread gets its own classifier, since
-  // the given classifier may not be thread-safe
-  c := make([]MatrixBatchClassifier, config.Threads)
-  y := make([]Matrix,                    config.Threads)
-  for i := 0; i < config.Threads; i++ {
-    c[i] = classifier.CloneMatrixBatchClassifier()
-    if f != nil {
-      y[i] = NullDenseMatrix(Float64Type, m1, m2)
-    }
-  }
   result := make([]float64, len(data))
 
-  pool := threadpool.New(config.Threads, 10000)
-  g    := pool.NewJobGroup()
+  exec := opts.GetExecutionContext(config)
+  defer exec.Release()
+
+  pool    := exec.Pool
+  scratch := newMatrixBatchScratch(exec, MatrixBatchClassifierList{classifier}, f != nil, m1, m2)
+  g       := pool.NewJobGroup()
   // classify data
   for d := 0; d < len(data); d++ {
     // thread safe copy of d
     d := d
     if err := pool.AddJob(g, func(pool threadpool.ThreadPool, erf func() error) error {
-      c := c   [pool.GetThreadId()]
-      y := y   [pool.GetThreadId()]
-      r := r.At(pool.GetThreadId())
       if erf() != nil {
         return nil
       }
+      if err := ContextError(ctx); err != nil {
+        return err
+      }
+      s := scratch.Get().(matrixBatchScratch)
+      defer scratch.Put(s)
+      c := s.c
+      y := s.y
+      r := s.r
       x := data[d]
       if transposed {
         x.Tip()
@@ -105,7 +125,7 @@ func ClassifyMultiTrackData(config SessionConfig, classifier MatrixBatchClassifi
       if err := c.Eval(r, y); err != nil {
         return err
       }
-      result[d] = r.GetFloat64()
+      result[d] = r.Float64At(0)
       return nil
     }); err != nil {
       return nil, err
@@ -118,231 +138,360 @@ func ClassifyMultiTrackData(config SessionConfig, classifier MatrixBatchClassifi
   return result, nil
 }
 
-func BatchClassifyMultiTrack(config SessionConfig, classifier MatrixBatchClassifier, tracks []Track, transposed bool, args ...interface{}) (MutableTrack, error) {
+// Run classifier on a sliding window over multiple tracks. Options for
+// step size, padding and aggregation are the same as for
+// BatchClassifySingleTrack. Progress events are sent to the callback given
+// with WithProgress, otherwise they are logged.
+func BatchClassifyMultiTrack(config SessionConfig, classifier MatrixBatchClassifier, tracks []Track, transposed bool, options ...Option) (MutableTrack, error) {
+  return BatchClassifyMultiTrackContext(context.Background(), config, classifier, tracks, transposed, options...)
+}
+
+func BatchClassifyMultiTrackContext(ctx context.Context, config SessionConfig, classifier MatrixBatchClassifier, tracks []Track, transposed bool, options ...Option) (MutableTrack, error) {
+  result, err := batchClassifyMultiTrack(ctx, config, "BatchClassifyMultiTrack", MatrixBatchClassifierList{classifier}, tracks, transposed, options); if err != nil || result == nil {
+    return nil, err
+  }
+  return result[0], nil
+}
+
+// Run a classifier with multiple outputs on a sliding window over multiple
+// tracks. The result contains one track for each output of the classifier.
+// Options are the same as for BatchClassifyMultiTrack.
+func BatchClassifyMultiTrackMultiOutput(config SessionConfig, classifier MatrixBatchMultiOutputClassifier, tracks []Track, transposed bool, options ...Option) ([]MutableTrack, error) {
+  return BatchClassifyMultiTrackMultiOutputContext(context.Background(), config, classifier, tracks, transposed, options...)
+}
+
+func BatchClassifyMultiTrackMultiOutputContext(ctx context.Context, config SessionConfig, classifier MatrixBatchMultiOutputClassifier, tracks []Track, transposed bool, options ...Option) ([]MutableTrack, error) {
+  return batchClassifyMultiTrack(ctx, config, "BatchClassifyMultiTrackMultiOutput", classifier, tracks, transposed, options)
+}
+
+func batchClassifyMultiTrack(ctx context.Context, config SessionConfig, fname string, classifier MatrixBatchMultiOutputClassifier, tracks []Track, transposed bool, options []Option) ([]MutableTrack, error) {
 
   if len(tracks) == 0 {
     return nil, nil
   }
-  var f MultiTrackBatchDataTransform
-
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case MultiTrackBatchDataTransform:
-      f = a
-    }
+  opts, err := ParseOptions(fname, MultiTrackBatchTransformOption | StepOption | PaddingOption | AggregationOption | RegionsOption | TrackOptions | ProgressOption, options); if err != nil {
+    return nil, err
   }
+  f := opts.MultiTrackBatchTransform
+  tracks = opts.FilterTracks(tracks)
   n1, n2 := classifier.Dims()
   m1, m2 := n1, n2
 
   if f != nil {
     if t1, t2, t3, t4 := f.Dims(); t3 != m1 || t4 != m2 {
-      return nil, fmt.Errorf("data transform output dimensions do not match classifier dimension")
+      return nil, NewDimensionError(m1*m2, t3*t4, "data transform output dimensions do not match classifier dimension")
     } else {
       n1 = t1
       n2 = t2
     }
   }
   if len(tracks) != n1 {
-    return nil, fmt.Errorf("invalid number of tracks (expected `%d' tracks, but `%d' are given)", n1, len(tracks))
+    return nil, NewDimensionError(n1, len(tracks), "invalid number of tracks (expected `%d' tracks, but `%d' are given)", n1, len(tracks))
   }
 
   nan := math.NaN()
 
-  result := AllocSimpleTrack("classification", tracks[0].GetGenome(), tracks[0].GetBinSize())
-  pool   := threadpool.New(config.Threads, 10000)
+  // edges are padded unless requested otherwise
+  parameters := DefaultWindowParameters(n2)
+  parameters.Transposed = transposed
+  parameters.Padding    = opts.GetPadding(WindowPadReplicate)
+  if opts.Step > 0 {
+    parameters.Step = opts.Step
+  }
+  if opts.Regions.Length() > 0 {
+    parameters.Regions = classificationWindowRegions(opts.Regions, parameters, opts.Aggregation, tracks[0].GetBinSize())
+  }
 
-  // temporary memory for each thread
-  r := NullDenseVector(Float64Type, config.Threads)
-  // each thread gets its own classifier, since
-  // the given classifier may not be thread-safe
-  c := make([]MatrixBatchClassifier, config.Threads)
-  y := make([]Matrix,                    config.Threads)
-  for i := 0; i < config.Threads; i++ {
-    c[i] = classifier.CloneMatrixBatchClassifier()
-    if f != nil {
-      y[i] = NullDenseMatrix(Float64Type, m1, m2)
-    }
+  it, err := NewMultiTrackWindowIterator(Float64Type, tracks, parameters); if err != nil {
+    return nil, err
   }
+  result := allocClassificationTracks(classifier.NOutputs(), tracks[0].GetGenome(), tracks[0].GetBinSize())
+  exec   := opts.GetExecutionContext(config)
+  defer exec.Release()
 
-  offset1 := DivIntUp  (n2-1, 2)
-  offset2 := DivIntDown(n2-1, 2)
+  pool    := exec.Pool
+  scratch := newMatrixBatchScratch(exec, classifier, f != nil, m1, m2)
 
   // counter
   l := 0
   // total track length
   L := 0
   for _, length := range tracks[0].GetGenome().Lengths {
-    L += length/config.BinSize
-  }
-  if config.Verbose > 0 {
-    NewProgress(L, L).PrintStderr(l)
+    L += length/tracks[0].GetBinSize()
   }
-  // memory for collecting track sequences before
-  // converting them to vectors
-  sequences := make([]TrackSequence, len(tracks))
+  progress := NewNamedProgress("Classifying", L, L)
+  callback := GetProgressCallback(config, opts.Progress)
+  progress.Report(callback, l, "")
 
-  for _, name := range tracks[0].GetSeqNames() {
-    dst, err := result.GetSequence(name); if err != nil {
+  for it.NextSequence() {
+    if err := ContextError(ctx); err != nil {
       return nil, err
     }
-    nbins := dst.NBins()
+    windows := it.Sequence()
+    name    := windows.Seqname
+    nbins   := windows.NBins()
 
-    // skip any sequence shorter than the classifier dimension
-    if nbins < n2 {
-      for i := 0; i < nbins; i++ {
-        dst.SetBin(i, nan)
+    dst, err := getClassificationSequences(result, name); if err != nil {
+      return nil, err
+    }
+    // clear sequences without windows, i.e. sequences shorter
+    // than the classifier dimension if edges are not padded
+    if windows.Len() == 0 {
+      for _, s := range dst {
+        for i := 0; i < nbins; i++ {
+          s.SetBin(i, nan)
+        }
       }
       l += nbins
 
-      if config.Verbose > 0 {
-        NewProgress(L, L).PrintStderr(l)
-      }
+      progress.Report(callback, l, name)
       continue
     }
-
-    for k := 0; k < len(tracks); k++ {
-      seq, err := tracks[k].GetSequence(name); if err != nil {
-        return nil, err
-      }
-      if nbins != seq.NBins() {
-        return nil, fmt.Errorf("lengths of sequence `%s' varies between tracks", name)
-      }
-      sequences[k] = seq
+    // reserve memory for the sequence matrix
+    bytes := windows.Bytes() + 16*int64(nbins)*int64(len(result))
+    if err := exec.Memory.Acquire(ctx, bytes); err != nil {
+      return nil, err
     }
     g := pool.NewJobGroup()
-    x := SequencesToMatrix(Float64Type, sequences, transposed)
-
-    // clear non-accessible regions
-    for i := 0; i < offset1; i++ {
-      dst.SetBin(i, nan)
+    // results of all windows for each output
+    results := make([][]float64, len(result))
+    for j := range results {
+      results[j] = make([]float64, windows.Len())
     }
-    for i := nbins-offset2; i < nbins; i++ {
-      dst.SetBin(i, nan)
-    }
-    nrows, ncols := x.Dims()
+
+    // convert sequences to matrix
+    windows.Load()
+
     // launch jobs
-    if err := pool.AddRangeJob(offset1, nbins-offset2, g, func(i int, pool threadpool.ThreadPool, erf func() error) error {
+    if err := pool.AddRangeJob(0, windows.Len(), g, func(k int, pool threadpool.ThreadPool, erf func() error) error {
       if erf() != nil {
         return nil
       }
-      c := c   [pool.GetThreadId()]
-      y := y   [pool.GetThreadId()]
-      r := r.At(pool.GetThreadId())
-      if transposed {
-        x := x.Slice(i-offset1, i+offset2+1, 0, ncols)
-        if f != nil {
-          if err := f.Eval(y, x); err != nil {
-            return err
-          }
-        } else {
-          y = x
-        }
-        if err := c.Eval(r, y); err != nil {
+      if err := ContextError(ctx); err != nil {
+        return err
+      }
+      s := scratch.Get().(matrixBatchScratch)
+      defer scratch.Put(s)
+      c := s.c
+      y := s.y
+      r := s.r
+      w := windows.Window(k)
+      if f != nil {
+        if err := f.Eval(y, w.Matrix); err != nil {
           return err
         }
       } else {
-        x := x.Slice(0, nrows, i-offset1, i+offset2+1)
-        if f != nil {
-          if err := f.Eval(y, x); err != nil {
-            return err
-          }
-        } else {
-          y = x
-        }
-        if err := c.Eval(r, y); err != nil {
-          return err
-        }
+        y = w.Matrix
+      }
+      if err := c.Eval(r, y); err != nil {
+        return err
+      }
+      for j := range results {
+        results[j][k] = r.Float64At(j)
       }
-      dst.SetBin(i, r.GetFloat64())
       return nil
     }); err != nil {
+      exec.Memory.Release(bytes)
       return nil, err
     }
     // wait for threads
     if err := pool.Wait(g); err != nil {
+      exec.Memory.Release(bytes)
       return nil, err
     }
+    // assign results to bins
+    for j := range results {
+      windows.Aggregate(dst[j], results[j], opts.Aggregation)
+    }
+    exec.Memory.Release(bytes)
     l += nbins
 
-    if config.Verbose > 0 {
-      NewProgress(L, L).PrintStderr(l)
-    }
+    progress.Report(callback, l, name)
+  }
+  if err := it.Err(); err != nil {
+    return nil, err
   }
   return result, nil
 }
 
-func ClassifyMultiTrack(config SessionConfig, classifier MatrixClassifier, tracks []Track, transposed bool, args ...interface{}) (MutableTrack, error) {
+// Classify all sequences of a set of tracks with a classifier of variable
+// column dimension, such as a hidden Markov model. Sequences are split into
+// overlapping chunks that are classified in parallel if the WithChunks
+// option is given.
+func ClassifyMultiTrack(config SessionConfig, classifier MatrixClassifier, tracks []Track, transposed bool, options ...Option) (MutableTrack, error) {
+  return ClassifyMultiTrackContext(context.Background(), config, classifier, tracks, transposed, options...)
+}
+
+func ClassifyMultiTrackContext(ctx context.Context, config SessionConfig, classifier MatrixClassifier, tracks []Track, transposed bool, options ...Option) (MutableTrack, error) {
+  result, err := classifyMultiTrack(ctx, config, "ClassifyMultiTrack", MatrixClassifierList{classifier}, tracks, transposed, options); if err != nil || result == nil {
+    return nil, err
+  }
+  return result[0], nil
+}
+
+// Classify all sequences of a set of tracks with a classifier of variable
+// column dimension that has multiple outputs, such as the posterior
+// probabilities of all HMM states (see NewMatrixHmmPosteriors). The result
+// contains one track for each output of the classifier. Options are the
+// same as for ClassifyMultiTrack.
+func ClassifyMultiTrackMultiOutput(config SessionConfig, classifier MatrixMultiOutputClassifier, tracks []Track, transposed bool, options ...Option) ([]MutableTrack, error) {
+  return ClassifyMultiTrackMultiOutputContext(context.Background(), config, classifier, tracks, transposed, options...)
+}
+
+func ClassifyMultiTrackMultiOutputContext(ctx context.Context, config SessionConfig, classifier MatrixMultiOutputClassifier, tracks []Track, transposed bool, options ...Option) ([]MutableTrack, error) {
+  return classifyMultiTrack(ctx, config, "ClassifyMultiTrackMultiOutput", classifier, tracks, transposed, options)
+}
+
+func classifyMultiTrack(ctx context.Context, config SessionConfig, fname string, classifier MatrixMultiOutputClassifier, tracks []Track, transposed bool, options []Option) ([]MutableTrack, error) {
 
   if _, n := classifier.Dims(); n != -1 {
-    return nil, fmt.Errorf("classifier must have variable column dimension")
+    return nil, NewDimensionError(-1, n, "classifier must have variable column dimension")
   }
   if len(tracks) == 0 {
     return nil, nil
   }
-  var f MultiTrackDataTransform
-
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case MultiTrackDataTransform:
-      f = a
-    }
+  opts, err := ParseOptions(fname, MultiTrackTransformOption | ChunkOption | RegionsOption | TrackOptions, options); if err != nil {
+    return nil, err
   }
+  f := opts.MultiTrackTransform
+  tracks = opts.FilterTracks(tracks)
 
-  result := AllocSimpleTrack("classification", tracks[0].GetGenome(), tracks[0].GetBinSize())
-  pool   := threadpool.New(config.Threads, 10000)
+  k      := classifier.NOutputs()
+  result := allocClassificationTracks(k, tracks[0].GetGenome(), tracks[0].GetBinSize())
+  exec   := opts.GetExecutionContext(config)
+  defer exec.Release()
 
-  // each thread gets its own classifier, since
+  pool := exec.Pool
+  // each job gets its own classifier, since
   // the given classifier may not be thread-safe
-  c := make([]MatrixClassifier, config.Threads)
-  for i := 0; i < config.Threads; i++ {
-    c[i] = classifier.CloneMatrixClassifier()
-  }
+  scratch := exec.NewScratchPool(func() interface{} {
+    return classifier.CloneMatrixMultiOutputClassifier()
+  })
 
   // memory for collecting track sequences before
   // converting them to vectors
   sequences := make([]TrackSequence, len(tracks))
 
+  // ranges of bins that are classified
+  var regions map[string][][2]int
+  if opts.Regions.Length() > 0 {
+    regions = classificationBinRegions(opts.Regions, tracks[0].GetBinSize())
+  }
   g := pool.NewJobGroup()
+  // first error that stops the submission of jobs
+  var errSubmit error
 
+LOOP:
   for _, name := range tracks[0].GetSeqNames() {
-    dst, err := result.GetSequence(name); if err != nil {
-      return nil, err
+    // stop submitting jobs if the context is canceled, queued jobs
+    // return immediately
+    if ctx.Err() != nil {
+      break
+    }
+    dst, err := getClassificationSequences(result, name); if err != nil {
+      errSubmit = err
+      break
     }
-    nbins := dst.NBins()
+    nbins := dst[0].NBins()
 
     for k := 0; k < len(tracks); k++ {
       seq, err := tracks[k].GetSequence(name); if err != nil {
-        return nil, err
+        errSubmit = SequenceError{Seqname: name, Err: err}
+        break LOOP
       }
       if nbins != seq.NBins() {
-        return nil, fmt.Errorf("lengths of sequence `%s' varies between tracks", name)
+        errSubmit = NewDimensionError(nbins, seq.NBins(), "lengths of sequence `%s' varies between tracks", name)
+        break LOOP
       }
       sequences[k] = seq
     }
-    r := NullDenseVector(Float64Type, nbins)
+    // each chunk is classified by a separate job
+    chunks := SplitSequence(nbins, opts.ChunkSize, opts.ChunkOverlap)
+    // skip chunks outside of regions, bins of skipped chunks are
+    // missing values
+    if regions != nil {
+      tmp := []SequenceChunk{}
+      for _, chunk := range chunks {
+        if overlapsBinRegions(regions[name], chunk.CoreFrom, chunk.CoreTo) {
+          tmp = append(tmp, chunk)
+          continue
+        }
+        for j := range dst {
+          for i := chunk.CoreFrom; i < chunk.CoreTo; i++ {
+            dst[j].SetBin(i, math.NaN())
+          }
+        }
+      }
+      if chunks = tmp; len(chunks) == 0 {
+        continue
+      }
+    }
+
+    // reserve memory for the input matrix and the output vectors of
+    // all chunks, which is released once the last chunk is done
+    bytes := 8*int64(nbins)*int64(len(tracks))
+    for _, chunk := range chunks {
+      bytes += 8*int64(chunk.Len())*int64(k)
+    }
+    if err := exec.Memory.Acquire(ctx, bytes); err != nil {
+      break
+    }
+    // the transform is always applied to the whole sequence
     x := SequencesToMatrix(Float64Type, sequences, transposed)
     if f != nil {
       x = f.Eval(x)
     }
-
-    if err := pool.AddJob(g, func(pool threadpool.ThreadPool, erf func() error) error {
-      c := c[pool.GetThreadId()]
-      if erf() != nil {
+    pending := int32(len(chunks))
+
+    for i, chunk := range chunks {
+      chunk := chunk
+      if err := pool.AddJob(g, func(pool threadpool.ThreadPool, erf func() error) error {
+        defer func() {
+          if atomic.AddInt32(&pending, -1) == 0 {
+            exec.Memory.Release(bytes)
+          }
+        }()
+        if erf() != nil {
+          return nil
+        }
+        if err := ContextError(ctx); err != nil {
+          return err
+        }
+        c := scratch.Get().(MatrixMultiOutputClassifier)
+        defer scratch.Put(c)
+        r := make([]Vector, k)
+        for j := range r {
+          r[j] = NullDenseVector(Float64Type, chunk.Len())
+        }
+        if err := c.Eval(r, SliceSequencesMatrix(x, chunk.From, chunk.To, transposed)); err != nil {
+          return err
+        }
+        // keep only results within the core of the chunk
+        for j := range r {
+          for i := chunk.CoreFrom; i < chunk.CoreTo; i++ {
+            dst[j].SetBin(i, r[j].Float64At(i-chunk.From))
+          }
+        }
         return nil
+      }); err != nil {
+        // release memory of all chunks that were not submitted
+        if atomic.AddInt32(&pending, -int32(len(chunks)-i)) == 0 {
+          exec.Memory.Release(bytes)
+        }
+        errSubmit = err
+        break LOOP
       }
-      if err := c.Eval(r, x); err != nil {
-        return err
-      }
-      for i := 0; i < nbins; i++ {
-        dst.SetBin(i, r.At(i).GetFloat64())
-      }
-      return nil
-    }); err != nil {
-      return nil, err
     }
   }
-  // wait for threads
-  if err := pool.Wait(g); err != nil {
+  // always wait for submitted jobs, since they write into the result
+  // and hold memory of the execution context
+  if err := pool.Wait(g); err != nil && errSubmit == nil {
+    errSubmit = err
+  }
+  if errSubmit != nil {
+    return nil, errSubmit
+  }
+  if err := ContextError(ctx); err != nil {
     return nil, err
   }
   return result, nil
@@ -350,24 +499,34 @@ func ClassifyMultiTrack(config SessionConfig, classifier MatrixClassifier, track
 
 /* -------------------------------------------------------------------------- */
 
-func ImportAndBatchClassifyMultiTrack(config SessionConfig, classifier MatrixBatchClassifier, trackFiles []string, transposed bool, args ...interface{}) (MutableTrack, error) {
+func ImportAndBatchClassifyMultiTrack(config SessionConfig, classifier MatrixBatchClassifier, trackFiles []string, transposed bool, options ...Option) (MutableTrack, error) {
+  return ImportAndBatchClassifyMultiTrackContext(context.Background(), config, classifier, trackFiles, transposed, options...)
+}
+
+func ImportAndBatchClassifyMultiTrackContext(ctx context.Context, config SessionConfig, classifier MatrixBatchClassifier, trackFiles []string, transposed bool, options ...Option) (MutableTrack, error) {
   tracks := make([]Track, len(trackFiles))
   for i := 0; i < len(trackFiles); i++ {
     track, err := ImportLazyTrack(config, trackFiles[i]); if err != nil {
       return nil, err
     }
+    defer track.Close()
     tracks[i] = track
   }
-  return BatchClassifyMultiTrack(config, classifier, tracks, transposed, args...)
+  return BatchClassifyMultiTrackContext(ctx, config, classifier, tracks, transposed, options...)
+}
+
+func ImportAndClassifyMultiTrack(config SessionConfig, classifier MatrixClassifier, trackFiles []string, transposed bool, options ...Option) (MutableTrack, error) {
+  return ImportAndClassifyMultiTrackContext(context.Background(), config, classifier, trackFiles, transposed, options...)
 }
 
-func ImportAndClassifyMultiTrack(config SessionConfig, classifier MatrixClassifier, trackFiles []string, transposed bool, args ...interface{}) (MutableTrack, error) {
+func ImportAndClassifyMultiTrackContext(ctx context.Context, config SessionConfig, classifier MatrixClassifier, trackFiles []string, transposed bool, options ...Option) (MutableTrack, error) {
   tracks := make([]Track, len(trackFiles))
   for i := 0; i < len(trackFiles); i++ {
     track, err := ImportLazyTrack(config, trackFiles[i]); if err != nil {
       return nil, err
     }
+    defer track.Close()
     tracks[i] = track
   }
-  return ClassifyMultiTrack(config, classifier, tracks, transposed, args...)
+  return ClassifyMultiTrackContext(ctx, config, classifier, tracks, transposed, options...)
 }
@@ -18,14 +18,16 @@ package classification
 
 /* -------------------------------------------------------------------------- */
 
-import   "fmt"
+import   "context"
 import   "math"
 import   "os"
+import   "sync/atomic"
 
 import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/options"
 import . "github.com/pbenner/autodiff/statistics"
 import . "github.com/pbenner/ngstat/track"
-import . "github.com/pbenner/ngstat/trackDataTransform"
 import . "github.com/pbenner/ngstat/utility"
 
 import . "github.com/pbenner/autodiff"
@@ -34,52 +36,65 @@ import   "github.com/pbenner/threadpool"
 
 /* -------------------------------------------------------------------------- */
 
-func ClassifySingleTrackData(config SessionConfig, classifier VectorBatchClassifier, x []Vector, args ...interface{}) ([]float64, error) {
+// temporary memory of a single job, each job gets its own
+// classifier, since the given classifier may not be thread-safe
+type vectorBatchScratch struct {
+  c VectorBatchMultiOutputClassifier
+  r Vector
+  y Vector
+}
+
+func newVectorBatchScratch(exec *ExecutionContext, classifier VectorBatchMultiOutputClassifier, transform bool, m int) *ScratchPool {
+  return exec.NewScratchPool(func() interface{} {
+    s := vectorBatchScratch{}
+    s.c = classifier.CloneVectorBatchMultiOutputClassifier()
+    s.r = NullDenseVector(Float64Type, classifier.NOutputs())
+    if transform {
+      s.y = NullDenseVector(Float64Type, m)
+    }
+    return s
+  })
+}
+
+/* -------------------------------------------------------------------------- */
+
+func ClassifySingleTrackData(config SessionConfig, classifier VectorBatchClassifier, x []Vector, options ...Option) ([]float64, error) {
+  return ClassifySingleTrackDataContext(context.Background(), config, classifier, x, options...)
+}
+
+func ClassifySingleTrackDataContext(ctx context.Context, config SessionConfig, classifier VectorBatchClassifier, x []Vector, options ...Option) ([]float64, error) {
   if len(x) == 0 {
     return nil, nil
   }
   n := classifier.Dim()
   m := n
 
-  var f SingleTrackBatchDataTransform
-
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case SingleTrackBatchDataTransform:
-      f = a
-    }
+  opts, err := ParseOptions("ClassifySingleTrackData", SingleTrackBatchTransformOption | ThreadsOption | ExecutionContextOption, options); if err != nil {
+    return nil, err
   }
+  f := opts.SingleTrackBatchTransform
 
   // check dimensions
   if f != nil {
     if n1, n2 := f.Dims(); n1 != n {
-      return nil, fmt.Errorf("data transform input dimension does not match data dimension")
+      return nil, NewDimensionError(n, n1, "data transform input dimension does not match data dimension")
     } else
     if n2 != classifier.Dim() {
-      return nil, fmt.Errorf("data transform output dimension does not match classifier dimension")
+      return nil, NewDimensionError(classifier.Dim(), n2, "data transform output dimension does not match classifier dimension")
     } else {
       m = n2
     }
   } else {
     if n != classifier.Dim() {
-      return nil, fmt.Errorf("estimator dimension does not match data dimension")
+      return nil, NewDimensionError(n, classifier.Dim(), "estimator dimension does not match data dimension")
     }
   }
 
-  pool := threadpool.New(config.Threads, 10000)
+  exec := opts.GetExecutionContext(config)
+  defer exec.Release()
 
-  // temporary memory for each thread
-  r := NullDenseVector(Float64Type, config.Threads)
-  // each thread gets its own classifier, since
-  // the given classifier may not be thread-safe
-  c := make([]VectorBatchClassifier, config.Threads)
-  y := make([]Vector, config.Threads)
-  for i := 0; i < config.Threads; i++ {
-    c[i] = classifier.CloneVectorBatchClassifier()
-    if f != nil {
-      y[i] = NullDenseVector(Float64Type, m)
-    }
-  }
+  pool    := exec.Pool
+  scratch := newVectorBatchScratch(exec, VectorBatchClassifierList{classifier}, f != nil, m)
 
   g := pool.NewJobGroup()
 
@@ -89,12 +104,17 @@ func ClassifySingleTrackData(config SessionConfig, classifier VectorBatchClassif
     if erf() != nil {
       return nil
     }
-    r := r.At(pool.GetThreadId())
-    c := c   [pool.GetThreadId()]
-    y := y   [pool.GetThreadId()]
-    x := x   [i]
+    if err := ContextError(ctx); err != nil {
+      return err
+    }
+    s := scratch.Get().(vectorBatchScratch)
+    defer scratch.Put(s)
+    r := s.r
+    c := s.c
+    y := s.y
+    x := x[i]
     if n != -1 && x.Dim() != n {
-      return fmt.Errorf("dimension of observation `%d' (%d) does not match classifier dimension (%d)", i, x.Dim(), n)
+      return NewDimensionError(n, x.Dim(), "dimension of observation `%d' (%d) does not match classifier dimension (%d)", i, x.Dim(), n)
     }
     if f != nil {
       if err := f.Eval(y, x); err != nil {
@@ -106,7 +126,7 @@ func ClassifySingleTrackData(config SessionConfig, classifier VectorBatchClassif
     if err := c.Eval(r, y); err != nil {
       return err
     }
-    result[i] = r.GetFloat64()
+    result[i] = r.Float64At(0)
     return nil
   }); err != nil {
     return nil, err
@@ -118,22 +138,47 @@ func ClassifySingleTrackData(config SessionConfig, classifier VectorBatchClassif
   return result, nil
 }
 
-// Run classifier sequentially on a single track
-func BatchClassifySingleTrack(config SessionConfig, classifier VectorBatchClassifier, track Track, args ...interface{}) (MutableTrack, error) {
+// Run classifier on a sliding window over a single track. By default the
+// classifier is evaluated at every bin and the result is assigned to the
+// window center, where windows at the ends of a sequence are padded. The
+// classifier may be evaluated at every k-th bin only using WithStep, and
+// WithAggregation determines how results are assigned to bins. Progress
+// events are sent to the callback given with WithProgress, otherwise they
+// are logged.
+func BatchClassifySingleTrack(config SessionConfig, classifier VectorBatchClassifier, track Track, options ...Option) (MutableTrack, error) {
+  return BatchClassifySingleTrackContext(context.Background(), config, classifier, track, options...)
+}
+
+func BatchClassifySingleTrackContext(ctx context.Context, config SessionConfig, classifier VectorBatchClassifier, track Track, options ...Option) (MutableTrack, error) {
+  result, err := batchClassifySingleTrack(ctx, config, "BatchClassifySingleTrack", VectorBatchClassifierList{classifier}, track, options); if err != nil {
+    return nil, err
+  }
+  return result[0], nil
+}
+
+// Run a classifier with multiple outputs on a sliding window over a single
+// track. The result contains one track for each output of the classifier.
+// Options are the same as for BatchClassifySingleTrack.
+func BatchClassifySingleTrackMultiOutput(config SessionConfig, classifier VectorBatchMultiOutputClassifier, track Track, options ...Option) ([]MutableTrack, error) {
+  return BatchClassifySingleTrackMultiOutputContext(context.Background(), config, classifier, track, options...)
+}
 
-  var f SingleTrackBatchDataTransform
+func BatchClassifySingleTrackMultiOutputContext(ctx context.Context, config SessionConfig, classifier VectorBatchMultiOutputClassifier, track Track, options ...Option) ([]MutableTrack, error) {
+  return batchClassifySingleTrack(ctx, config, "BatchClassifySingleTrackMultiOutput", classifier, track, options)
+}
 
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case SingleTrackBatchDataTransform:
-      f = a
-    }
+func batchClassifySingleTrack(ctx context.Context, config SessionConfig, fname string, classifier VectorBatchMultiOutputClassifier, track Track, options []Option) ([]MutableTrack, error) {
+
+  opts, err := ParseOptions(fname, SingleTrackBatchTransformOption | StepOption | PaddingOption | AggregationOption | RegionsOption | TrackOptions | ProgressOption, options); if err != nil {
+    return nil, err
   }
+  f := opts.SingleTrackBatchTransform
+  track = opts.FilterTrack(track)
   if n := classifier.Dim(); n == -1 {
-    return nil, fmt.Errorf("classifier must have fixed dimension")
+    return nil, NewDimensionError(0, n, "classifier must have fixed dimension")
   }
   if n := classifier.Dim(); n < -1 || n == 0 {
-    return nil, fmt.Errorf("classifier has invalid dimension")
+    return nil, NewDimensionError(0, n, "classifier has invalid dimension")
   }
 
   n := classifier.Dim()
@@ -142,7 +187,7 @@ func BatchClassifySingleTrack(config SessionConfig, classifier VectorBatchClassi
   if f != nil {
     n1, n2 := f.Dims()
     if n2 != classifier.Dim() {
-      return nil, fmt.Errorf("data transform output dimension does not match estimator dimension")
+      return nil, NewDimensionError(classifier.Dim(), n2, "data transform output dimension does not match estimator dimension")
     } else {
       n = n1
       m = n2
@@ -151,117 +196,139 @@ func BatchClassifySingleTrack(config SessionConfig, classifier VectorBatchClassi
 
   nan := math.NaN()
 
-  result := AllocSimpleTrack("classification", track.GetGenome(), track.GetBinSize())
-  pool   := threadpool.New(config.Threads, 10000)
-
-  // temporary memory for each thread
-  r := NullDenseVector(Float64Type, config.Threads)
-  // each thread gets its own classifier, since
-  // the given classifier may not be thread-safe
-  c := make([]VectorBatchClassifier, config.Threads)
-  y := make([]Vector, config.Threads)
-  for i := 0; i < config.Threads; i++ {
-    c[i] = classifier.CloneVectorBatchClassifier()
-    if f != nil {
-      y[i] = NullDenseVector(Float64Type, m)
-    }
+  // edges are padded unless requested otherwise
+  parameters := DefaultWindowParameters(n)
+  parameters.Padding = opts.GetPadding(WindowPadReplicate)
+  if opts.Step > 0 {
+    parameters.Step = opts.Step
+  }
+  if opts.Regions.Length() > 0 {
+    parameters.Regions = classificationWindowRegions(opts.Regions, parameters, opts.Aggregation, track.GetBinSize())
+  }
+  it, err := NewSingleTrackWindowIterator(Float64Type, track, parameters); if err != nil {
+    return nil, err
   }
+  result := allocClassificationTracks(classifier.NOutputs(), track.GetGenome(), track.GetBinSize())
+  exec   := opts.GetExecutionContext(config)
+  defer exec.Release()
 
-  offset1 := DivIntUp  (n-1, 2)
-  offset2 := DivIntDown(n-1, 2)
+  pool    := exec.Pool
+  scratch := newVectorBatchScratch(exec, classifier, f != nil, m)
 
   // counter
   l := 0
   // total track length
   L := 0
   for _, length := range track.GetGenome().Lengths {
-    L += length/config.BinSize
-  }
-  if config.Verbose > 0 {
-    NewProgress(L, L).PrintStderr(l)
+    L += length/track.GetBinSize()
   }
+  progress := NewNamedProgress("Classifying", L, L)
+  callback := GetProgressCallback(config, opts.Progress)
+  progress.Report(callback, l, "")
 
-  for _, name := range track.GetSeqNames() {
-    seq1, err := track.GetSequence(name); if err != nil {
+  for it.NextSequence() {
+    if err := ContextError(ctx); err != nil {
       return nil, err
     }
-    seq2, err := result.GetSequence(name); if err != nil {
+    windows := it.Sequence()
+    name    := windows.Seqname
+    nbins   := windows.NBins()
+
+    seq, err := getClassificationSequences(result, name); if err != nil {
       return nil, err
     }
-    nbins := seq2.NBins()
-
-    // skip any sequence shorter than the classifier dimension
-    if nbins < n {
-      for i := 0; i < nbins; i++ {
-        seq2.SetBin(i, nan)
+    // clear sequences without windows, i.e. sequences shorter
+    // than the classifier dimension if edges are not padded
+    if windows.Len() == 0 {
+      for _, s := range seq {
+        for i := 0; i < nbins; i++ {
+          s.SetBin(i, nan)
+        }
       }
       l += nbins
 
-      if config.Verbose > 0 {
-        NewProgress(L, L).PrintStderr(l)
-      }
+      progress.Report(callback, l, name)
       continue
     }
+    // reserve memory for the sequence
+    bytes := windows.Bytes() + 16*int64(nbins)*int64(len(result))
+    if err := exec.Memory.Acquire(ctx, bytes); err != nil {
+      return nil, err
+    }
     g := pool.NewJobGroup()
+    // results of all windows for each output
+    results := make([][]float64, len(result))
+    for j := range results {
+      results[j] = make([]float64, windows.Len())
+    }
 
     // convert whole sequence to vector
-    x := NullDenseVector(Float64Type, nbins)
-    for i := 0; i < nbins; i++ {
-      x.At(i).SetFloat64(seq1.AtBin(i))
-    }
+    windows.Load()
 
-    // clear non-accessible regions
-    for i := 0; i < offset1; i++ {
-      seq2.SetBin(i, nan)
-    }
-    for i := nbins-offset2; i  < nbins; i++ {
-      seq2.SetBin(i, nan)
-    }
     // launch jobs
-    if err := pool.AddRangeJob(offset1, nbins-offset2, g, func(i int, pool threadpool.ThreadPool, erf func() error) error {
+    if err := pool.AddRangeJob(0, windows.Len(), g, func(k int, pool threadpool.ThreadPool, erf func() error) error {
       if erf() != nil {
         return nil
       }
-      r := r.At(pool.GetThreadId())
-      c := c   [pool.GetThreadId()]
-      y := y   [pool.GetThreadId()]
-      x := x.Slice(i-offset1,i+offset2+1)
+      if err := ContextError(ctx); err != nil {
+        return err
+      }
+      s := scratch.Get().(vectorBatchScratch)
+      defer scratch.Put(s)
+      r := s.r
+      c := s.c
+      y := s.y
+      w := windows.Window(k)
       if f != nil {
-        if err := f.Eval(y, x); err != nil {
+        if err := f.Eval(y, w.Vector); err != nil {
           return err
         }
       } else {
-        y = x
+        y = w.Vector
       }
       if err := c.Eval(r, y); err != nil {
         return err
       }
-      seq2.SetBin(i, r.GetFloat64())
+      for j := range results {
+        results[j][k] = r.Float64At(j)
+      }
       return nil
     }); err != nil {
+      exec.Memory.Release(bytes)
       return nil, err
     }
     // wait for threads
     if err := pool.Wait(g); err != nil {
+      exec.Memory.Release(bytes)
       return nil, err
     }
+    // assign results to bins
+    for j := range results {
+      windows.Aggregate(seq[j], results[j], opts.Aggregation)
+    }
+    exec.Memory.Release(bytes)
     l += nbins
 
-    if config.Verbose > 0 {
-      NewProgress(L, L).PrintStderr(l)
-    }
+    progress.Report(callback, l, name)
+  }
+  if err := it.Err(); err != nil {
+    return nil, err
   }
   return result, nil
 }
 
 // Run several independent classifiers and combine results
-func BatchClassifySingleTracks(config SessionConfig, classifiers []VectorBatchClassifier, tracks []Track, args ...interface{}) (MutableTrack, error) {
+func BatchClassifySingleTracks(config SessionConfig, classifiers []VectorBatchClassifier, tracks []Track, options ...Option) (MutableTrack, error) {
+  return BatchClassifySingleTracksContext(context.Background(), config, classifiers, tracks, options...)
+}
+
+func BatchClassifySingleTracksContext(ctx context.Context, config SessionConfig, classifiers []VectorBatchClassifier, tracks []Track, options ...Option) (MutableTrack, error) {
 
-  result, err := BatchClassifySingleTrack(config, classifiers[0], tracks[0], args...); if err != nil {
+  result, err := BatchClassifySingleTrackContext(ctx, config, classifiers[0], tracks[0], options...); if err != nil {
     return nil, err
   }
   for i := 1; i < len(tracks); i++ {
-    tmp, err := BatchClassifySingleTrack(config, classifiers[i], tracks[i], args...); if err != nil {
+    tmp, err := BatchClassifySingleTrackContext(ctx, config, classifiers[i], tracks[i], options...); if err != nil {
       return nil, err
     }
     // add tmp track to result
@@ -270,40 +337,112 @@ func BatchClassifySingleTracks(config SessionConfig, classifiers []VectorBatchCl
   return result, nil
 }
 
-func ClassifySingleTrack(config SessionConfig, classifier VectorClassifier, track Track, args ...interface{}) (MutableTrack, error) {
+// Classify all sequences of a track with a classifier of variable
+// dimension, such as a hidden Markov model. Sequences are split into
+// overlapping chunks that are classified in parallel if the WithChunks
+// option is given.
+func ClassifySingleTrack(config SessionConfig, classifier VectorClassifier, track Track, options ...Option) (MutableTrack, error) {
+  return ClassifySingleTrackContext(context.Background(), config, classifier, track, options...)
+}
 
-  if n := classifier.Dim(); n != -1 {
-    return nil, fmt.Errorf("classifier must have variable dimension")
+func ClassifySingleTrackContext(ctx context.Context, config SessionConfig, classifier VectorClassifier, track Track, options ...Option) (MutableTrack, error) {
+  result, err := classifySingleTrack(ctx, config, "ClassifySingleTrack", VectorClassifierList{classifier}, track, options); if err != nil {
+    return nil, err
   }
-  var f SingleTrackDataTransform
+  return result[0], nil
+}
 
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case SingleTrackDataTransform:
-      f = a
-    }
+// Classify all sequences of a track with a classifier of variable dimension
+// that has multiple outputs, such as the posterior probabilities of all HMM
+// states (see NewHmmPosteriors). The result contains one track for each
+// output of the classifier. Options are the same as for ClassifySingleTrack.
+func ClassifySingleTrackMultiOutput(config SessionConfig, classifier VectorMultiOutputClassifier, track Track, options ...Option) ([]MutableTrack, error) {
+  return ClassifySingleTrackMultiOutputContext(context.Background(), config, classifier, track, options...)
+}
+
+func ClassifySingleTrackMultiOutputContext(ctx context.Context, config SessionConfig, classifier VectorMultiOutputClassifier, track Track, options ...Option) ([]MutableTrack, error) {
+  return classifySingleTrack(ctx, config, "ClassifySingleTrackMultiOutput", classifier, track, options)
+}
+
+func classifySingleTrack(ctx context.Context, config SessionConfig, fname string, classifier VectorMultiOutputClassifier, track Track, options []Option) ([]MutableTrack, error) {
+
+  if n := classifier.Dim(); n != -1 {
+    return nil, NewDimensionError(-1, n, "classifier must have variable dimension")
+  }
+  opts, err := ParseOptions(fname, SingleTrackTransformOption | ChunkOption | RegionsOption | TrackOptions, options); if err != nil {
+    return nil, err
   }
+  f := opts.SingleTrackTransform
+  track = opts.FilterTrack(track)
 
-  result := AllocSimpleTrack("classification", track.GetGenome(), track.GetBinSize())
-  pool   := threadpool.New(config.Threads, 10000)
+  k      := classifier.NOutputs()
+  result := allocClassificationTracks(k, track.GetGenome(), track.GetBinSize())
+  exec   := opts.GetExecutionContext(config)
+  defer exec.Release()
 
-  // each thread gets its own classifier, since
+  pool := exec.Pool
+  // each job gets its own classifier, since
   // the given classifier may not be thread-safe
-  c := make([]VectorClassifier, config.Threads)
-  for i := 0; i < config.Threads; i++ {
-    c[i] = classifier.CloneVectorClassifier()
+  scratch := exec.NewScratchPool(func() interface{} {
+    return classifier.CloneVectorMultiOutputClassifier()
+  })
+  // ranges of bins that are classified
+  var regions map[string][][2]int
+  if opts.Regions.Length() > 0 {
+    regions = classificationBinRegions(opts.Regions, track.GetBinSize())
   }
   g := pool.NewJobGroup()
+  // first error that stops the submission of jobs
+  var errSubmit error
 
+LOOP:
   for _, name := range track.GetSeqNames() {
+    // stop submitting jobs if the context is canceled, queued jobs
+    // return immediately
+    if ctx.Err() != nil {
+      break
+    }
     seq1, err := track.GetSequence(name); if err != nil {
-      return nil, err
+      errSubmit = SequenceError{Seqname: name, Err: err}
+      break
     }
-    seq2, err := result.GetSequence(name); if err != nil {
-      return nil, err
+    seq2, err := getClassificationSequences(result, name); if err != nil {
+      errSubmit = err
+      break
+    }
+    // each chunk is classified by a separate job
+    chunks := SplitSequence(seq1.NBins(), opts.ChunkSize, opts.ChunkOverlap)
+    // skip chunks outside of regions, bins of skipped chunks are
+    // missing values
+    if regions != nil {
+      tmp := []SequenceChunk{}
+      for _, chunk := range chunks {
+        if overlapsBinRegions(regions[name], chunk.CoreFrom, chunk.CoreTo) {
+          tmp = append(tmp, chunk)
+          continue
+        }
+        for j := range seq2 {
+          for i := chunk.CoreFrom; i < chunk.CoreTo; i++ {
+            seq2[j].SetBin(i, math.NaN())
+          }
+        }
+      }
+      if chunks = tmp; len(chunks) == 0 {
+        continue
+      }
     }
 
-    // convert whole sequence to vector
+    // reserve memory for the input vector and the output vectors of
+    // all chunks, which is released once the last chunk is done
+    bytes := 8*int64(seq1.NBins())
+    for _, chunk := range chunks {
+      bytes += 8*int64(chunk.Len())*int64(k)
+    }
+    if err := exec.Memory.Acquire(ctx, bytes); err != nil {
+      break
+    }
+    // convert whole sequence to vector, the transform is always
+    // applied to the whole sequence
     x := NullDenseVector(Float64Type, seq1.NBins())
     for i := 0; i < seq1.NBins(); i++ {
       x.At(i).SetFloat64(seq1.AtBin(i))
@@ -311,26 +450,57 @@ func ClassifySingleTrack(config SessionConfig, classifier VectorClassifier, trac
     if f != nil {
       x = f.Eval(x)
     }
-
-    if err := pool.AddJob(g, func(pool threadpool.ThreadPool, erf func() error) error {
-      if erf() != nil {
+    pending := int32(len(chunks))
+
+    for i, chunk := range chunks {
+      chunk := chunk
+      if err := pool.AddJob(g, func(pool threadpool.ThreadPool, erf func() error) error {
+        defer func() {
+          if atomic.AddInt32(&pending, -1) == 0 {
+            exec.Memory.Release(bytes)
+          }
+        }()
+        if erf() != nil {
+          return nil
+        }
+        if err := ContextError(ctx); err != nil {
+          return err
+        }
+        c := scratch.Get().(VectorMultiOutputClassifier)
+        defer scratch.Put(c)
+        r := make([]Vector, k)
+        for j := range r {
+          r[j] = NullDenseVector(Float64Type, chunk.Len())
+        }
+        if err := c.Eval(r, x.Slice(chunk.From, chunk.To)); err != nil {
+          return err
+        }
+        // keep only results within the core of the chunk
+        for j := range r {
+          for i := chunk.CoreFrom; i < chunk.CoreTo; i++ {
+            seq2[j].SetBin(i, r[j].Float64At(i-chunk.From))
+          }
+        }
         return nil
+      }); err != nil {
+        // release memory of all chunks that were not submitted
+        if atomic.AddInt32(&pending, -int32(len(chunks)-i)) == 0 {
+          exec.Memory.Release(bytes)
+        }
+        errSubmit = err
+        break LOOP
       }
-      c := c[pool.GetThreadId()]
-      r := NullDenseVector(Float64Type, seq1.NBins())
-      if err := c.Eval(r, x); err != nil {
-        return err
-      }
-      for i := 0; i < seq1.NBins(); i++ {
-        seq2.SetBin(i, r.At(i).GetFloat64())
-      }
-      return nil
-    }); err != nil {
-      return nil, err
     }
   }
-  // wait for threads
-  if err := pool.Wait(g); err != nil {
+  // always wait for submitted jobs, since they write into the result
+  // and hold memory of the execution context
+  if err := pool.Wait(g); err != nil && errSubmit == nil {
+    errSubmit = err
+  }
+  if errSubmit != nil {
+    return nil, errSubmit
+  }
+  if err := ContextError(ctx); err != nil {
     return nil, err
   }
   return result, nil
@@ -338,14 +508,33 @@ func ClassifySingleTrack(config SessionConfig, classifier VectorClassifier, trac
 
 /* -------------------------------------------------------------------------- */
 
-func ImportAndBatchClassifySingleTrack(config SessionConfig, classifier VectorBatchClassifier, trackFile string, args ...interface{}) (MutableTrack, error) {
+func ImportAndBatchClassifySingleTrack(config SessionConfig, classifier VectorBatchClassifier, trackFile string, options ...Option) (MutableTrack, error) {
+  return ImportAndBatchClassifySingleTrackContext(context.Background(), config, classifier, trackFile, options...)
+}
+
+func ImportAndBatchClassifySingleTrackContext(ctx context.Context, config SessionConfig, classifier VectorBatchClassifier, trackFile string, options ...Option) (MutableTrack, error) {
+  track, err := ImportTrack(config, trackFile); if err != nil {
+    return nil, err
+  }
+  return BatchClassifySingleTrackContext(ctx, config, classifier, track, options...)
+}
+
+func ImportAndBatchClassifySingleTrackMultiOutput(config SessionConfig, classifier VectorBatchMultiOutputClassifier, trackFile string, options ...Option) ([]MutableTrack, error) {
+  return ImportAndBatchClassifySingleTrackMultiOutputContext(context.Background(), config, classifier, trackFile, options...)
+}
+
+func ImportAndBatchClassifySingleTrackMultiOutputContext(ctx context.Context, config SessionConfig, classifier VectorBatchMultiOutputClassifier, trackFile string, options ...Option) ([]MutableTrack, error) {
   track, err := ImportTrack(config, trackFile); if err != nil {
     return nil, err
   }
-  return BatchClassifySingleTrack(config, classifier, track, args...)
+  return BatchClassifySingleTrackMultiOutputContext(ctx, config, classifier, track, options...)
+}
+
+func ImportAndBatchClassifySingleTracks(config SessionConfig, classifiers []VectorBatchClassifier, trackFiles []string, options ...Option) (MutableTrack, error) {
+  return ImportAndBatchClassifySingleTracksContext(context.Background(), config, classifiers, trackFiles, options...)
 }
 
-func ImportAndBatchClassifySingleTracks(config SessionConfig, classifiers []VectorBatchClassifier, trackFiles []string, args ...interface{}) (MutableTrack, error) {
+func ImportAndBatchClassifySingleTracksContext(ctx context.Context, config SessionConfig, classifiers []VectorBatchClassifier, trackFiles []string, options ...Option) (MutableTrack, error) {
   var result MutableTrack
   var err    error
   // check in advance if all tracks are available
@@ -359,12 +548,12 @@ func ImportAndBatchClassifySingleTracks(config SessionConfig, classifiers []Vect
     }
   }
   // load first track and run classifier
-  result, err = ImportAndBatchClassifySingleTrack(config, classifiers[0], trackFiles[0], args...); if err != nil {
+  result, err = ImportAndBatchClassifySingleTrackContext(ctx, config, classifiers[0], trackFiles[0], options...); if err != nil {
     return result, err
   }
   for i := 1; i < len(trackFiles); i++ {
     // load remaining tracks and run classifier
-    tmp, err := ImportAndBatchClassifySingleTrack(config, classifiers[i], trackFiles[i], args...); if err != nil {
+    tmp, err := ImportAndBatchClassifySingleTrackContext(ctx, config, classifiers[i], trackFiles[i], options...); if err != nil {
       return result, err
     }
     // add tmp track to result
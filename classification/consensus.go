@@ -0,0 +1,249 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package classification
+
+/* -------------------------------------------------------------------------- */
+
+import   "fmt"
+import   "bufio"
+import   "io"
+import   "math"
+import   "os"
+import   "sort"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+type consensusPeak struct {
+  seqname string
+  from    int
+  to      int
+  sample  int
+  signal  float64
+}
+
+type consensusPeaks []consensusPeak
+
+func (obj consensusPeaks) Len() int {
+  return len(obj)
+}
+
+func (obj consensusPeaks) Less(i, j int) bool {
+  if obj[i].seqname != obj[j].seqname {
+    return obj[i].seqname < obj[j].seqname
+  }
+  return obj[i].from < obj[j].from
+}
+
+func (obj consensusPeaks) Swap(i, j int) {
+  obj[i], obj[j] = obj[j], obj[i]
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Merge peaks of several samples into a consensus peak set. Peaks of all
+// samples are pooled and merged if they overlap or are separated by at
+// most maxGap base pairs. Only merged regions that contain peaks of at
+// least minSamples samples are kept. The signal of a sample is taken from
+// the `test' meta column (maximum over all peaks of this sample within a
+// region). The result has the following meta columns:
+//   samples  - number of samples with a peak in this region
+//   presence - for each sample 1 if a peak is present and 0 otherwise
+//   signal   - for each sample the maximum signal or NaN if absent
+func GetConsensusPeaks(peaks []GRanges, minSamples, maxGap int) (GRanges, error) {
+  if minSamples < 1 || minSamples > len(peaks) {
+    return GRanges{}, NewArgumentError("invalid minimum number of samples `%d' (number of samples is `%d')", minSamples, len(peaks))
+  }
+  if maxGap < 0 {
+    return GRanges{}, NewArgumentError("invalid maximum gap `%d'", maxGap)
+  }
+  n := len(peaks)
+  // pool peaks of all samples
+  pool := consensusPeaks{}
+  for j := 0; j < n; j++ {
+    test := peaks[j].GetMetaFloat("test")
+    for i := 0; i < peaks[j].Length(); i++ {
+      signal := math.NaN()
+      if len(test) > 0 {
+        signal = test[i]
+      }
+      pool = append(pool, consensusPeak{peaks[j].Seqnames[i], peaks[j].Ranges[i].From, peaks[j].Ranges[i].To, j, signal})
+    }
+  }
+  sort.Sort(pool)
+
+  seqnames := []string{}
+  from     := []int{}
+  to       := []int{}
+  samples  := []int{}
+  presence := [][]int{}
+  signal   := [][]float64{}
+
+  for i := 0; i < len(pool); {
+    // current region
+    rSeqname := pool[i].seqname
+    rFrom    := pool[i].from
+    rTo      := pool[i].to
+    rPres    := make([]int,     n)
+    rSignal  := make([]float64, n)
+    for j := 0; j < n; j++ {
+      rSignal[j] = math.NaN()
+    }
+    for ; i < len(pool) && pool[i].seqname == rSeqname && pool[i].from <= rTo+maxGap; i++ {
+      if pool[i].to > rTo {
+        rTo = pool[i].to
+      }
+      k := pool[i].sample
+      rPres[k] = 1
+      if math.IsNaN(rSignal[k]) || pool[i].signal > rSignal[k] {
+        rSignal[k] = pool[i].signal
+      }
+    }
+    m := 0
+    for j := 0; j < n; j++ {
+      m += rPres[j]
+    }
+    if m < minSamples {
+      continue
+    }
+    seqnames = append(seqnames, rSeqname)
+    from     = append(from,     rFrom)
+    to       = append(to,       rTo)
+    samples  = append(samples,  m)
+    presence = append(presence, rPres)
+    signal   = append(signal,   rSignal)
+  }
+  result := NewGRanges(seqnames, from, to, nil)
+  result.AddMeta("samples",  samples)
+  result.AddMeta("presence", presence)
+  result.AddMeta("signal",   signal)
+
+  return result, nil
+}
+
+// Call peaks on each track and merge them into a consensus peak set
+// (see GetPeaks and GetConsensusPeaks).
+func GetConsensusPeaksFromTracks(tracks []Track, thresholds []float64, wsize, minSamples, maxGap int) (GRanges, error) {
+  if len(tracks) != len(thresholds) {
+    return GRanges{}, NewDimensionError(len(tracks), len(thresholds), "GetConsensusPeaksFromTracks(): number of tracks and thresholds do not match")
+  }
+  peaks := make([]GRanges, len(tracks))
+  for i := 0; i < len(tracks); i++ {
+    peaks[i] = GetPeaks(tracks[i], thresholds[i], wsize)
+  }
+  return GetConsensusPeaks(peaks, minSamples, maxGap)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Compute a sample-by-peak matrix of counts, where each entry is the sum
+// of all (non-NaN) track values within a peak, i.e. counts[j][i] is the
+// count of sample j in peak i.
+func PeakCountMatrix(peaks GRanges, tracks []Track) ([][]float64, error) {
+  counts := make([][]float64, len(tracks))
+  for j, track := range tracks {
+    binSize := track.GetBinSize()
+    if binSize <= 0 {
+      return nil, fmt.Errorf("track `%d': %w", j+1, NewBinSizeError(0, binSize, "invalid bin size `%d'", binSize))
+    }
+    counts[j] = make([]float64, peaks.Length())
+    for i := 0; i < peaks.Length(); i++ {
+      seq, err := track.GetSequence(peaks.Seqnames[i]); if err != nil {
+        return nil, fmt.Errorf("track `%d': %w", j+1, SequenceError{Seqname: peaks.Seqnames[i], Err: err})
+      }
+      sum := 0.0
+      for k := peaks.Ranges[i].From/binSize; k < DivIntUp(peaks.Ranges[i].To, binSize) && k < seq.NBins(); k++ {
+        if v := seq.AtBin(k); !math.IsNaN(v) {
+          sum += v
+        }
+      }
+      counts[j][i] = sum
+    }
+  }
+  return counts, nil
+}
+
+// Write a count matrix as tab separated table with one row per sample and
+// one column per peak. The first column contains the sample name and the
+// header contains peak identifiers of the form `seqname:from-to'.
+func WritePeakCountMatrix(w io.Writer, peaks GRanges, sampleNames []string, counts [][]float64) error {
+  if len(counts) != len(sampleNames) {
+    return NewDimensionError(len(sampleNames), len(counts), "count matrix has invalid number of rows")
+  }
+  if _, err := fmt.Fprintf(w, "sample"); err != nil {
+    return err
+  }
+  for i := 0; i < peaks.Length(); i++ {
+    if _, err := fmt.Fprintf(w, "\t%s:%d-%d", peaks.Seqnames[i], peaks.Ranges[i].From, peaks.Ranges[i].To); err != nil {
+      return err
+    }
+  }
+  if _, err := fmt.Fprintf(w, "\n"); err != nil {
+    return err
+  }
+  for j, name := range sampleNames {
+    if len(counts[j]) != peaks.Length() {
+      return NewDimensionError(peaks.Length(), len(counts[j]), "count matrix has invalid number of columns")
+    }
+    if _, err := fmt.Fprintf(w, "%s", name); err != nil {
+      return err
+    }
+    for i := 0; i < len(counts[j]); i++ {
+      if _, err := fmt.Fprintf(w, "\t%v", counts[j][i]); err != nil {
+        return err
+      }
+    }
+    if _, err := fmt.Fprintf(w, "\n"); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// Compute and export the count matrix for a set of (consensus) peaks.
+func ExportPeakCountMatrix(config SessionConfig, filename string, peaks GRanges, sampleNames []string, tracks []Track) error {
+  if len(sampleNames) != len(tracks) {
+    return NewDimensionError(len(tracks), len(sampleNames), "number of sample names does not match number of tracks")
+  }
+  counts, err := PeakCountMatrix(peaks, tracks); if err != nil {
+    return err
+  }
+  task := BeginTask(config, fmt.Sprintf("Writing count matrix `%s'", filename), "output", filename)
+  f, err := os.Create(filename)
+  if err != nil {
+    task.Failed(err)
+    return err
+  }
+  defer f.Close()
+
+  w := bufio.NewWriter(f)
+  if err := WritePeakCountMatrix(w, peaks, sampleNames, counts); err != nil {
+    task.Failed(err)
+    return err
+  }
+  if err := w.Flush(); err != nil {
+    task.Failed(err)
+    return err
+  }
+  task.Done()
+  return nil
+}
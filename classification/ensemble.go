@@ -0,0 +1,396 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package classification
+
+/* -------------------------------------------------------------------------- */
+
+import   "context"
+import   "math"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/options"
+import . "github.com/pbenner/ngstat/track"
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/autodiff"
+import . "github.com/pbenner/autodiff/statistics"
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+// Rule for combining the outputs of the members of an ensemble. Outputs are
+// log probabilities, as computed by posterior classifiers, and rules return
+// a log probability.
+type EnsembleRule interface {
+  Combine(x []float64) (float64, error)
+  // check if the rule can combine n outputs
+  Check(n int) error
+  CloneEnsembleRule() EnsembleRule
+}
+
+// logit computed from a log probability
+func logOdds(x float64) float64 {
+  return x - math.Log1p(-math.Exp(x))
+}
+
+// log probability computed from a logit
+func logSigmoid(x float64) float64 {
+  if x < 0 {
+    return x - math.Log1p(math.Exp(x))
+  }
+  return -math.Log1p(math.Exp(-x))
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Product of posterior probabilities, i.e. the sum of log probabilities.
+type EnsembleProduct struct{}
+
+func (EnsembleProduct) Combine(x []float64) (float64, error) {
+  r := 0.0
+  for _, v := range x {
+    r += v
+  }
+  return r, nil
+}
+
+func (EnsembleProduct) Check(n int) error {
+  return nil
+}
+
+func (obj EnsembleProduct) CloneEnsembleRule() EnsembleRule {
+  return obj
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Sum of log-odds, which corresponds to a naive Bayes combination of
+// posterior probabilities with uniform prior. Log-odds of members are
+// clamped to [-EnsembleMaxLogOdds, EnsembleMaxLogOdds], so that members
+// with posterior probability zero or one do not yield NaN if they
+// contradict each other.
+type EnsembleLogOdds struct{}
+
+// Largest absolute log-odds used by EnsembleLogOdds, which corresponds to
+// a posterior probability of 1-2^-52.
+const EnsembleMaxLogOdds = 52*math.Ln2
+
+func (EnsembleLogOdds) Combine(x []float64) (float64, error) {
+  r := 0.0
+  for _, v := range x {
+    r += math.Max(-EnsembleMaxLogOdds, math.Min(EnsembleMaxLogOdds, logOdds(v)))
+  }
+  return logSigmoid(r), nil
+}
+
+func (EnsembleLogOdds) Check(n int) error {
+  return nil
+}
+
+func (obj EnsembleLogOdds) CloneEnsembleRule() EnsembleRule {
+  return obj
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Minimum of all outputs.
+type EnsembleMin struct{}
+
+func (EnsembleMin) Combine(x []float64) (float64, error) {
+  r := math.Inf(1)
+  for _, v := range x {
+    r = math.Min(r, v)
+  }
+  return r, nil
+}
+
+func (EnsembleMin) Check(n int) error {
+  return nil
+}
+
+func (obj EnsembleMin) CloneEnsembleRule() EnsembleRule {
+  return obj
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Maximum of all outputs.
+type EnsembleMax struct{}
+
+func (EnsembleMax) Combine(x []float64) (float64, error) {
+  r := math.Inf(-1)
+  for _, v := range x {
+    r = math.Max(r, v)
+  }
+  return r, nil
+}
+
+func (EnsembleMax) Check(n int) error {
+  return nil
+}
+
+func (obj EnsembleMax) CloneEnsembleRule() EnsembleRule {
+  return obj
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Weighted vote, where a member votes for the foreground if its posterior
+// probability is at least Threshold. The result is the logarithm of the
+// weighted fraction of votes. All members have the same weight if no
+// weights are given, otherwise weights must be non-negative and at least
+// one weight must be positive.
+type EnsembleWeightedVote struct {
+  Weights   []float64
+  Threshold   float64
+}
+
+func NewEnsembleWeightedVote(threshold float64, weights ...float64) (EnsembleWeightedVote, error) {
+  if threshold < 0.0 || threshold > 1.0 {
+    return EnsembleWeightedVote{}, NewArgumentError("invalid threshold `%f'", threshold)
+  }
+  r := EnsembleWeightedVote{Weights: weights, Threshold: threshold}
+  if err := r.checkWeights(); err != nil {
+    return EnsembleWeightedVote{}, err
+  }
+  return r, nil
+}
+
+func (obj EnsembleWeightedVote) checkWeights() error {
+  if obj.Weights == nil {
+    return nil
+  }
+  z := 0.0
+  for _, w := range obj.Weights {
+    if w < 0.0 || math.IsNaN(w) || math.IsInf(w, 1) {
+      return NewArgumentError("invalid weight `%f'", w)
+    }
+    z += w
+  }
+  if z == 0.0 {
+    return NewArgumentError("at least one weight must be positive")
+  }
+  return nil
+}
+
+func (obj EnsembleWeightedVote) Combine(x []float64) (float64, error) {
+  t := math.Log(obj.Threshold)
+  n := 0.0
+  z := 0.0
+  for i, v := range x {
+    w := 1.0
+    if obj.Weights != nil {
+      w = obj.Weights[i]
+    }
+    if math.IsNaN(v) {
+      return math.NaN(), nil
+    }
+    if v >= t {
+      n += w
+    }
+    z += w
+  }
+  return math.Log(n/z), nil
+}
+
+func (obj EnsembleWeightedVote) Check(n int) error {
+  if obj.Weights != nil && len(obj.Weights) != n {
+    return NewDimensionError(n, len(obj.Weights), "invalid number of weights (expected `%d' weights, but `%d' are given)", n, len(obj.Weights))
+  }
+  return obj.checkWeights()
+}
+
+func (obj EnsembleWeightedVote) CloneEnsembleRule() EnsembleRule {
+  return obj
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Stacking, where outputs of all members are the input of a learned model,
+// e.g. a logistic regression estimated on member outputs at labeled bins
+// (see vectorEstimator.LogisticRegression). The result is the log density
+// of the model. The rule keeps temporary memory and must be used as a
+// pointer, i.e. &EnsembleStacking{Model: model}.
+type EnsembleStacking struct {
+  Model VectorPdf
+  // temporary memory, allocated on first use
+  x     Vector
+  r     Scalar
+}
+
+func NewEnsembleStacking(model VectorPdf) *EnsembleStacking {
+  return &EnsembleStacking{Model: model}
+}
+
+func (obj *EnsembleStacking) Combine(x []float64) (float64, error) {
+  if obj.x == nil || obj.x.Dim() != obj.Model.Dim() {
+    obj.x = NullDenseVector(obj.Model.ScalarType(), obj.Model.Dim())
+    obj.r = NullScalar(obj.Model.ScalarType())
+  }
+  for i, v := range x {
+    obj.x.At(i).SetFloat64(v)
+  }
+  if err := obj.Model.LogPdf(obj.r, obj.x); err != nil {
+    return math.NaN(), err
+  }
+  return obj.r.GetFloat64(), nil
+}
+
+func (obj *EnsembleStacking) Check(n int) error {
+  if obj.Model.Dim() != n {
+    return NewDimensionError(n, obj.Model.Dim(), "stacking model has invalid dimension (expected dimension `%d', but model has dimension `%d')", n, obj.Model.Dim())
+  }
+  return nil
+}
+
+func (obj *EnsembleStacking) CloneEnsembleRule() EnsembleRule {
+  return NewEnsembleStacking(obj.Model.CloneVectorPdf())
+}
+
+/* -------------------------------------------------------------------------- */
+
+// User-defined rule, the function must be thread-safe. Unlike other rules,
+// the result is not required to be a log probability.
+type EnsembleFunc func(x []float64) float64
+
+func (f EnsembleFunc) Combine(x []float64) (float64, error) {
+  return f(x), nil
+}
+
+func (EnsembleFunc) Check(n int) error {
+  return nil
+}
+
+func (f EnsembleFunc) CloneEnsembleRule() EnsembleRule {
+  return f
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Classifier that evaluates each member on one row of a multi-track
+// window, i.e. the i-th member is applied to the i-th track, and combines
+// the outputs with a rule. Members may have different dimensions, the
+// window size of the ensemble is the largest dimension and smaller members
+// are applied to the center of the window.
+type MatrixBatchEnsemble struct {
+  members []VectorBatchClassifier
+  offsets []int
+  rule    EnsembleRule
+  n       int
+  // temporary memory
+  x       []float64
+  t       Scalar
+}
+
+func NewMatrixBatchEnsemble(rule EnsembleRule, members ...VectorBatchClassifier) (*MatrixBatchEnsemble, error) {
+  if len(members) == 0 {
+    return nil, NewArgumentError("no classifiers given")
+  }
+  if err := rule.Check(len(members)); err != nil {
+    return nil, err
+  }
+  n := 0
+  for i, c := range members {
+    if c.Dim() < 1 {
+      return nil, NewDimensionError(0, c.Dim(), "classifier `%d' has invalid dimension `%d'", i+1, c.Dim())
+    }
+    n = MaxInt(n, c.Dim())
+  }
+  offsets := make([]int, len(members))
+  for i, c := range members {
+    o1, _ := WindowOffsets(n, WindowAnchorCenter)
+    o2, _ := WindowOffsets(c.Dim(), WindowAnchorCenter)
+    offsets[i] = o1 - o2
+  }
+  r := MatrixBatchEnsemble{}
+  r.members = members
+  r.offsets = offsets
+  r.rule    = rule
+  r.n       = n
+  r.x       = make([]float64, len(members))
+  r.t       = NullFloat64()
+  return &r, nil
+}
+
+func (obj *MatrixBatchEnsemble) Eval(r Scalar, x ConstMatrix) error {
+  for i, c := range obj.members {
+    if err := c.Eval(obj.t, x.ConstRow(i).ConstSlice(obj.offsets[i], obj.offsets[i]+c.Dim())); err != nil {
+      return err
+    }
+    obj.x[i] = obj.t.GetFloat64()
+  }
+  if v, err := obj.rule.Combine(obj.x); err != nil {
+    return err
+  } else {
+    r.SetFloat64(v)
+  }
+  return nil
+}
+
+func (obj *MatrixBatchEnsemble) Dims() (int, int) {
+  return len(obj.members), obj.n
+}
+
+func (obj *MatrixBatchEnsemble) CloneMatrixBatchClassifier() MatrixBatchClassifier {
+  members := make([]VectorBatchClassifier, len(obj.members))
+  for i, c := range obj.members {
+    members[i] = c.CloneVectorBatchClassifier()
+  }
+  r := MatrixBatchEnsemble{}
+  r.members = members
+  r.offsets = obj.offsets
+  r.rule    = obj.rule.CloneEnsembleRule()
+  r.n       = obj.n
+  r.x       = make([]float64, len(members))
+  r.t       = NullFloat64()
+  return &r
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Run an ensemble on a sliding window over a set of tracks, where the i-th
+// member of the ensemble is applied to the i-th track. The same track may be
+// given several times to combine classifiers on a single track. All members
+// are evaluated and combined in a single pass, options are the same as for
+// BatchClassifyMultiTrack.
+func BatchClassifyEnsemble(config SessionConfig, ensemble *MatrixBatchEnsemble, tracks []Track, options ...Option) (MutableTrack, error) {
+  return BatchClassifyEnsembleContext(context.Background(), config, ensemble, tracks, options...)
+}
+
+func BatchClassifyEnsembleContext(ctx context.Context, config SessionConfig, ensemble *MatrixBatchEnsemble, tracks []Track, options ...Option) (MutableTrack, error) {
+  result, err := batchClassifyMultiTrack(ctx, config, "BatchClassifyEnsemble", MatrixBatchClassifierList{ensemble}, tracks, false, options); if err != nil || result == nil {
+    return nil, err
+  }
+  return result[0], nil
+}
+
+func ImportAndBatchClassifyEnsemble(config SessionConfig, ensemble *MatrixBatchEnsemble, trackFiles []string, options ...Option) (MutableTrack, error) {
+  return ImportAndBatchClassifyEnsembleContext(context.Background(), config, ensemble, trackFiles, options...)
+}
+
+func ImportAndBatchClassifyEnsembleContext(ctx context.Context, config SessionConfig, ensemble *MatrixBatchEnsemble, trackFiles []string, options ...Option) (MutableTrack, error) {
+  tracks := make([]Track, len(trackFiles))
+  for i := 0; i < len(trackFiles); i++ {
+    track, err := ImportLazyTrack(config, trackFiles[i]); if err != nil {
+      return nil, err
+    }
+    defer track.Close()
+    tracks[i] = track
+  }
+  return BatchClassifyEnsembleContext(ctx, config, ensemble, tracks, options...)
+}
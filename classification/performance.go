@@ -18,18 +18,32 @@ package classification
 
 /* -------------------------------------------------------------------------- */
 
-//import   "fmt"
 import   "math"
 
 import . "github.com/pbenner/ngstat/utility"
 
 /* -------------------------------------------------------------------------- */
 
-func Performance(groundtruth []int, test []float64, n int) ([]float64, []int, []int, []int, []int) {
+func checkPerformanceArguments(n1, n2, n int) error {
+  if n1 != n2 {
+    return NewDimensionError(n1, n2, "ground truth and test values have different lengths (`%d' and `%d')", n1, n2)
+  }
+  if n1 == 0 {
+    return NewArgumentError("no test values given")
+  }
+  if n < 1 {
+    return NewArgumentError("invalid number of thresholds `%d'", n)
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+func Performance(groundtruth []int, test []float64, n int) ([]float64, []int, []int, []int, []int, error) {
   n1 := len(groundtruth)
   n2 := len(test)
-  if n1 != n2 {
-    panic("invalid arguments")
+  if err := checkPerformanceArguments(n1, n2, n); err != nil {
+    return nil, nil, nil, nil, nil, err
   }
   min := SliceMin(test)
   max := SliceMax(test)
@@ -62,14 +76,14 @@ func Performance(groundtruth []int, test []float64, n int) ([]float64, []int, []
     tnv = append(tnv, tn)
     fnv = append(fnv, fn)
   }
-  return thr, tpv, fpv, tnv, fnv
+  return thr, tpv, fpv, tnv, fnv, nil
 }
 
-func RocCurve(groundtruth []int, test []float64, n int) ([]float64, []float64, []float64) {
+func RocCurve(groundtruth []int, test []float64, n int) ([]float64, []float64, []float64, error) {
   n1 := len(groundtruth)
   n2 := len(test)
-  if n1 != n2 {
-    panic("invalid arguments")
+  if err := checkPerformanceArguments(n1, n2, n); err != nil {
+    return nil, nil, nil, err
   }
   min := SliceMin(test)
   max := SliceMax(test)
@@ -98,14 +112,14 @@ func RocCurve(groundtruth []int, test []float64, n int) ([]float64, []float64, [
     fpr = append(fpr, float64(fp)/float64(fp + tn))
     thr = append(thr, t)
   }
-  return thr, fpr, tpr
+  return thr, fpr, tpr, nil
 }
 
-func PrecisionRecallCurve(groundtruth []int, test []float64, n int) ([]float64, []float64, []float64) {
+func PrecisionRecallCurve(groundtruth []int, test []float64, n int) ([]float64, []float64, []float64, error) {
   n1 := len(groundtruth)
   n2 := len(test)
-  if n1 != n2 {
-    panic("invalid arguments")
+  if err := checkPerformanceArguments(n1, n2, n); err != nil {
+    return nil, nil, nil, err
   }
   min := SliceMin(test)
   max := SliceMax(test)
@@ -131,14 +145,14 @@ func PrecisionRecallCurve(groundtruth []int, test []float64, n int) ([]float64,
     ppv = append(ppv, float64(tp)/float64(tp + fp))
     thr = append(thr, t)
   }
-  return thr, tpr, ppv
+  return thr, tpr, ppv, nil
 }
 
-func AUC(x, y []float64) float64 {
+func AUC(x, y []float64) (float64, error) {
   n1 := len(x)
   n2 := len(y)
   if n1 != n2 {
-    panic("invalid arguments")
+    return 0.0, NewDimensionError(n1, n2, "AUC(): x and y have different lengths (`%d' and `%d')", n1, n2)
   }
   result := 0.0
 
@@ -147,5 +161,5 @@ func AUC(x, y []float64) float64 {
     dy := (y[i] + y[i-1])/2.0
     result += dx*dy
   }
-  return result
+  return result, nil
 }
@@ -0,0 +1,241 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package classification
+
+/* -------------------------------------------------------------------------- */
+
+import   "math"
+
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/autodiff"
+import   "github.com/pbenner/autodiff/statistics/matrixDistribution"
+import   "github.com/pbenner/autodiff/statistics/scalarDistribution"
+import   "github.com/pbenner/autodiff/statistics/vectorDistribution"
+
+/* -------------------------------------------------------------------------- */
+
+// Check sets of states, where each set defines one output. If no sets are
+// given, each of the n states is a separate output.
+func posteriorStates(n int, states [][]int) ([][]int, error) {
+  if len(states) == 0 {
+    states = make([][]int, n)
+    for j := 0; j < n; j++ {
+      states[j] = []int{j}
+    }
+    return states, nil
+  }
+  for i, s := range states {
+    if len(s) == 0 {
+      return nil, NewArgumentError("output `%d' has no states", i+1)
+    }
+    for _, j := range s {
+      if j < 0 || j >= n {
+        return nil, NewArgumentError("invalid state `%d' for output `%d'", j, i+1)
+      }
+    }
+  }
+  return states, nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Batch classifier that computes the log posterior probabilities of several
+// sets of mixture components. Component densities are evaluated only once
+// for each observation and shared by all outputs. Windows of size n > 1 are
+// treated as iid observations, i.e. log posteriors are summed over the
+// window.
+type MixturePosteriors struct {
+  mixture *scalarDistribution.Mixture
+  states  [][]int
+  n       int
+  // temporary memory
+  p       []float64
+  s       []float64
+  t       Scalar
+}
+
+// Create a classifier with one output for each set of states. If no states
+// are given, the classifier computes the posterior probabilities of all
+// mixture components.
+func NewMixturePosteriors(mixture *scalarDistribution.Mixture, n int, states ...[]int) (*MixturePosteriors, error) {
+  if n < 1 {
+    return nil, NewArgumentError("invalid dimension `%d'", n)
+  }
+  states, err := posteriorStates(mixture.NComponents(), states); if err != nil {
+    return nil, err
+  }
+  r := MixturePosteriors{}
+  r.mixture = mixture
+  r.states  = states
+  r.n       = n
+  r.p       = make([]float64, mixture.NComponents())
+  r.s       = make([]float64, len(states))
+  r.t       = NullScalar(mixture.ScalarType())
+  return &r, nil
+}
+
+func (obj *MixturePosteriors) Eval(r Vector, x ConstVector) error {
+  if x.Dim() != obj.n {
+    return NewDimensionError(obj.n, x.Dim(), "data has invalid dimension (expected dimension `%d' but data has dimension `%d')", obj.n, x.Dim())
+  }
+  for k := range obj.s {
+    obj.s[k] = 0.0
+  }
+  for i := 0; i < x.Dim(); i++ {
+    // log joint probability of each component and the normalization
+    // constant
+    z := math.Inf(-1)
+    for j, edist := range obj.mixture.Edist {
+      if err := edist.LogPdf(obj.t, x.ConstAt(i)); err != nil {
+        return err
+      }
+      obj.p[j] = obj.t.GetFloat64() + obj.mixture.LogWeights.Float64At(j)
+      z = LogAdd(z, obj.p[j])
+    }
+    for k, states := range obj.states {
+      v := math.Inf(-1)
+      for _, j := range states {
+        v = LogAdd(v, obj.p[j])
+      }
+      obj.s[k] += v - z
+    }
+  }
+  for k, v := range obj.s {
+    r.At(k).SetFloat64(v)
+  }
+  return nil
+}
+
+func (obj *MixturePosteriors) Dim() int {
+  return obj.n
+}
+
+func (obj *MixturePosteriors) NOutputs() int {
+  return len(obj.states)
+}
+
+func (obj *MixturePosteriors) CloneVectorBatchMultiOutputClassifier() VectorBatchMultiOutputClassifier {
+  r, _ := NewMixturePosteriors(obj.mixture.Clone(), obj.n, obj.states...)
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Compute posterior probabilities of sets of states from the posterior
+// marginals p of an HMM, the k-th output is stored in r[k].
+func hmmPosteriors(r []Vector, p []Vector, states [][]int, n int, logScale bool) error {
+  if len(r) != len(states) {
+    return NewDimensionError(len(states), len(r), "invalid number of outputs (expected `%d' outputs, but `%d' are given)", len(states), len(r))
+  }
+  for k := range states {
+    if r[k].Dim() != n {
+      return NewDimensionError(n, r[k].Dim(), "output `%d' has invalid length", k+1)
+    }
+  }
+  for k, s := range states {
+    for i := 0; i < n; i++ {
+      v := math.Inf(-1)
+      for _, j := range s {
+        v = LogAdd(v, p[j].Float64At(i))
+      }
+      if !logScale {
+        v = math.Exp(v)
+      }
+      r[k].At(i).SetFloat64(v)
+    }
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Classifier that computes the posterior probabilities of several sets of
+// HMM states at each position. Posterior marginals are computed only once
+// for each sequence and shared by all outputs.
+type HmmPosteriors struct {
+  hmm      *vectorDistribution.Hmm
+  states   [][]int
+  logScale bool
+}
+
+// Create a classifier with one output for each set of states. If no states
+// are given, the classifier computes the posterior probabilities of all
+// HMM states.
+func NewHmmPosteriors(hmm *vectorDistribution.Hmm, logScale bool, states ...[]int) (*HmmPosteriors, error) {
+  states, err := posteriorStates(hmm.NStates(), states); if err != nil {
+    return nil, err
+  }
+  return &HmmPosteriors{hmm: hmm, states: states, logScale: logScale}, nil
+}
+
+func (obj *HmmPosteriors) Eval(r []Vector, x ConstVector) error {
+  p, err := obj.hmm.PosteriorMarginals(x); if err != nil {
+    return err
+  }
+  return hmmPosteriors(r, p, obj.states, x.Dim(), obj.logScale)
+}
+
+func (obj *HmmPosteriors) Dim() int {
+  return obj.hmm.Dim()
+}
+
+func (obj *HmmPosteriors) NOutputs() int {
+  return len(obj.states)
+}
+
+func (obj *HmmPosteriors) CloneVectorMultiOutputClassifier() VectorMultiOutputClassifier {
+  return &HmmPosteriors{hmm: obj.hmm.Clone(), states: obj.states, logScale: obj.logScale}
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Classifier that computes the posterior probabilities of several sets of
+// states of a multi-track HMM at each position.
+type MatrixHmmPosteriors struct {
+  hmm      *matrixDistribution.Hmm
+  states   [][]int
+  logScale bool
+}
+
+func NewMatrixHmmPosteriors(hmm *matrixDistribution.Hmm, logScale bool, states ...[]int) (*MatrixHmmPosteriors, error) {
+  states, err := posteriorStates(hmm.NStates(), states); if err != nil {
+    return nil, err
+  }
+  return &MatrixHmmPosteriors{hmm: hmm, states: states, logScale: logScale}, nil
+}
+
+func (obj *MatrixHmmPosteriors) Eval(r []Vector, x ConstMatrix) error {
+  p, err := obj.hmm.PosteriorMarginals(x); if err != nil {
+    return err
+  }
+  n, _ := x.Dims()
+  return hmmPosteriors(r, p, obj.states, n, obj.logScale)
+}
+
+func (obj *MatrixHmmPosteriors) Dims() (int, int) {
+  return obj.hmm.Dims()
+}
+
+func (obj *MatrixHmmPosteriors) NOutputs() int {
+  return len(obj.states)
+}
+
+func (obj *MatrixHmmPosteriors) CloneMatrixMultiOutputClassifier() MatrixMultiOutputClassifier {
+  return &MatrixHmmPosteriors{hmm: obj.hmm.Clone(), states: obj.states, logScale: obj.logScale}
+}
@@ -21,8 +21,10 @@ package classification
 import   "fmt"
 import   "math"
 
+import . "github.com/pbenner/ngstat/track"
 import . "github.com/pbenner/ngstat/utility"
 
+import . "github.com/pbenner/autodiff"
 import . "github.com/pbenner/gonetics"
 
 /* -------------------------------------------------------------------------- */
@@ -44,25 +46,28 @@ func sortPeaks(peaks GRanges) GRanges {
 
 func intersectingPeaks(r, s GRanges) GRanges {
   queryHits, subjectHits := FindOverlaps(r, s)
-  n        := len(queryHits)
-  seqnames := make([]string, n)
-  from     := make([]int, n)
-  to       := make([]int, n)
-  strand   := make([]byte, n)
-  test     := make([][]float64, n)
+  seqnames := []string{}
+  from     := []int{}
+  to       := []int{}
+  strand   := []byte{}
+  test     := [][]float64{}
   // get test results
   rTest := r.GetMeta("test").([][]float64)
   sTest := s.GetMeta("test").(  []float64)
 
-  for i := 0; i < n; i++ {
+  for i := 0; i < len(queryHits); i++ {
     iQ := queryHits[i]
     iS := subjectHits[i]
+    // skip peaks on opposite strands
+    if !strandsMatch(r.Strand[iQ], s.Strand[iS]) {
+      continue
+    }
     gr := r.Ranges[iQ].Intersection(s.Ranges[iS])
-    seqnames[i] = r.Seqnames[iQ]
-    strand  [i] = r.Strand  [iQ]
-    from    [i] = gr.From
-    to      [i] = gr.To
-    test    [i] = append(rTest[iQ], sTest[iS])
+    seqnames = append(seqnames, r.Seqnames[iQ])
+    strand   = append(strand,   mergeStrands(r.Strand[iQ], s.Strand[iS]))
+    from     = append(from,     gr.From)
+    to       = append(to,       gr.To)
+    test     = append(test,     append(append([]float64{}, rTest[iQ]...), sTest[iS]))
   }
   result := NewGRanges(seqnames, from, to, strand)
   result.AddMeta("test", test)
@@ -70,15 +75,47 @@ func intersectingPeaks(r, s GRanges) GRanges {
   return result
 }
 
-func GetPeaks(track Track, threshold float64, wsize int) GRanges {
+func strandsMatch(a, b byte) bool {
+  return a == '*' || b == '*' || a == b
+}
+
+func mergeStrands(a, b byte) byte {
+  if a == '*' {
+    return b
+  }
+  return a
+}
+
+// Clamp the range [from, to) to the bounds of a sequence.
+func clampRange(genome Genome, seqname string, from, to int) (int, int) {
+  if from < 0 {
+    from = 0
+  }
+  if length, err := genome.SeqLength(seqname); err == nil {
+    if to > length {
+      to = length
+    }
+    if from > length {
+      from = length
+    }
+  }
+  if to < from {
+    to = from
+  }
+  return from, to
+}
+
+func getPeaks(track Track, threshold float64, wsize int, s byte) GRanges {
   seqnames := []string{}
   from     := []int{}
   to       := []int{}
   strand   := []byte{}
   test     := []float64{}
 
-  offset1 := DivIntUp  (wsize-1, 2)
-  offset2 := DivIntDown(wsize-1, 2)
+  offset1, offset2 := WindowOffsets(wsize, WindowAnchorCenter)
+
+  binSize := track.GetBinSize()
+  genome  := track.GetGenome()
 
   for _, name := range track.GetSeqNames() {
     sequence, err := track.GetSequence(name); if err != nil {
@@ -102,27 +139,19 @@ func GetPeaks(track Track, threshold float64, wsize int) GRanges {
           }
           i += 1
         }
-        seqnames = append(seqnames, name)
-        test     = append(test, sequence.AtBin(i_max))
+        var tFrom, tTo int
         if wsize > 0 {
           // cut a window around the maximum
-          tFrom := i_max*track.GetBinSize()-offset1
-          tTo   := i_max*track.GetBinSize()+offset2+1
-          if tFrom < 0 {
-            tFrom = 0
-          }
-          if tTo > sequence.NBins()*track.GetBinSize() {
-            tTo = sequence.NBins()*track.GetBinSize()
-          }
-          from = append(from, tFrom)
-          to   = append(to,   tTo)
+          tFrom, tTo = clampRange(genome, name, i_max*binSize-offset1, i_max*binSize+offset2+1)
         } else {
-          // save full peak
-          tFrom := i_from*track.GetBinSize()-offset1
-          tTo   := i     *track.GetBinSize()+offset2+1
-          from = append(from, tFrom)
-          to   = append(to,   tTo)
+          // save full peak, padded by the window offsets
+          tFrom, tTo = clampRange(genome, name, i_from*binSize-offset1, i*binSize+offset2+1)
         }
+        seqnames = append(seqnames, name)
+        from     = append(from,     tFrom)
+        to       = append(to,       tTo)
+        strand   = append(strand,   s)
+        test     = append(test,     sequence.AtBin(i_max))
       }
     }
   }
@@ -133,9 +162,29 @@ func GetPeaks(track Track, threshold float64, wsize int) GRanges {
   return peaks
 }
 
-func GetJointPeaks(tracks []Track, thresholds []float64, wsize int) (GRanges, error) {
+func GetPeaks(track Track, threshold float64, wsize int) GRanges {
+  return getPeaks(track, threshold, wsize, '*')
+}
+
+// Call peaks on a pair of strand-specific tracks (e.g. plus and minus
+// bigWig files). Peaks are labeled with the strand of the track on which
+// they were found.
+func GetStrandedPeaks(plus, minus Track, threshold float64, wsize int) (GRanges, error) {
+  if plus.GetBinSize() != minus.GetBinSize() {
+    return GRanges{}, NewBinSizeError(plus.GetBinSize(), minus.GetBinSize(), "plus and minus strand tracks have different bin sizes (`%d' and `%d')", plus.GetBinSize(), minus.GetBinSize())
+  }
+  if !plus.GetGenome().Equals(minus.GetGenome()) {
+    return GRanges{}, fmt.Errorf("plus and minus strand tracks have different genomes")
+  }
+  peaks := getPeaks(plus, threshold, wsize, '+')
+  peaks  = peaks.Append(getPeaks(minus, threshold, wsize, '-'))
+  peaks, _ = peaks.Sort("test", true)
+  return peaks, nil
+}
+
+func getJointPeaks(tracks []Track, thresholds []float64, wsize int, s byte) (GRanges, error) {
   if len(tracks) != len(thresholds) {
-    return GRanges{}, fmt.Errorf("GetJointPeaks(): invalid arguments")
+    return GRanges{}, NewDimensionError(len(tracks), len(thresholds), "GetJointPeaks(): number of tracks and thresholds do not match")
   }
   if len(tracks) == 0 {
     return GRanges{}, nil
@@ -146,36 +195,18 @@ func GetJointPeaks(tracks []Track, thresholds []float64, wsize int) (GRanges, er
   strand   := []byte{}
   test     := [][]float64{}
 
-  offset1 := DivIntUp  (wsize-1, 2)
-  offset2 := DivIntDown(wsize-1, 2)
+  offset1, offset2 := WindowOffsets(wsize, WindowAnchorCenter)
 
   binsize := tracks[0].GetBinSize()
-  // assert that all tracks have the same binsize
-  for j := 1; j < len(tracks); j++ {
-    if binsize != tracks[j].GetBinSize() {
-      return GRanges{}, fmt.Errorf("tracks `1' and `%d' have different bin sizes (`%d' and `%d')", j+1, binsize, tracks[j].GetBinSize())
-    }
+  genome  := tracks[0].GetGenome()
+
+  it, err := NewMultiTrackWindowIterator(Float64Type, tracks, DefaultWindowParameters(1)); if err != nil {
+    return GRanges{}, err
   }
-  for _, name := range tracks[0].GetSeqNames() {
-    s, err := tracks[0].GetSequence(name); if err != nil {
-      return GRanges{}, err
-    }
-    sequences := []TrackSequence{s}
-    seqlen    := s.NBins()
-    // check remaining track for consistency
-    for j := 1; j < len(tracks); j++ {
-      if binsize != tracks[j].GetBinSize() {
-        return GRanges{}, fmt.Errorf("tracks `1' and `%d' have different bin sizes (`%d' and `%d')", j+1, binsize, tracks[j].GetBinSize())
-      }
-      if sequence, err := tracks[j].GetSequence(name); err != nil {
-        return GRanges{}, fmt.Errorf("reading sequence from track `%d' failed: %v", j+1, err)
-      } else {
-        if sequence.NBins() != seqlen {
-          return GRanges{}, fmt.Errorf("sequence `%s' on track `1' and `%d' have different lengths (`%d' and `%d')", name, j+1, seqlen, sequence.NBins())
-        }
-        sequences = append(sequences, sequence)
-      }
-    }
+  for it.NextSequence() {
+    name      := it.Sequence().Seqname
+    sequences := it.Sequence().Sequences
+    seqlen    := it.Sequence().NBins()
     for i := 0; i < seqlen; i++ {
       if allPositive(sequences, thresholds, i) {
         // peak begins here
@@ -200,28 +231,23 @@ func GetJointPeaks(tracks []Track, thresholds []float64, wsize int) (GRanges, er
         }
         test     = append(test, tmp)
         seqnames = append(seqnames, name)
+        strand   = append(strand,   s)
+        var tFrom, tTo int
         if wsize > 0 {
           // cut a window around the maximum
-          tFrom := i_max*binsize-offset1
-          tTo   := i_max*binsize+offset2+1
-          if tFrom < 0 {
-            tFrom = 0
-          }
-          if tTo > seqlen*binsize {
-            tTo = seqlen*binsize
-          }
-          from = append(from, tFrom)
-          to   = append(to,   tTo)
+          tFrom, tTo = clampRange(genome, name, i_max*binsize-offset1, i_max*binsize+offset2+1)
         } else {
-          // save full peak
-          tFrom := i_from*binsize-offset1
-          tTo   := i     *binsize+offset2+1
-          from = append(from, tFrom)
-          to   = append(to,   tTo)
+          // save full peak, padded by the window offsets
+          tFrom, tTo = clampRange(genome, name, i_from*binsize-offset1, i*binsize+offset2+1)
         }
+        from = append(from, tFrom)
+        to   = append(to,   tTo)
       }
     }
   }
+  if err := it.Err(); err != nil {
+    return GRanges{}, err
+  }
   peaks := NewGRanges(seqnames, from, to, strand)
   peaks.AddMeta("test", test)
   // sum up test results for sorting rows
@@ -238,16 +264,35 @@ func GetJointPeaks(tracks []Track, thresholds []float64, wsize int) (GRanges, er
   return peaks, nil
 }
 
-func GetIntersectingPeaks(tracks []Track, thresholds []float64, wsize int) (GRanges, error) {
+func GetJointPeaks(tracks []Track, thresholds []float64, wsize int) (GRanges, error) {
+  return getJointPeaks(tracks, thresholds, wsize, '*')
+}
+
+// Same as GetJointPeaks for strand-specific tracks. The i-th plus and
+// minus strand tracks belong to the same sample.
+func GetStrandedJointPeaks(plus, minus []Track, thresholds []float64, wsize int) (GRanges, error) {
+  if err := checkStrandedTracks("GetStrandedJointPeaks", plus, minus); err != nil {
+    return GRanges{}, err
+  }
+  peaksPlus, err := getJointPeaks(plus, thresholds, wsize, '+'); if err != nil {
+    return GRanges{}, err
+  }
+  peaksMinus, err := getJointPeaks(minus, thresholds, wsize, '-'); if err != nil {
+    return GRanges{}, err
+  }
+  return sortPeaks(peaksPlus.Append(peaksMinus)), nil
+}
+
+func getIntersectingPeaks(tracks []Track, thresholds []float64, wsize int, strand byte) (GRanges, error) {
   var peaks GRanges
 
   if len(tracks) != len(thresholds) {
-    return peaks, fmt.Errorf("GetPredictions(): invalid arguments")
+    return peaks, NewDimensionError(len(tracks), len(thresholds), "GetPredictions(): number of tracks and thresholds do not match")
   }
   if len(tracks) == 0 {
     return peaks, nil
   }
-  peaks = GetPeaks(tracks[0], thresholds[0], wsize)
+  peaks = getPeaks(tracks[0], thresholds[0], wsize, strand)
   // convert test from []float64 to [][]float64
   {
     aTest := peaks.GetMeta("test").([]float64)
@@ -259,23 +304,54 @@ func GetIntersectingPeaks(tracks []Track, thresholds []float64, wsize int) (GRan
     peaks.AddMeta("test", bTest)
   }
   for i := 1; i < len(tracks); i++ {
-    tmp  := GetPeaks(tracks[i], thresholds[i], wsize)
+    tmp  := getPeaks(tracks[i], thresholds[i], wsize, strand)
     peaks = intersectingPeaks(peaks, tmp)
   }
   // if window size is given, resize all peaks to wsize
   if wsize > 0 {
-    offset1 := DivIntUp  (wsize-1, 2)
-    offset2 := DivIntDown(wsize-1, 2)
+    offset1, offset2 := WindowOffsets(wsize, WindowAnchorCenter)
+
+    genome  := tracks[0].GetGenome()
 
     for i := 0; i < peaks.Length(); i++ {
       center := (peaks.Ranges[i].From + peaks.Ranges[i].To - 1)/2
-      peaks.Ranges[i].From = center-offset1
-      peaks.Ranges[i].To   = center+offset2+1
+      peaks.Ranges[i].From, peaks.Ranges[i].To = clampRange(genome, peaks.Seqnames[i], center-offset1, center+offset2+1)
     }
   }
   return sortPeaks(peaks), nil
 }
 
+func checkStrandedTracks(fname string, plus, minus []Track) error {
+  if len(plus) != len(minus) {
+    return NewDimensionError(len(plus), len(minus), "%s(): number of plus and minus strand tracks do not match", fname)
+  }
+  for i := 0; i < len(plus); i++ {
+    if !plus[i].GetGenome().Equals(minus[i].GetGenome()) {
+      return fmt.Errorf("%s(): plus and minus strand tracks `%d' have different genomes", fname, i+1)
+    }
+  }
+  return nil
+}
+
+func GetIntersectingPeaks(tracks []Track, thresholds []float64, wsize int) (GRanges, error) {
+  return getIntersectingPeaks(tracks, thresholds, wsize, '*')
+}
+
+// Same as GetIntersectingPeaks for strand-specific tracks. The i-th plus
+// and minus strand tracks belong to the same sample.
+func GetStrandedIntersectingPeaks(plus, minus []Track, thresholds []float64, wsize int) (GRanges, error) {
+  if err := checkStrandedTracks("GetStrandedIntersectingPeaks", plus, minus); err != nil {
+    return GRanges{}, err
+  }
+  peaksPlus, err := getIntersectingPeaks(plus, thresholds, wsize, '+'); if err != nil {
+    return GRanges{}, err
+  }
+  peaksMinus, err := getIntersectingPeaks(minus, thresholds, wsize, '-'); if err != nil {
+    return GRanges{}, err
+  }
+  return sortPeaks(peaksPlus.Append(peaksMinus)), nil
+}
+
 /* old implementation
  * -------------------------------------------------------------------------- */
 
@@ -283,7 +359,13 @@ func filterOverlaps(granges GRanges) GRanges {
 
   queryHits, subjectHits := FindOverlaps(granges, granges)
 
-  test := granges.GetMetaFloat("test")
+  // compare ranges by the sum of test results
+  test := make([]float64, granges.Length())
+  for i, x := range granges.GetMeta("test").([][]float64) {
+    for j := 0; j < len(x); j++ {
+      test[i] += x[j]
+    }
+  }
   idx  := []int{}
 
   for i := 0; i < len(queryHits); i++ {
@@ -317,10 +399,10 @@ func allSum(sequences []TrackSequence, i int) float64 {
   return sum
 }
 
-func GetPredictions(tracks []Track, thresholds []float64, wsize int) (GRanges, error) {
+func getPredictions(tracks []Track, thresholds []float64, wsize int, s byte) (GRanges, error) {
 
   if len(tracks) != len(thresholds) {
-    return GRanges{}, fmt.Errorf("GetPredictions(): invalid arguments")
+    return GRanges{}, NewDimensionError(len(tracks), len(thresholds), "GetPredictions(): number of tracks and thresholds do not match")
   }
   if len(tracks) == 0 {
     return GRanges{}, nil
@@ -331,48 +413,32 @@ func GetPredictions(tracks []Track, thresholds []float64, wsize int) (GRanges, e
   strand   := []byte{}
   test     := [][]float64{}
 
-  offset1 := DivIntUp  (wsize-1, 2)
-  offset2 := DivIntDown(wsize-1, 2)
+  offset1, offset2 := WindowOffsets(wsize, WindowAnchorCenter)
 
-  for _, name := range tracks[0].GetSeqNames() {
-    s, err := tracks[0].GetSequence(name); if err != nil {
-      return GRanges{}, err
-    }
-    sequences := []TrackSequence{}
-    seqlen    := s.NBins()
-    for j := 0; j < len(tracks); j++ {
-      if tracks[0].GetBinSize() != tracks[j].GetBinSize() {
-        return GRanges{}, fmt.Errorf("tracks `1' and `%d' have different bin sizes (`%d' and `%d')", j+1, tracks[0].GetBinSize(), tracks[j].GetBinSize())
-      }
-      if sequence, err := tracks[j].GetSequence(name); err != nil {
-        return GRanges{}, fmt.Errorf("reading sequence from track `%d' failed: %v", j+1, err)
-      } else {
-        if sequence.NBins() != seqlen {
-          return GRanges{}, fmt.Errorf("sequence `%s' on track `1' and `%d' have different lengths (`%d' and `%d')", name, j+1, seqlen, sequence.NBins())
-        }
-        sequences = append(sequences, sequence)
-      }
-    }
+  it, err := NewMultiTrackWindowIterator(Float64Type, tracks, DefaultWindowParameters(1)); if err != nil {
+    return GRanges{}, err
+  }
+  for it.NextSequence() {
+    name      := it.Sequence().Seqname
+    sequences := it.Sequence().Sequences
+    seqlen    := it.Sequence().NBins()
     for i := 0; i < seqlen; i++ {
       if allPositive(sequences, thresholds, i) {
-        tFrom := i*tracks[0].GetBinSize()-offset1
-        tTo   := i*tracks[0].GetBinSize()+offset2+1
-        if tFrom < 0 {
-          tFrom = 0
-        }
-        if tTo > seqlen*tracks[0].GetBinSize() {
-          tTo = seqlen*tracks[0].GetBinSize()
-        }
+        tFrom, tTo := clampRange(tracks[0].GetGenome(), name, i*tracks[0].GetBinSize()-offset1, i*tracks[0].GetBinSize()+offset2+1)
         seqnames = append(seqnames, name)
-        from     = append(from, tFrom)
-        to       = append(to,   tTo)
-        test     = append(test, []float64{})
+        from     = append(from,   tFrom)
+        to       = append(to,     tTo)
+        strand   = append(strand, s)
+        test     = append(test,   []float64{})
         for j, n := 0, len(test)-1; j < len(sequences); j++ {
           test[n] = append(test[n], sequences[j].AtBin(i))
         }
       }
     }
   }
+  if err := it.Err(); err != nil {
+    return GRanges{}, err
+  }
   granges := NewGRanges(seqnames, from, to, strand)
   granges.AddMeta("test", test)
   granges  = filterOverlaps(granges)
@@ -389,3 +455,22 @@ func GetPredictions(tracks []Track, thresholds []float64, wsize int) (GRanges, e
 
   return granges, nil
 }
+
+func GetPredictions(tracks []Track, thresholds []float64, wsize int) (GRanges, error) {
+  return getPredictions(tracks, thresholds, wsize, '*')
+}
+
+// Same as GetPredictions for strand-specific tracks. The i-th plus and
+// minus strand tracks belong to the same sample.
+func GetStrandedPredictions(plus, minus []Track, thresholds []float64, wsize int) (GRanges, error) {
+  if err := checkStrandedTracks("GetStrandedPredictions", plus, minus); err != nil {
+    return GRanges{}, err
+  }
+  predictionsPlus, err := getPredictions(plus, thresholds, wsize, '+'); if err != nil {
+    return GRanges{}, err
+  }
+  predictionsMinus, err := getPredictions(minus, thresholds, wsize, '-'); if err != nil {
+    return GRanges{}, err
+  }
+  return sortPeaks(predictionsPlus.Append(predictionsMinus)), nil
+}
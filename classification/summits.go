@@ -0,0 +1,273 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package classification
+
+/* -------------------------------------------------------------------------- */
+
+import   "math"
+
+import . "github.com/pbenner/ngstat/track"
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+type SummitParameters struct {
+  // minimum height of a summit above the higher of its two bases
+  MinProminence  float64
+  // minimum depth of the valley between two neighboring summits relative
+  // to the height of the lower summit above the minimum of the region
+  // (between 0 and 1), which also applies to tracks with negative values
+  // such as log posteriors
+  MinValleyDepth float64
+  // size (in bins) of a moving average applied to the track before
+  // summits are detected (values < 2 disable smoothing)
+  Smoothing      int
+  // report each summit as a separate peak; peak boundaries are set to
+  // the valleys between neighboring summits
+  Split          bool
+}
+
+func DefaultSummitParameters() SummitParameters {
+  return SummitParameters{
+    MinProminence : 0.0,
+    MinValleyDepth: 0.0,
+    Smoothing     : 0,
+    Split         : false }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Compute a centered moving average over k bins, ignoring NaN values.
+func smoothSequence(x []float64, k int) []float64 {
+  if k < 2 {
+    return x
+  }
+  offset1 := DivIntUp  (k-1, 2)
+  offset2 := DivIntDown(k-1, 2)
+  r := make([]float64, len(x))
+  for i := 0; i < len(x); i++ {
+    sum := 0.0
+    n   := 0
+    for j := MaxInt(i-offset1, 0); j <= MinInt(i+offset2, len(x)-1); j++ {
+      if !math.IsNaN(x[j]) {
+        sum += x[j]; n++
+      }
+    }
+    if n == 0 || math.IsNaN(x[i]) {
+      r[i] = math.NaN()
+    } else {
+      r[i] = sum/float64(n)
+    }
+  }
+  return r
+}
+
+// Find summits in x[from:to]. Returns the positions of all summits that
+// pass the prominence and valley depth criteria. The global maximum is
+// always reported.
+func findSummits(x []float64, from, to int, parameters SummitParameters) []int {
+  // find local maxima, for plateaus take the first position
+  maxima := []int{}
+  for i := from; i < to; {
+    j := i
+    for j+1 < to && x[j+1] == x[i] {
+      j++
+    }
+    left  := i == from || x[i-1] < x[i]
+    right := j == to-1 || x[j+1] < x[i]
+    if left && right {
+      maxima = append(maxima, i)
+    }
+    i = j+1
+  }
+  // global maximum
+  iMax := maxima[0]
+  for _, i := range maxima {
+    if x[i] > x[iMax] {
+      iMax = i
+    }
+  }
+  // filter by prominence
+  summits := []int{}
+  for _, p := range maxima {
+    if p == iMax {
+      summits = append(summits, p); continue
+    }
+    // minimum between p and the next higher position (or the border)
+    lMin := x[p]
+    for i := p-1; i >= from && x[i] <= x[p]; i-- {
+      lMin = math.Min(lMin, x[i])
+    }
+    rMin := x[p]
+    for i := p+1; i < to && x[i] <= x[p]; i++ {
+      rMin = math.Min(rMin, x[i])
+    }
+    if x[p] - math.Max(lMin, rMin) >= parameters.MinProminence {
+      summits = append(summits, p)
+    }
+  }
+  // minimum of the region
+  xMin := x[from]
+  for i := from; i < to; i++ {
+    xMin = math.Min(xMin, x[i])
+  }
+  // filter by valley depth; drop the lower of two neighboring summits
+  // until all valleys are deep enough
+  for parameters.MinValleyDepth > 0.0 && len(summits) > 1 {
+    k := -1
+    for i := 1; i < len(summits); i++ {
+      v := x[valley(x, summits[i-1], summits[i])]
+      m := math.Min(x[summits[i-1]], x[summits[i]])
+      if m <= xMin || (m - v)/(m - xMin) < parameters.MinValleyDepth {
+        if x[summits[i-1]] < x[summits[i]] {
+          k = i-1
+        } else {
+          k = i
+        }
+        break
+      }
+    }
+    if k == -1 {
+      break
+    }
+    summits = append(summits[0:k], summits[k+1:]...)
+  }
+  return summits
+}
+
+// Position of the minimum between i and j.
+func valley(x []float64, i, j int) int {
+  k := i
+  for l := i; l <= j; l++ {
+    if x[l] < x[k] {
+      k = l
+    }
+  }
+  return k
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Call peaks on a track where broad regions may contain several summits.
+// Regions above threshold are detected as in GetPeaks, summits within each
+// region are determined using the given parameters. If parameters.Split is
+// true, each summit is reported as a separate peak, otherwise a single
+// peak is reported per region. The result has the following meta columns:
+//   test    - track value at the (highest) summit
+//   summit  - position of the (highest) summit
+//   summits - positions of all summits within the peak
+// If wsize > 0, a window of size wsize is cut around each summit.
+func GetSummitPeaks(track Track, threshold float64, wsize int, parameters SummitParameters) (GRanges, error) {
+  if parameters.MinValleyDepth < 0.0 || parameters.MinValleyDepth > 1.0 {
+    return GRanges{}, NewArgumentError("invalid valley depth `%f'", parameters.MinValleyDepth)
+  }
+  if parameters.MinProminence < 0.0 {
+    return GRanges{}, NewArgumentError("invalid prominence `%f'", parameters.MinProminence)
+  }
+  seqnames := []string{}
+  from     := []int{}
+  to       := []int{}
+  test     := []float64{}
+  summit   := []int{}
+  summits  := [][]int{}
+
+  binSize := track.GetBinSize()
+
+  offset1, offset2 := WindowOffsets(wsize, WindowAnchorCenter)
+
+  for _, name := range track.GetSeqNames() {
+    sequence, err := track.GetSequence(name); if err != nil {
+      continue
+    }
+    nbins := sequence.NBins()
+    x     := make([]float64, nbins)
+    for i := 0; i < nbins; i++ {
+      x[i] = sequence.AtBin(i)
+    }
+    y := smoothSequence(x, parameters.Smoothing)
+    // convert bin to genomic position
+    pos := func(i int) int {
+      return i*binSize
+    }
+    window := func(i int) (int, int) {
+      return clampRange(track.GetGenome(), name, pos(i)-offset1, pos(i)+offset2+1)
+    }
+    for i := 0; i < nbins; i++ {
+      if !(x[i] > threshold) {
+        continue
+      }
+      // peak begins here
+      i_from := i
+      for i < nbins && x[i] > threshold {
+        i++
+      }
+      s := findSummits(y, i_from, i, parameters)
+      if parameters.Split {
+        for k, p := range s {
+          tFrom, tTo := pos(i_from), pos(i)
+          if k > 0 {
+            tFrom = pos(valley(y, s[k-1], p))
+          }
+          if k < len(s)-1 {
+            tTo   = pos(valley(y, p, s[k+1]))
+          }
+          if wsize > 0 {
+            tFrom, tTo = window(p)
+          } else {
+            tFrom, tTo = clampRange(track.GetGenome(), name, tFrom, tTo)
+          }
+          seqnames = append(seqnames, name)
+          from     = append(from,     tFrom)
+          to       = append(to,       tTo)
+          test     = append(test,     x[p])
+          summit   = append(summit,   pos(p))
+          summits  = append(summits,  []int{pos(p)})
+        }
+      } else {
+        p := s[0]
+        r := make([]int, len(s))
+        for k, q := range s {
+          if x[q] > x[p] {
+            p = q
+          }
+          r[k] = pos(q)
+        }
+        tFrom, tTo := pos(i_from), pos(i)
+        if wsize > 0 {
+          tFrom, tTo = window(p)
+        } else {
+          tFrom, tTo = clampRange(track.GetGenome(), name, tFrom, tTo)
+        }
+        seqnames = append(seqnames, name)
+        from     = append(from,     tFrom)
+        to       = append(to,       tTo)
+        test     = append(test,     x[p])
+        summit   = append(summit,   pos(p))
+        summits  = append(summits,  r)
+      }
+    }
+  }
+  peaks := NewGRanges(seqnames, from, to, nil)
+  peaks.AddMeta("test",    test)
+  peaks.AddMeta("summit",  summit)
+  peaks.AddMeta("summits", summits)
+  peaks, _ = peaks.Sort("test", true)
+
+  return peaks, nil
+}
@@ -21,6 +21,7 @@ package config
 import   "fmt"
 import   "bytes"
 import   "io"
+import   "strings"
 
 import . "github.com/pbenner/autodiff"
 import . "github.com/pbenner/gonetics"
@@ -35,10 +36,19 @@ type SessionConfig struct {
   BinSize                int     `json:"Bin Size"`
   BinOverlap             int     `json:"Bin Overlap"`
   TrackInit              float64 `json:"Track Initial Value"`
+  LogFormat              string  `json:"Log Format"`
+  // source of each value (indexed by json keys)
+  Sources                map[string]string `json:"-"`
+  // key/value pairs added to all log records (i.e. the current pipeline
+  // step or chromosome)
+  LogFields            []interface{}       `json:"-"`
 }
 
 func (config *SessionConfig) Import(reader io.Reader, args... interface{}) error {
-  return JsonImport(reader, config)
+  if err := JsonImportStrict(reader, config); err != nil {
+    return err
+  }
+  return config.Validate()
 }
 
 func (config *SessionConfig) Export(writer io.Writer) error {
@@ -63,11 +73,86 @@ func DefaultSessionConfig() SessionConfig {
   config.BinOverlap           = 0
   config.TrackInit            = 0
   config.Threads              = 1
+  config.LogFormat            = "text"
   return config
 }
 
 /* -------------------------------------------------------------------------- */
 
+// Return the source of a config value, where key is the json key of the
+// field (i.e. "Bin Size").
+func (config *SessionConfig) Source(key string) string {
+  if source, ok := config.Sources[key]; ok {
+    return source
+  }
+  return "default"
+}
+
+// Set the source of a config value. The map is copied, since it may be
+// shared with other copies of the config.
+func (config *SessionConfig) setSource(key, source string) {
+  sources := make(map[string]string)
+  for k, v := range config.Sources {
+    sources[k] = v
+  }
+  sources[key] = source
+  config.Sources = sources
+}
+
+// Return a copy of the config with additional key/value pairs that are
+// added to all log records.
+func (config SessionConfig) WithLogFields(keyvals ...interface{}) SessionConfig {
+  fields := make([]interface{}, 0, len(config.LogFields)+len(keyvals))
+  fields  = append(fields, config.LogFields...)
+  fields  = append(fields, keyvals...)
+  config.LogFields = fields
+  return config
+}
+
+/* -------------------------------------------------------------------------- */
+
+type ConfigValueError struct {
+  Key     string
+  Message string
+}
+
+func (err ConfigValueError) Error() string {
+  return fmt.Sprintf("invalid value for `%s': %s", err.Key, err.Message)
+}
+
+// Check ranges of all config values.
+func (config *SessionConfig) Validate() error {
+  if config.Threads < 1 {
+    return ConfigValueError{"Threads", fmt.Sprintf("number of threads must be at least 1 (got %d)", config.Threads)}
+  }
+  if config.Verbose < 0 {
+    return ConfigValueError{"Verbose", fmt.Sprintf("verbose level must be non-negative (got %d)", config.Verbose)}
+  }
+  if _, err := config.GetBinSummaryStatistics(); err != nil {
+    return ConfigValueError{"Bin Summary Statistics", fmt.Sprintf("`%s' is not one of %s", config.BinSummaryStatistics, strings.Join(BinSummaryStatisticsNames, ", "))}
+  }
+  for _, level := range config.BWZoomLevels {
+    if level < 1 {
+      return ConfigValueError{"BigWig Zoom Levels", fmt.Sprintf("zoom levels must be positive (got %d)", level)}
+    }
+  }
+  if config.BinSize < 0 {
+    return ConfigValueError{"Bin Size", fmt.Sprintf("bin size must be non-negative (got %d)", config.BinSize)}
+  }
+  if config.BinOverlap < 0 {
+    return ConfigValueError{"Bin Overlap", fmt.Sprintf("bin overlap must be non-negative (got %d)", config.BinOverlap)}
+  }
+  if !isLogFormat(config.LogFormat) {
+    return ConfigValueError{"Log Format", fmt.Sprintf("`%s' is not one of %s", config.LogFormat, strings.Join(LogFormatNames, ", "))}
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Valid names of bin summary statistics.
+var BinSummaryStatisticsNames = []string{"mean", "max", "min", "discrete mean", "discrete max", "discrete min", "variance"}
+
 func (config *SessionConfig) GetBinSummaryStatistics() (BinSummaryStatistics, error) {
   if s := BinSummaryStatisticsFromString(config.BinSummaryStatistics); s == nil {
     return nil, fmt.Errorf("invalid bin summary statistics: %s", config.BinSummaryStatistics)
@@ -76,19 +161,32 @@ func (config *SessionConfig) GetBinSummaryStatistics() (BinSummaryStatistics, er
   }
 }
 
+// Valid names of log formats.
+var LogFormatNames = []string{"text", "json"}
+
+func isLogFormat(format string) bool {
+  for _, name := range LogFormatNames {
+    if name == format {
+      return true
+    }
+  }
+  return false
+}
+
 /* -------------------------------------------------------------------------- */
 
 func (config *SessionConfig) String() string {
   var buffer bytes.Buffer
 
   fmt.Fprintf(&buffer, "Session Config:\n")
-  fmt.Fprintf(&buffer, " -> Bin Overlap            : %v\n", config.BinOverlap)
-  fmt.Fprintf(&buffer, " -> Bin Summary Statistics : %v\n", config.BinSummaryStatistics)
-  fmt.Fprintf(&buffer, " -> Bin Size               : %v\n", config.BinSize)
-  fmt.Fprintf(&buffer, " -> BigWig Zoom Levels     : %v\n", config.BWZoomLevels)
-  fmt.Fprintf(&buffer, " -> Track Initial Value    : %v\n", config.TrackInit)
-  fmt.Fprintf(&buffer, " -> Threads                : %v\n", config.Threads)
-  fmt.Fprintf(&buffer, " -> Verbose                : %v\n", config.Verbose)
+  fmt.Fprintf(&buffer, " -> Bin Overlap            : %-10v [%s]\n", config.BinOverlap,           config.Source("Bin Overlap"))
+  fmt.Fprintf(&buffer, " -> Bin Summary Statistics : %-10v [%s]\n", config.BinSummaryStatistics, config.Source("Bin Summary Statistics"))
+  fmt.Fprintf(&buffer, " -> Bin Size               : %-10v [%s]\n", config.BinSize,              config.Source("Bin Size"))
+  fmt.Fprintf(&buffer, " -> BigWig Zoom Levels     : %-10s [%s]\n", fmt.Sprint(config.BWZoomLevels), config.Source("BigWig Zoom Levels"))
+  fmt.Fprintf(&buffer, " -> Track Initial Value    : %-10v [%s]\n", config.TrackInit,            config.Source("Track Initial Value"))
+  fmt.Fprintf(&buffer, " -> Threads                : %-10v [%s]\n", config.Threads,              config.Source("Threads"))
+  fmt.Fprintf(&buffer, " -> Verbose                : %-10v [%s]\n", config.Verbose,              config.Source("Verbose"))
+  fmt.Fprintf(&buffer, " -> Log Format             : %-10v [%s]\n", config.LogFormat,            config.Source("Log Format"))
 
   return buffer.String()
 }
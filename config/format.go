@@ -0,0 +1,446 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package config
+
+/* -------------------------------------------------------------------------- */
+
+import   "bytes"
+import   "encoding/json"
+import   "errors"
+import   "fmt"
+import   "io"
+import   "io/ioutil"
+import   "path/filepath"
+import   "regexp"
+import   "sort"
+import   "strings"
+
+import   "github.com/BurntSushi/toml"
+import   "gopkg.in/yaml.v3"
+
+import . "github.com/pbenner/ngstat/utility"
+
+/* -------------------------------------------------------------------------- */
+
+// Serializable objects are stored as json. YAML and TOML files are converted
+// to json before importing, so that the same strict checks apply to all
+// formats. Keys of the top-level object are placed at the same column and
+// one line below their position in the original file (the first line holds
+// the opening brace), which allows to report positions of unknown keys and
+// invalid values with respect to the original file.
+
+const (
+  FormatJson = "json"
+  FormatYaml = "yaml"
+  FormatToml = "toml"
+)
+
+// Determine the file format from the file extension. Files without a known
+// extension are assumed to be json files.
+func FileFormat(filename string) string {
+  switch strings.ToLower(filepath.Ext(filename)) {
+  case ".yaml", ".yml":
+    return FormatYaml
+  case ".toml":
+    return FormatToml
+  default:
+    return FormatJson
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+type documentKey struct {
+  Key    string
+  Value  interface{}
+  Line   int
+  Column int
+}
+
+var documentPositionPrefix = regexp.MustCompile(`^line (\d+), column (\d+): `)
+
+// Translate positions in errors of converted documents back to positions
+// in the original file. Only positions of FormatErrors are translated, all
+// other errors are returned unchanged.
+func documentError(err error) error {
+  var e FormatError
+  if errors.As(err, &e) && e.Line > 0 {
+    if e.Line > 1 {
+      e.Line--
+    }
+    return e
+  }
+  return err
+}
+
+// Convert an error of a document into a FormatError. If the error does not
+// carry a position, it is parsed from the error message if possible.
+func newFormatError(filename string, err error) error {
+  if err == nil {
+    return nil
+  }
+  var e FormatError
+  if errors.As(err, &e) {
+    if e.Filename == "" {
+      e.Filename = filename
+    }
+    return e
+  }
+  if m := documentPositionPrefix.FindStringSubmatch(err.Error()); m != nil {
+    e := FormatError{Filename: filename}
+    fmt.Sscanf(m[1], "%d", &e.Line)
+    fmt.Sscanf(m[2], "%d", &e.Column)
+    e.Err = errors.New(strings.TrimPrefix(err.Error(), m[0]))
+    return e
+  }
+  return FormatError{Filename: filename, Err: err}
+}
+
+// Convert values to types supported by the json encoder, i.e. yaml maps with
+// non-string keys.
+func documentValue(value interface{}) interface{} {
+  switch v := value.(type) {
+  case map[string]interface{}:
+    r := make(map[string]interface{})
+    for key, x := range v {
+      r[key] = documentValue(x)
+    }
+    return r
+  case map[interface{}]interface{}:
+    r := make(map[string]interface{})
+    for key, x := range v {
+      r[fmt.Sprint(key)] = documentValue(x)
+    }
+    return r
+  case []interface{}:
+    r := make([]interface{}, len(v))
+    for i, x := range v {
+      r[i] = documentValue(x)
+    }
+    return r
+  default:
+    return value
+  }
+}
+
+// Create a json object from a list of keys, where each key is placed one
+// line below its original line and at its original column if possible.
+func documentJson(keys []documentKey) ([]byte, error) {
+  var buffer bytes.Buffer
+  line   := 0
+  column := 1
+  write  := func(b []byte) {
+    buffer.Write(b)
+    column += len(b)
+  }
+  write([]byte("{"))
+  for i, k := range keys {
+    if i > 0 {
+      write([]byte(","))
+    }
+    key,   err := json.Marshal(k.Key); if err != nil {
+      return nil, err
+    }
+    value, err := json.Marshal(documentValue(k.Value)); if err != nil {
+      return nil, FormatError{Line: k.Line, Column: k.Column, Err: fmt.Errorf("invalid value for `%s': %v", k.Key, err)}
+    }
+    if k.Line > line {
+      buffer.WriteString(strings.Repeat("\n", k.Line-line))
+      line   = k.Line
+      column = 1
+    }
+    if k.Line == line && k.Column > column {
+      write([]byte(strings.Repeat(" ", k.Column-column)))
+    }
+    write(key)
+    write([]byte(":"))
+    write(value)
+  }
+  write([]byte("}"))
+  return buffer.Bytes(), nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Convert yaml data to json. Anchors, aliases and merge keys are resolved.
+// Top-level keys starting with a dot are dropped, so that they can be used
+// to define anchors, i.e.
+//   .defaults: &defaults
+//     Threads: 4
+// Multiple documents are merged, where keys of later documents override
+// keys of earlier documents.
+func yamlToJson(data []byte) ([]byte, error) {
+  decoder := yaml.NewDecoder(bytes.NewReader(data))
+  keys    := []documentKey{}
+  index   := make(map[string]int)
+  removed := []bool{}
+  for n := 0; ; n++ {
+    var node yaml.Node
+    if err := decoder.Decode(&node); err != nil {
+      if err == io.EOF {
+        break
+      }
+      return nil, err
+    }
+    if len(node.Content) == 0 {
+      continue
+    }
+    root := node.Content[0]
+    if root.Kind != yaml.MappingNode {
+      // a single document which is not an object
+      if n == 0 {
+        var value interface{}
+        if err := root.Decode(&value); err != nil {
+          return nil, err
+        }
+        if more := decoder.Decode(&node); more == nil {
+          return nil, FormatError{Line: node.Line, Column: node.Column, Err: fmt.Errorf("multiple documents must contain objects")}
+        }
+        return json.Marshal(documentValue(value))
+      }
+      return nil, FormatError{Line: root.Line, Column: root.Column, Err: fmt.Errorf("multiple documents must contain objects")}
+    }
+    var values map[string]interface{}
+    if err := root.Decode(&values); err != nil {
+      return nil, err
+    }
+    // positions of keys, merged keys are placed at the position of the
+    // merge key
+    positions := make(map[string][2]int)
+    for i := 0; i+1 < len(root.Content); i += 2 {
+      k := root.Content[i]
+      if k.Value == "<<" {
+        for key := range values {
+          if _, ok := positions[key]; !ok {
+            positions[key] = [2]int{k.Line, k.Column}
+          }
+        }
+      } else {
+        positions[k.Value] = [2]int{k.Line, k.Column}
+      }
+    }
+    docKeys := []documentKey{}
+    for key, value := range values {
+      if strings.HasPrefix(key, ".") {
+        continue
+      }
+      p := positions[key]
+      docKeys = append(docKeys, documentKey{key, value, p[0], p[1]})
+    }
+    sort.SliceStable(docKeys, func(i, j int) bool {
+      if docKeys[i].Line != docKeys[j].Line {
+        return docKeys[i].Line < docKeys[j].Line
+      }
+      return docKeys[i].Column < docKeys[j].Column
+    })
+    for _, k := range docKeys {
+      if i, ok := index[k.Key]; ok {
+        removed[i] = true
+      }
+      index[k.Key] = len(keys)
+      keys    = append(keys,    k)
+      removed = append(removed, false)
+    }
+  }
+  // drop overridden keys
+  result := []documentKey{}
+  for i, k := range keys {
+    if !removed[i] {
+      result = append(result, k)
+    }
+  }
+  return documentJson(result)
+}
+
+/* -------------------------------------------------------------------------- */
+
+var tomlTableKey = regexp.MustCompile(`^\s*\[\[?\s*("[^"]*"|'[^']*'|[A-Za-z0-9_-]+)`)
+var tomlValueKey = regexp.MustCompile(`^\s*("[^"]*"|'[^']*'|[A-Za-z0-9_-]+)\s*[.=]`)
+
+// Find positions of top-level keys in toml data, which are either assigned
+// before the first table or define a table.
+func tomlKeyPositions(data []byte) map[string][2]int {
+  positions := make(map[string][2]int)
+  tables    := false
+  for i, line := range strings.Split(string(data), "\n") {
+    var m []int
+    if m = tomlTableKey.FindStringSubmatchIndex(line); m != nil {
+      tables = true
+    } else if !tables {
+      m = tomlValueKey.FindStringSubmatchIndex(line)
+    }
+    if m == nil {
+      continue
+    }
+    key := strings.Trim(line[m[2]:m[3]], `"'`)
+    if _, ok := positions[key]; !ok {
+      positions[key] = [2]int{i+1, m[2]+1}
+    }
+  }
+  return positions
+}
+
+// Convert toml data to json.
+func tomlToJson(data []byte) ([]byte, error) {
+  var values map[string]interface{}
+  if _, err := toml.Decode(string(data), &values); err != nil {
+    return nil, err
+  }
+  positions := tomlKeyPositions(data)
+  keys := []documentKey{}
+  for key, value := range values {
+    p := positions[key]
+    keys = append(keys, documentKey{key, value, p[0], p[1]})
+  }
+  sort.SliceStable(keys, func(i, j int) bool {
+    if keys[i].Line != keys[j].Line {
+      return keys[i].Line < keys[j].Line
+    }
+    if keys[i].Column != keys[j].Column {
+      return keys[i].Column < keys[j].Column
+    }
+    return keys[i].Key < keys[j].Key
+  })
+  return documentJson(keys)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Reset styles of a yaml node tree so that json input is written in block
+// style.
+func yamlResetStyle(node *yaml.Node) {
+  node.Style = 0
+  for _, n := range node.Content {
+    yamlResetStyle(n)
+  }
+}
+
+// Convert json data to yaml, the order of keys is preserved.
+func jsonToYaml(data []byte) ([]byte, error) {
+  var node yaml.Node
+  if err := yaml.Unmarshal(data, &node); err != nil {
+    return nil, err
+  }
+  yamlResetStyle(&node)
+  var buffer bytes.Buffer
+  encoder := yaml.NewEncoder(&buffer)
+  encoder.SetIndent(2)
+  if err := encoder.Encode(&node); err != nil {
+    return nil, err
+  }
+  if err := encoder.Close(); err != nil {
+    return nil, err
+  }
+  return buffer.Bytes(), nil
+}
+
+// Convert decoded json values to values supported by the toml encoder. Toml
+// has no null values, hence null values are dropped.
+func tomlValue(value interface{}) (interface{}, error) {
+  switch v := value.(type) {
+  case map[string]interface{}:
+    r := make(map[string]interface{})
+    for key, x := range v {
+      if x == nil {
+        continue
+      }
+      if y, err := tomlValue(x); err != nil {
+        return nil, err
+      } else {
+        r[key] = y
+      }
+    }
+    return r, nil
+  case []interface{}:
+    r := make([]interface{}, len(v))
+    for i, x := range v {
+      if x == nil {
+        return nil, fmt.Errorf("toml does not support null values in arrays")
+      }
+      if y, err := tomlValue(x); err != nil {
+        return nil, err
+      } else {
+        r[i] = y
+      }
+    }
+    return r, nil
+  case json.Number:
+    // keep integers as integers
+    if i, err := v.Int64(); err == nil {
+      return i, nil
+    }
+    return v.Float64()
+  default:
+    return value, nil
+  }
+}
+
+// Convert json data to toml. Keys are sorted by the toml encoder.
+func jsonToToml(data []byte) ([]byte, error) {
+  var value interface{}
+  decoder := json.NewDecoder(bytes.NewReader(data))
+  decoder.UseNumber()
+  if err := decoder.Decode(&value); err != nil {
+    return nil, err
+  }
+  if _, ok := value.(map[string]interface{}); !ok {
+    return nil, fmt.Errorf("toml requires an object at the top level")
+  }
+  value, err := tomlValue(value); if err != nil {
+    return nil, err
+  }
+  var buffer bytes.Buffer
+  if err := toml.NewEncoder(&buffer).Encode(value); err != nil {
+    return nil, err
+  }
+  return buffer.Bytes(), nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Read a json, yaml or toml file and return its content as json.
+func readJsonFile(filename string) ([]byte, error) {
+  data, err := ioutil.ReadFile(filename)
+  if err != nil {
+    return nil, err
+  }
+  switch FileFormat(filename) {
+  case FormatYaml:
+    data, err = yamlToJson(data)
+  case FormatToml:
+    data, err = tomlToJson(data)
+  }
+  if err != nil {
+    return nil, newFormatError(filename, err)
+  }
+  return data, nil
+}
+
+// Convert json data to the given format.
+func convertJson(data []byte, format string) ([]byte, error) {
+  switch format {
+  case FormatJson:
+    return data, nil
+  case FormatYaml:
+    return jsonToYaml(data)
+  case FormatToml:
+    return jsonToToml(data)
+  default:
+    return nil, fmt.Errorf("invalid format `%s'", format)
+  }
+}
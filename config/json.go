@@ -18,37 +18,206 @@ package config
 
 /* -------------------------------------------------------------------------- */
 
-//import   "fmt"
-import   "bufio"
 import   "bytes"
 import   "encoding/json"
+import   "fmt"
 import   "io"
+import   "io/ioutil"
+import   "reflect"
 import   "strings"
 
+import . "github.com/pbenner/ngstat/utility"
+
 /* -------------------------------------------------------------------------- */
 
-func stripComment(str []byte) []byte {
-	if cut := strings.IndexAny(string(str), "#"); cut >= 0 {
-		return str[:cut]
-	} else {
-    return str
+// Remove comments starting with `#' outside of strings. Comments are replaced
+// by spaces so that positions within the input remain valid.
+func stripComments(data []byte) []byte {
+  result   := make([]byte, len(data))
+  inString := false
+  escape   := false
+  comment  := false
+  for i, c := range data {
+    switch {
+    case comment:
+      if c == '\n' {
+        comment = false
+        result[i] = c
+      } else {
+        result[i] = ' '
+      }
+      continue
+    case inString && escape:
+      escape = false
+    case inString && c == '\\':
+      escape = true
+    case c == '"':
+      inString = !inString
+    case !inString && c == '#':
+      comment = true
+      result[i] = ' '
+      continue
+    }
+    result[i] = c
   }
+  return result
 }
 
-/* -------------------------------------------------------------------------- */
+// Convert an offset into line and column numbers (starting at 1).
+func jsonPosition(data []byte, offset int64) (int, int) {
+  if offset > int64(len(data)) {
+    offset = int64(len(data))
+  }
+  line   := 1 + bytes.Count(data[0:offset], []byte("\n"))
+  column := int(offset) - bytes.LastIndexByte(data[0:offset], '\n')
+  return line, column
+}
 
-func JsonImport(reader io.Reader, object interface{}) error {
+// Add line and column numbers to errors returned by the json decoder.
+func jsonError(data []byte, err error) error {
+  switch e := err.(type) {
+  case *json.SyntaxError:
+    line, column := jsonPosition(data, e.Offset)
+    return FormatError{Line: line, Column: column, Err: e}
+  case *json.UnmarshalTypeError:
+    line, column := jsonPosition(data, e.Offset)
+    if e.Field != "" {
+      return FormatError{Line: line, Column: column, Err: fmt.Errorf("invalid value for `%s' (expected %v)", e.Field, e.Type)}
+    }
+    return FormatError{Line: line, Column: column, Err: fmt.Errorf("invalid value (expected %v)", e.Type)}
+  }
+  return err
+}
+
+// Return keys of the top-level object together with their offsets.
+func jsonObjectKeys(data []byte) ([]string, []int64, error) {
+  decoder := json.NewDecoder(bytes.NewReader(data))
+  if t, err := decoder.Token(); err != nil {
+    return nil, nil, err
+  } else if d, ok := t.(json.Delim); !ok || d != '{' {
+    // not an object
+    return nil, nil, nil
+  }
+  keys    := []string{}
+  offsets := []int64{}
+  for decoder.More() {
+    // offset of the key, skip whitespace and separators
+    offset := decoder.InputOffset()
+    for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,", data[offset]) >= 0 {
+      offset++
+    }
+    t, err := decoder.Token(); if err != nil {
+      return nil, nil, err
+    }
+    keys    = append(keys,    t.(string))
+    offsets = append(offsets, offset)
+    // skip value
+    var value json.RawMessage
+    if err := decoder.Decode(&value); err != nil {
+      return nil, nil, err
+    }
+  }
+  return keys, offsets, nil
+}
+
+// Return json keys of all exported fields of a struct.
+func jsonStructKeys(object interface{}) []string {
+  t := reflect.TypeOf(object)
+  for t.Kind() == reflect.Ptr {
+    t = t.Elem()
+  }
+  if t.Kind() != reflect.Struct {
+    return nil
+  }
+  keys := []string{}
+  for i := 0; i < t.NumField(); i++ {
+    f := t.Field(i)
+    if f.PkgPath != "" {
+      continue
+    }
+    key := strings.Split(f.Tag.Get("json"), ",")[0]
+    if key == "-" {
+      continue
+    }
+    if key == "" {
+      key = f.Name
+    }
+    keys = append(keys, key)
+  }
+  return keys
+}
+
+// Check that the top-level object contains only the given keys. Keys are
+// case-sensitive.
+func jsonCheckKeys(data []byte, keys []string) error {
+  k, offsets, err := jsonObjectKeys(data); if err != nil {
+    return jsonError(data, err)
+  }
+  valid := make(map[string]bool)
+  for _, key := range keys {
+    valid[key] = true
+  }
+  for i, key := range k {
+    if !valid[key] {
+      line, column := jsonPosition(data, offsets[i])
+      return FormatError{Line: line, Column: column, Err: fmt.Errorf("unknown key `%s'", key)}
+    }
+  }
+  return nil
+}
 
-  scanner := bufio.NewScanner(reader)
-  result  := bytes.NewBuffer(nil)
-  for scanner.Scan() {
-    line := stripComment(scanner.Bytes())
-    if _, err := result.Write(line); err != nil {
-      return err
+// Return the position of a key in the top-level object.
+func jsonKeyPosition(data []byte, key string) (int, int, bool) {
+  k, offsets, err := jsonObjectKeys(data); if err != nil {
+    return 0, 0, false
+  }
+  for i := range k {
+    if k[i] == key {
+      line, column := jsonPosition(data, offsets[i])
+      return line, column, true
     }
   }
+  return 0, 0, false
+}
+
+/* -------------------------------------------------------------------------- */
+
+func jsonRead(reader io.Reader) ([]byte, error) {
+  data, err := ioutil.ReadAll(reader); if err != nil {
+    return nil, err
+  }
+  return stripComments(data), nil
+}
+
+// Import a json object. Comments starting with `#' are allowed outside of
+// strings.
+func JsonImport(reader io.Reader, object interface{}) error {
+  data, err := jsonRead(reader); if err != nil {
+    return err
+  }
+  if err := json.Unmarshal(data, object); err != nil {
+    return jsonError(data, err)
+  }
+  return nil
+}
 
-  return json.Unmarshal(result.Bytes(), object)
+// Import a json object and reject unknown keys of the top-level object.
+// Valid keys are the given keys or, if none are given, the json keys of
+// the object's fields.
+func JsonImportStrict(reader io.Reader, object interface{}, keys ...string) error {
+  data, err := jsonRead(reader); if err != nil {
+    return err
+  }
+  if len(keys) == 0 {
+    keys = jsonStructKeys(object)
+  }
+  if err := jsonCheckKeys(data, keys); err != nil {
+    return err
+  }
+  if err := json.Unmarshal(data, object); err != nil {
+    return jsonError(data, err)
+  }
+  return nil
 }
 
 func JsonExport(writer io.Writer, object interface{}) error {
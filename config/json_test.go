@@ -0,0 +1,82 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package config
+
+/* -------------------------------------------------------------------------- */
+
+import   "errors"
+import   "strings"
+import   "testing"
+
+import . "github.com/pbenner/ngstat/utility"
+
+/* -------------------------------------------------------------------------- */
+
+type jsonTestObject struct {
+  Name    string
+  Size    int     `json:"Bin Size"`
+  Options struct {
+    Step int
+  }
+}
+
+func TestJsonImportStrict(test *testing.T) {
+  for _, c := range []struct {
+    name   string
+    input  string
+    keys   []string
+    line   int
+    column int
+    err    string
+  }{
+    { "valid",
+      `{"Name": "a", "Bin Size": 10}`, nil, 0, 0, "" },
+    { "unknown key",
+      "{\n  \"Name\": \"a\",\n  \"BinSize\": 10\n}", nil, 3, 3, "unknown key `BinSize'" },
+    { "keys are case-sensitive",
+      `{"name": "a"}`, nil, 1, 2, "unknown key `name'" },
+    { "nested keys are not checked",
+      `{"Options": {"Step": 1, "Size": 2}}`, nil, 0, 0, "" },
+    { "comments",
+      "# comment with \"Unknown\": 1\n{\"Name\": \"a\"} # \"Size\": 1", nil, 0, 0, "" },
+    { "unknown key after comment",
+      "# comment\n{\"Name\": \"a\", \"Size\": 1}", nil, 2, 15, "unknown key `Size'" },
+    { "explicit keys",
+      `{"Name": "a", "Bin Size": 10}`, []string{"Name"}, 1, 15, "unknown key `Bin Size'" },
+    { "syntax error",
+      "{\n  \"Name\": \"a\",\n}", nil, 2, 15, "" },
+  } {
+    object := jsonTestObject{}
+    err    := JsonImportStrict(strings.NewReader(c.input), &object, c.keys...)
+    if c.line == 0 {
+      if err != nil {
+        test.Errorf("%s: unexpected error: %v", c.name, err)
+      }
+      continue
+    }
+    e := FormatError{}
+    if !errors.As(err, &e) {
+      test.Errorf("%s: expected format error, got `%v'", c.name, err); continue
+    }
+    if e.Line != c.line || e.Column != c.column {
+      test.Errorf("%s: got position %d:%d, expected %d:%d", c.name, e.Line, e.Column, c.line, c.column)
+    }
+    if c.err != "" && e.Err.Error() != c.err {
+      test.Errorf("%s: got error `%v', expected `%s'", c.name, e.Err, c.err)
+    }
+  }
+}
@@ -0,0 +1,334 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package config
+
+/* -------------------------------------------------------------------------- */
+
+import   "bytes"
+import   "encoding/json"
+import   "fmt"
+import   "io"
+import   "os"
+import   "reflect"
+import   "sort"
+import   "strings"
+
+import . "github.com/pbenner/ngstat/utility"
+
+/* -------------------------------------------------------------------------- */
+
+// Precedence of configuration layers, layers with higher precedence
+// override values of layers with lower precedence.
+const (
+  ConfigDefault     = iota
+  ConfigSystem
+  ConfigUser
+  ConfigProject
+  ConfigEnvironment
+  ConfigFile
+  ConfigPlugin
+  ConfigCommandLine
+)
+
+// Prefix of environment variables, i.e. NGSTAT_BIN_SIZE sets `Bin Size'.
+const ConfigEnvironmentPrefix = "NGSTAT_"
+
+// A configuration layer contains a subset of config values (indexed by
+// json keys) together with their source.
+type ConfigLayer struct {
+  Source     string
+  Precedence int
+  Values     map[string]json.RawMessage
+}
+
+type ConfigLayers []ConfigLayer
+
+/* -------------------------------------------------------------------------- */
+
+// Return json keys and field names of all SessionConfig fields.
+func sessionConfigFields() ([]string, []string) {
+  keys   := []string{}
+  fields := []string{}
+  t := reflect.TypeOf(SessionConfig{})
+  for i := 0; i < t.NumField(); i++ {
+    f := t.Field(i)
+    key := strings.Split(f.Tag.Get("json"), ",")[0]
+    if key == "-" {
+      continue
+    }
+    if key == "" {
+      key = f.Name
+    }
+    keys   = append(keys,   key)
+    fields = append(fields, f.Name)
+  }
+  return keys, fields
+}
+
+func sessionConfigField(key string) (string, bool) {
+  keys, fields := sessionConfigFields()
+  for i := range keys {
+    if keys[i] == key {
+      return fields[i], true
+    }
+  }
+  return "", false
+}
+
+// Name of the environment variable for a given json key.
+func configEnvironmentVariable(key string) string {
+  return ConfigEnvironmentPrefix + strings.ToUpper(strings.Replace(key, " ", "_", -1))
+}
+
+/* -------------------------------------------------------------------------- */
+
+func NewConfigLayer(source string, precedence int) ConfigLayer {
+  return ConfigLayer{source, precedence, make(map[string]json.RawMessage)}
+}
+
+// Create a configuration layer from a json object. Unknown keys and invalid
+// values are reported together with their position.
+func ImportConfigLayer(source string, precedence int, reader io.Reader) (ConfigLayer, error) {
+  layer := NewConfigLayer(source, precedence)
+  data, err := jsonRead(reader); if err != nil {
+    return layer, fmt.Errorf("%s: %w", source, err)
+  }
+  keys, _ := sessionConfigFields()
+  if err := jsonCheckKeys(data, keys); err != nil {
+    return layer, newFormatError(source, err)
+  }
+  if err := json.Unmarshal(data, &layer.Values); err != nil {
+    return layer, newFormatError(source, jsonError(data, err))
+  }
+  // check values
+  config := DefaultSessionConfig()
+  if err := json.Unmarshal(data, &config); err != nil {
+    return layer, newFormatError(source, jsonError(data, err))
+  }
+  if err := config.Validate(); err != nil {
+    if e, ok := err.(ConfigValueError); ok {
+      if line, column, ok := jsonKeyPosition(data, e.Key); ok {
+        return layer, FormatError{Filename: source, Line: line, Column: column, Err: err}
+      }
+    }
+    return layer, newFormatError(source, err)
+  }
+  return layer, nil
+}
+
+// Create a configuration layer from a json, yaml or toml file.
+func ImportConfigLayerFile(source string, precedence int, filename string) (ConfigLayer, error) {
+  str, err := readJsonFile(filename)
+  if err != nil {
+    return NewConfigLayer(source, precedence), err
+  }
+  layer, err := ImportConfigLayer(fmt.Sprintf("%s `%s'", source, filename), precedence, bytes.NewReader(str))
+  if FileFormat(filename) != FormatJson {
+    err = documentError(err)
+  }
+  return layer, err
+}
+
+// Create a configuration layer from NGSTAT_* environment variables.
+func ImportConfigLayerEnvironment(environ []string) (ConfigLayer, error) {
+  layer := NewConfigLayer("environment", ConfigEnvironment)
+  vars  := make(map[string]string)
+  for _, entry := range environ {
+    if i := strings.Index(entry, "="); i > 0 && strings.HasPrefix(entry, ConfigEnvironmentPrefix) {
+      vars[entry[0:i]] = entry[i+1:]
+    }
+  }
+  keys, fields := sessionConfigFields()
+  t := reflect.TypeOf(SessionConfig{})
+  for i, key := range keys {
+    name := configEnvironmentVariable(key)
+    value, ok := vars[name]; if !ok {
+      continue
+    }
+    f, _ := t.FieldByName(fields[i])
+    var raw []byte
+    switch f.Type.Kind() {
+    case reflect.String:
+      raw, _ = json.Marshal(value)
+    case reflect.Slice:
+      raw = []byte("[" + value + "]")
+    default:
+      raw = []byte(value)
+    }
+    layer.Values[key] = raw
+    // check value
+    config := DefaultSessionConfig()
+    if err := layer.apply(&config); err != nil {
+      return layer, fmt.Errorf("invalid value `%s' for environment variable %s: %w", value, name, err)
+    }
+    if err := config.Validate(); err != nil {
+      return layer, fmt.Errorf("environment variable %s: %w", name, err)
+    }
+  }
+  return layer, nil
+}
+
+// Create a configuration layer from all values of a config that differ from
+// the defaults. A struct does not tell which fields were set explicitly,
+// hence values that are equal to the defaults are not recorded and do not
+// override other layers. Use NewConfigLayerFromValues to set such values.
+func NewConfigLayerFromConfig(source string, precedence int, config SessionConfig) ConfigLayer {
+  layer := NewConfigLayer(source, precedence)
+  def   := DefaultSessionConfig()
+  keys, fields := sessionConfigFields()
+  v1 := reflect.ValueOf(config)
+  v2 := reflect.ValueOf(def)
+  for i, key := range keys {
+    if !reflect.DeepEqual(v1.FieldByName(fields[i]).Interface(), v2.FieldByName(fields[i]).Interface()) {
+      layer.Values[key], _ = json.Marshal(v1.FieldByName(fields[i]).Interface())
+    }
+  }
+  return layer
+}
+
+// Create a configuration layer from a map of values indexed by json keys.
+// Only the given keys are set.
+func NewConfigLayerFromValues(source string, precedence int, values map[string]interface{}) (ConfigLayer, error) {
+  layer := NewConfigLayer(source, precedence)
+  for key, value := range values {
+    if err := layer.Set(key, value); err != nil {
+      return layer, err
+    }
+  }
+  config := DefaultSessionConfig()
+  if err := layer.apply(&config); err != nil {
+    return layer, fmt.Errorf("%s: %w", source, err)
+  }
+  return layer, nil
+}
+
+// Set a value, where key is the json key of the field.
+func (layer ConfigLayer) Set(key string, value interface{}) error {
+  if _, ok := sessionConfigField(key); !ok {
+    return NewArgumentError("unknown config key `%s'", key)
+  }
+  if raw, err := json.Marshal(value); err != nil {
+    return err
+  } else {
+    layer.Values[key] = raw
+  }
+  return nil
+}
+
+func (layer ConfigLayer) apply(config *SessionConfig) error {
+  v := reflect.ValueOf(config).Elem()
+  for key, raw := range layer.Values {
+    name, ok := sessionConfigField(key); if !ok {
+      return NewArgumentError("%s: unknown config key `%s'", layer.Source, key)
+    }
+    if err := json.Unmarshal(raw, v.FieldByName(name).Addr().Interface()); err != nil {
+      return fmt.Errorf("%s: invalid value for `%s': %v: %w", layer.Source, key, err, ErrInvalidArgument)
+    }
+    config.setSource(key, layer.Source)
+  }
+  return nil
+}
+
+// Apply a single layer on top of a config.
+func (config *SessionConfig) ApplyLayer(layer ConfigLayer) error {
+  return layer.apply(config)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Return a copy of the layers with an additional layer.
+func (layers ConfigLayers) Add(layer ConfigLayer) ConfigLayers {
+  return append(append(ConfigLayers{}, layers...), layer)
+}
+
+// Apply all layers in order of precedence on top of the default config.
+func (layers ConfigLayers) Apply() (SessionConfig, error) {
+  config := DefaultSessionConfig()
+  sorted := append(ConfigLayers{}, layers...)
+  sort.SliceStable(sorted, func(i, j int) bool {
+    return sorted[i].Precedence < sorted[j].Precedence
+  })
+  for _, layer := range sorted {
+    if err := layer.apply(&config); err != nil {
+      return config, err
+    }
+  }
+  if err := config.Validate(); err != nil {
+    if e, ok := err.(ConfigValueError); ok {
+      return config, fmt.Errorf("%s: %w", config.Source(e.Key), err)
+    }
+    return config, err
+  }
+  return config, nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// File extensions of standard configuration files in order of preference.
+var ConfigFileExtensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// Return the first existing file with one of the standard extensions or, if
+// none exists, the json file.
+func configFile(basename string) string {
+  for _, ext := range ConfigFileExtensions {
+    if _, err := os.Stat(basename + ext); err == nil {
+      return basename + ext
+    }
+  }
+  return basename + ConfigFileExtensions[0]
+}
+
+// Standard configuration files, which are imported if they exist: a system
+// file, a user file, and a project file in the current directory. Each file
+// may be given in json, yaml or toml format.
+func ConfigFiles() ([]string, []string, []int) {
+  sources     := []string{"system file"}
+  filenames   := []string{configFile("/etc/ngstat/config")}
+  precedences := []int{ConfigSystem}
+  if dir, err := os.UserConfigDir(); err == nil {
+    sources     = append(sources,     "user file")
+    filenames   = append(filenames,   configFile(dir + "/ngstat/config"))
+    precedences = append(precedences, ConfigUser)
+  }
+  sources     = append(sources,     "project file")
+  filenames   = append(filenames,   configFile(".ngstat"))
+  precedences = append(precedences, ConfigProject)
+  return sources, filenames, precedences
+}
+
+// Import all standard configuration files that exist and NGSTAT_*
+// environment variables.
+func ImportConfigLayers() (ConfigLayers, error) {
+  layers := ConfigLayers{}
+  sources, filenames, precedences := ConfigFiles()
+  for i, filename := range filenames {
+    if _, err := os.Stat(filename); err != nil {
+      continue
+    }
+    if layer, err := ImportConfigLayerFile(sources[i], precedences[i], filename); err != nil {
+      return nil, err
+    } else {
+      layers = append(layers, layer)
+    }
+  }
+  if layer, err := ImportConfigLayerEnvironment(os.Environ()); err != nil {
+    return nil, err
+  } else {
+    layers = append(layers, layer)
+  }
+  return layers, nil
+}
@@ -0,0 +1,144 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package config
+
+/* -------------------------------------------------------------------------- */
+
+import   "strings"
+import   "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestConfigLayersPlugin(test *testing.T) {
+  env, err := ImportConfigLayerEnvironment([]string{"NGSTAT_BIN_SIZE=50", "NGSTAT_THREADS=4"}); if err != nil {
+    test.Fatal(err)
+  }
+  // plugin config that only sets the number of threads
+  pluginConfig := DefaultSessionConfig()
+  pluginConfig.Threads = 2
+  pluginValues, err := NewConfigLayerFromValues("plugin", ConfigPlugin, map[string]interface{}{"Verbose": 0}); if err != nil {
+    test.Fatal(err)
+  }
+  for _, c := range []struct {
+    name    string
+    layers  ConfigLayers
+    binSize int
+    threads int
+    source  string
+  }{
+    { "environment",
+      ConfigLayers{env}, 50, 4, "environment" },
+    { "plugin config",
+      ConfigLayers{NewConfigLayerFromConfig("plugin", ConfigPlugin, pluginConfig), env}, 50, 2, "plugin" },
+    { "plugin config with defaults",
+      ConfigLayers{NewConfigLayerFromConfig("plugin", ConfigPlugin, DefaultSessionConfig()), env}, 50, 4, "environment" },
+    { "plugin values",
+      ConfigLayers{pluginValues, env}, 50, 4, "environment" },
+  } {
+    config, err := c.layers.Apply(); if err != nil {
+      test.Errorf("%s: %v", c.name, err); continue
+    }
+    if config.BinSize != c.binSize {
+      test.Errorf("%s: got bin size `%d', expected `%d'", c.name, config.BinSize, c.binSize)
+    }
+    if config.Threads != c.threads {
+      test.Errorf("%s: got `%d' threads, expected `%d'", c.name, config.Threads, c.threads)
+    }
+    if s := config.Source("Bin Size"); s != "environment" {
+      test.Errorf("%s: got source `%s' for bin size, expected `environment'", c.name, s)
+    }
+    if s := config.Source("Threads"); s != c.source {
+      test.Errorf("%s: got source `%s' for threads, expected `%s'", c.name, s, c.source)
+    }
+  }
+  if _, err := NewConfigLayerFromValues("plugin", ConfigPlugin, map[string]interface{}{"Bin Sizes": 10}); err == nil {
+    test.Error("unknown key not rejected")
+  }
+}
+
+func TestConfigLayersApply(test *testing.T) {
+  layer := func(source string, precedence int, values map[string]interface{}) ConfigLayer {
+    r, err := NewConfigLayerFromValues(source, precedence, values); if err != nil {
+      test.Fatal(err)
+    }
+    return r
+  }
+  system  := layer("system",       ConfigSystem,      map[string]interface{}{"Threads": 2, "Verbose": 1})
+  user    := layer("user",         ConfigUser,        map[string]interface{}{"Threads": 3})
+  project := layer("project",      ConfigProject,     map[string]interface{}{"Threads": 4})
+  env     := layer("environment",  ConfigEnvironment, map[string]interface{}{"Threads": 5})
+  file    := layer("file",         ConfigFile,        map[string]interface{}{"Threads": 6})
+  plugin  := layer("plugin",       ConfigPlugin,      map[string]interface{}{"Threads": 7})
+  cmd     := layer("command line", ConfigCommandLine, map[string]interface{}{"Threads": 8})
+  invalid := layer("file",         ConfigFile,        map[string]interface{}{"Threads": 0})
+  for _, c := range []struct {
+    name    string
+    layers  ConfigLayers
+    threads int
+    source  string
+    err     bool
+  }{
+    { "defaults",
+      ConfigLayers{}, 1, "default", false },
+    { "system",
+      ConfigLayers{system}, 2, "system", false },
+    { "user over system",
+      ConfigLayers{user, system}, 3, "user", false },
+    { "project over user",
+      ConfigLayers{project, user, system}, 4, "project", false },
+    { "environment over project",
+      ConfigLayers{env, system, project}, 5, "environment", false },
+    { "file over environment",
+      ConfigLayers{file, env, user}, 6, "file", false },
+    { "plugin over file",
+      ConfigLayers{plugin, file, env}, 7, "plugin", false },
+    { "command line over all",
+      ConfigLayers{cmd, plugin, file, env, project, user, system}, 8, "command line", false },
+    { "all in order",
+      ConfigLayers{system, user, project, env, file, plugin, cmd}, 8, "command line", false },
+    { "invalid value",
+      ConfigLayers{system, invalid}, 0, "file", true },
+    { "invalid value overridden",
+      ConfigLayers{cmd, invalid}, 8, "command line", false },
+  } {
+    config, err := c.layers.Apply()
+    if c.err {
+      if err == nil {
+        test.Errorf("%s: invalid config not rejected", c.name)
+      } else if !strings.HasPrefix(err.Error(), c.source+": ") {
+        test.Errorf("%s: got error `%v', expected source `%s'", c.name, err, c.source)
+      }
+      continue
+    }
+    if err != nil {
+      test.Errorf("%s: %v", c.name, err); continue
+    }
+    if config.Threads != c.threads {
+      test.Errorf("%s: got `%d' threads, expected `%d'", c.name, config.Threads, c.threads)
+    }
+    if s := config.Source("Threads"); s != c.source {
+      test.Errorf("%s: got source `%s' for threads, expected `%s'", c.name, s, c.source)
+    }
+  }
+  // values not set by higher layers must be retained
+  config, err := ConfigLayers{cmd, system}.Apply(); if err != nil {
+    test.Fatal(err)
+  }
+  if config.Verbose != 1 || config.Source("Verbose") != "system" {
+    test.Errorf("got verbose level `%d' from `%s', expected `1' from `system'", config.Verbose, config.Source("Verbose"))
+  }
+}
@@ -0,0 +1,81 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package config
+
+/* -------------------------------------------------------------------------- */
+
+import   "io"
+
+/* -------------------------------------------------------------------------- */
+
+type jsonSchema map[string]interface{}
+
+// Return a JSON Schema (draft-07) that describes valid config files.
+func SessionConfigSchema() interface{} {
+  def := DefaultSessionConfig()
+  properties := jsonSchema{
+    "Threads": jsonSchema{
+      "description": "number of threads",
+      "type"       : "integer",
+      "minimum"    : 1,
+      "default"    : def.Threads },
+    "Verbose": jsonSchema{
+      "description": "verbose level",
+      "type"       : "integer",
+      "minimum"    : 0,
+      "default"    : def.Verbose },
+    "Bin Summary Statistics": jsonSchema{
+      "description": "statistic used to summarize values within a bin",
+      "type"       : "string",
+      "enum"       : BinSummaryStatisticsNames,
+      "default"    : def.BinSummaryStatistics },
+    "BigWig Zoom Levels": jsonSchema{
+      "description": "zoom levels of exported bigWig files (null: determined automatically)",
+      "type"       : []string{"array", "null"},
+      "items"      : jsonSchema{"type": "integer", "minimum": 1},
+      "default"    : nil },
+    "Bin Size": jsonSchema{
+      "description": "bin size of imported tracks (0: use bin size of the file)",
+      "type"       : "integer",
+      "minimum"    : 0,
+      "default"    : def.BinSize },
+    "Bin Overlap": jsonSchema{
+      "description": "number of overlapping bins when computing the summary",
+      "type"       : "integer",
+      "minimum"    : 0,
+      "default"    : def.BinOverlap },
+    "Track Initial Value": jsonSchema{
+      "description": "initial value of tracks",
+      "type"       : "number",
+      "default"    : def.TrackInit },
+    "Log Format": jsonSchema{
+      "description": "format of log messages written to stderr",
+      "type"       : "string",
+      "enum"       : LogFormatNames,
+      "default"    : def.LogFormat },
+  }
+  return jsonSchema{
+    "$schema"             : "http://json-schema.org/draft-07/schema#",
+    "title"               : "ngstat session config",
+    "type"                : "object",
+    "properties"          : properties,
+    "additionalProperties": false }
+}
+
+func ExportSessionConfigSchema(writer io.Writer) error {
+  return JsonExport(writer, SessionConfigSchema())
+}
@@ -18,7 +18,6 @@ package config
 
 /* -------------------------------------------------------------------------- */
 
-//import "fmt"
 import "bytes"
 import "io"
 import "io/ioutil"
@@ -33,14 +32,29 @@ type Serializable interface {
 
 /* -------------------------------------------------------------------------- */
 
+// Import an object from a json, yaml or toml file. The format is determined
+// by the file extension.
 func ImportFile(object Serializable, filename string, args... interface{}) error {
-  str, err := ioutil.ReadFile(filename)
+  if FileFormat(filename) == FormatJson {
+    str, err := ioutil.ReadFile(filename)
+    if err != nil {
+      return err
+    }
+    return newFormatError(filename, object.Import(bytes.NewReader(str), args...))
+  }
+  str, err := readJsonFile(filename)
   if err != nil {
     return err
   }
-  return object.Import(bytes.NewReader(str), args...)
+  // positions in errors refer to the original file
+  if err := object.Import(bytes.NewReader(str), args...); err != nil {
+    return documentError(newFormatError(filename, err))
+  }
+  return nil
 }
 
+// Export an object to a json, yaml or toml file. The format is determined
+// by the file extension.
 func ExportFile(object Serializable, filename string) error {
   f, err := os.Create(filename)
   if err != nil {
@@ -48,5 +62,20 @@ func ExportFile(object Serializable, filename string) error {
   }
   defer f.Close()
 
-  return object.Export(f)
+  return ExportFormat(object, f, FileFormat(filename))
+}
+
+// Export an object in the given format (FormatJson, FormatYaml or
+// FormatToml).
+func ExportFormat(object Serializable, writer io.Writer, format string) error {
+  var buffer bytes.Buffer
+  if err := object.Export(&buffer); err != nil {
+    return err
+  }
+  data, err := convertJson(buffer.Bytes(), format)
+  if err != nil {
+    return err
+  }
+  _, err = writer.Write(data)
+  return err
 }
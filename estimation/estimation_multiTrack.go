@@ -18,9 +18,11 @@ package estimation
 
 /* -------------------------------------------------------------------------- */
 
-import   "fmt"
+import   "context"
 
 import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/options"
 import . "github.com/pbenner/autodiff/statistics"
 import . "github.com/pbenner/ngstat/track"
 import . "github.com/pbenner/ngstat/trackDataTransform"
@@ -32,17 +34,19 @@ import   "github.com/pbenner/threadpool"
 
 /* -------------------------------------------------------------------------- */
 
-func EstimateOnMultiTrackData(config SessionConfig, estimator MatrixEstimator, data []Matrix, transposed bool, args ...interface{}) error {
+func EstimateOnMultiTrackData(config SessionConfig, estimator MatrixEstimator, data []Matrix, transposed bool, options ...Option) error {
+  return EstimateOnMultiTrackDataContext(context.Background(), config, estimator, data, transposed, options...)
+}
+
+func EstimateOnMultiTrackDataContext(ctx context.Context, config SessionConfig, estimator MatrixEstimator, data []Matrix, transposed bool, options ...Option) error {
   var f MultiTrackDataTransform
   var x []Matrix
   var y []ConstMatrix
 
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case MultiTrackDataTransform:
-      f = a
-    }
+  opts, err := ParseOptions("EstimateOnMultiTrackData", MultiTrackTransformOption, options); if err != nil {
+    return err
   }
+  f = opts.MultiTrackTransform
 
   if transposed || f != nil {
     x = make([]Matrix, len(data))
@@ -67,6 +71,11 @@ func EstimateOnMultiTrackData(config SessionConfig, estimator MatrixEstimator, d
     y[i] = x[i]
   }
 
+  // the estimator itself cannot be interrupted, check for
+  // cancellation before starting the estimation
+  if err := ContextError(ctx); err != nil {
+    return err
+  }
   if err := estimator.EstimateOnData(y, nil, threadpool.Nil()); err != nil {
     return err
   }
@@ -74,22 +83,24 @@ func EstimateOnMultiTrackData(config SessionConfig, estimator MatrixEstimator, d
   return nil
 }
 
-func BatchEstimateOnMultiTrackData(config SessionConfig, estimator MatrixBatchEstimator, data []Matrix, transposed bool, args ...interface{}) error {
+func BatchEstimateOnMultiTrackData(config SessionConfig, estimator MatrixBatchEstimator, data []Matrix, transposed bool, options ...Option) error {
+  return BatchEstimateOnMultiTrackDataContext(context.Background(), config, estimator, data, transposed, options...)
+}
+
+func BatchEstimateOnMultiTrackDataContext(ctx context.Context, config SessionConfig, estimator MatrixBatchEstimator, data []Matrix, transposed bool, options ...Option) error {
   var f MultiTrackBatchDataTransform
   var y Matrix
 
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case MultiTrackBatchDataTransform:
-      f = a
-    }
+  opts, err := ParseOptions("BatchEstimateOnMultiTrackData", MultiTrackBatchTransformOption, options); if err != nil {
+    return err
   }
+  f = opts.MultiTrackBatchTransform
   n1, n2 := estimator.Dims()
   m1, m2 := n1, n2
 
   if f != nil {
     if t1, t2, t3, t4 := f.Dims(); t3 != m1 || t4 != m2 {
-      return fmt.Errorf("data transform output dimensions do not match estimator dimension")
+      return NewDimensionError(m1*m2, t3*t4, "data transform output dimensions do not match estimator dimension")
     } else {
       n1 = t1
       n2 = t2
@@ -98,10 +109,10 @@ func BatchEstimateOnMultiTrackData(config SessionConfig, estimator MatrixBatchEs
   // check data
   for d := 0; d < len(data); d++ {
     if n, _ := data[d].Dims(); n != n1 {
-      return fmt.Errorf("data record `%d' has invalid number of rows", d)
+      return NewDimensionError(n1, n, "data record `%d' has invalid number of rows", d)
     }
     if _, n := data[d].Dims(); n != n2 {
-      return fmt.Errorf("data record `%d' has invalid number of columns", d)
+      return NewDimensionError(n2, n, "data record `%d' has invalid number of columns", d)
     }
   }
   if f != nil {
@@ -112,6 +123,9 @@ func BatchEstimateOnMultiTrackData(config SessionConfig, estimator MatrixBatchEs
   }
 
   for d := 0; d < len(data); d++ {
+    if err := ContextError(ctx); err != nil {
+      return err
+    }
     x := data[d]
     if transposed {
       x = x.CloneMatrix()
@@ -132,24 +146,27 @@ func BatchEstimateOnMultiTrackData(config SessionConfig, estimator MatrixBatchEs
   return nil
 }
 
-func BatchEstimateOnMultiTrack(config SessionConfig, estimator MatrixBatchEstimator, tracks []Track, transposed bool, step int, args ...interface{}) error {
+// Progress events are sent to the callback given with WithProgress,
+// otherwise they are logged.
+func BatchEstimateOnMultiTrack(config SessionConfig, estimator MatrixBatchEstimator, tracks []Track, transposed bool, options ...Option) error {
+  return BatchEstimateOnMultiTrackContext(context.Background(), config, estimator, tracks, transposed, options...)
+}
+
+func BatchEstimateOnMultiTrackContext(ctx context.Context, config SessionConfig, estimator MatrixBatchEstimator, tracks []Track, transposed bool, options ...Option) error {
   if len(tracks) == 0 {
     return nil
   }
-  var f MultiTrackBatchDataTransform
-
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case MultiTrackBatchDataTransform:
-      f = a
-    }
+  opts, err := ParseOptions("BatchEstimateOnMultiTrack", MultiTrackBatchTransformOption | StepOption | SeqnamesOption | MaskOption | ExecutionContextOption | ProgressOption, options); if err != nil {
+    return err
   }
+  f := opts.MultiTrackBatchTransform
+  tracks = opts.FilterTracks(tracks)
   binSize := config.BinSize
   if binSize == 0 {
     binSize = tracks[0].GetBinSize()
   }
   if binSize == 0 {
-    return fmt.Errorf("could not determine track bin size")
+    return NewBinSizeError(0, 0, "could not determine track bin size")
   }
 
   n1, n2 := estimator.Dims()
@@ -157,13 +174,14 @@ func BatchEstimateOnMultiTrack(config SessionConfig, estimator MatrixBatchEstima
 
   if f != nil {
     if t1, t2, t3, t4 := f.Dims(); t3 != m1 || t4 != m2 {
-      return fmt.Errorf("data transform output dimensions do not match estimator dimension")
+      return NewDimensionError(m1*m2, t3*t4, "data transform output dimensions do not match estimator dimension")
     } else {
       n1 = t1
       n2 = t2
     }
   }
   // set default step size
+  step := opts.Step
   if step <= 0 {
     step = n2
   }
@@ -177,9 +195,17 @@ func BatchEstimateOnMultiTrack(config SessionConfig, estimator MatrixBatchEstima
     return err
   }
 
-  offset1 := DivIntUp  (n2-1, 2)
-  offset2 := DivIntDown(n2-1, 2)
+  // windows are placed at multiples of the step size,
+  // windows with masked regions are skipped
+  parameters := DefaultWindowParameters(n2)
+  parameters.Step       = step
+  parameters.Anchor     = WindowAnchorStart
+  parameters.Transposed = transposed
+  parameters.NaN        = WindowSkipNaN
 
+  it, err := NewMultiTrackWindowIterator(estimator.ScalarType(), tracks, parameters); if err != nil {
+    return err
+  }
   // counter
   l := 0
   // total track length
@@ -187,89 +213,95 @@ func BatchEstimateOnMultiTrack(config SessionConfig, estimator MatrixBatchEstima
   for _, length := range tracks[0].GetGenome().Lengths {
     L += length/binSize
   }
-  if config.Verbose > 0 {
-    NewProgress(L, L).PrintStderr(l)
-  }
-  // memory for collecting track sequences before
-  // converting them to vectors
-  sequences := make([]TrackSequence, len(tracks))
+  progress := NewNamedProgress("Estimating", L, L)
+  callback := GetProgressCallback(config, opts.Progress)
+  progress.Report(callback, l, "")
+  // memory reserved for the current sequence
+  memory   := opts.GetMemoryBudget()
+  reserved := int64(0)
+  defer func() { memory.Release(reserved) }()
 
-  for _, name := range tracks[0].GetSeqNames() {
-    for k := 0; k < len(tracks); k++ {
-      if seq, err := tracks[k].GetSequence(name); err != nil {
-        return err
-      } else {
-        sequences[k] = seq
-      }
-      if sequences[0].NBins() != sequences[k].NBins() {
-        return fmt.Errorf("lengths of sequence `%s' varies between tracks", name)
-      }
+  for it.NextSequence() {
+    if err := ContextError(ctx); err != nil {
+      return err
     }
-    x     := SequencesToMatrix(estimator.ScalarType(), sequences, transposed)
-    nbins := sequences[0].NBins()
-
-    nrows, ncols := x.Dims()
-    // launch jobs
-    for i := offset1; i < nbins-offset2; i += step {
-      if transposed {
-        x := x.Slice(i-offset1, i+offset2+1, 0, ncols)
-        if f != nil {
-          if err := f.Eval(y, x); err != nil {
-            return err
-          }
-        } else {
-          y = x
-        }
-        if err := estimator.NewObservation(y, nil, threadpool.Nil()); err != nil {
+    windows := it.Sequence()
+    // reserve memory for the sequence matrix
+    if err := memory.Acquire(ctx, windows.Bytes()); err != nil {
+      return err
+    }
+    reserved = windows.Bytes()
+    windows.Load()
+
+    for k := 0; k < windows.Len(); k++ {
+      x := windows.Window(k).Matrix
+      if f != nil {
+        if err := f.Eval(y, x); err != nil {
           return err
         }
       } else {
-        x := x.Slice(0, nrows, i-offset1, i+offset2+1)
-        if f != nil {
-          if err := f.Eval(y, x); err != nil {
-            return err
-          }
-        } else {
-          y = x
-        }
-        if err := estimator.NewObservation(y, nil, threadpool.Nil()); err != nil {
-          return err
-        }
+        y = x
+      }
+      if err := estimator.NewObservation(y, nil, threadpool.Nil()); err != nil {
+        return err
       }
     }
-    l += nbins
+    memory.Release(reserved); reserved = 0
 
-    if config.Verbose > 0 {
-      NewProgress(L, L).PrintStderr(l)
-    }
+    l += windows.NBins()
+
+    progress.Report(callback, l, windows.Seqname)
+  }
+  if err := it.Err(); err != nil {
+    return err
   }
   return nil
 }
 
-func EstimateOnMultiTrack(config SessionConfig, estimator MatrixEstimator, tracks []Track, transposed bool, args ...interface{}) error {
+// Estimate a model of variable column dimension, such as a hidden Markov
+// model, on all sequences of a set of tracks. Sequences are split into
+// non-overlapping chunks if the WithChunks option is given (see
+// EstimateOnSingleTrack).
+func EstimateOnMultiTrack(config SessionConfig, estimator MatrixEstimator, tracks []Track, transposed bool, options ...Option) error {
+  return EstimateOnMultiTrackContext(context.Background(), config, estimator, tracks, transposed, options...)
+}
+
+func EstimateOnMultiTrackContext(ctx context.Context, config SessionConfig, estimator MatrixEstimator, tracks []Track, transposed bool, options ...Option) error {
   if len(tracks) == 0 {
     return nil
   }
   if _, m := estimator.Dims(); m != -1 {
-    return fmt.Errorf("estimator has wrong dimension (expected variable column dimension, but estimator has dimension `%d')", m)
+    return NewDimensionError(-1, m, "estimator has wrong dimension (expected variable column dimension, but estimator has dimension `%d')", m)
   }
   if n, _ := estimator.Dims(); n != len(tracks) {
-    return fmt.Errorf("estimator has wrong dimension (expected row dimension `%d', but estimator has dimension `%d')", len(tracks), n)
+    return NewDimensionError(len(tracks), n, "estimator has wrong dimension (expected row dimension `%d', but estimator has dimension `%d')", len(tracks), n)
   }
-  var f MultiTrackDataTransform
+  opts, err := ParseOptions("EstimateOnMultiTrack", MultiTrackTransformOption | ChunkOption | TrackOptions, options); if err != nil {
+    return err
+  }
+  f := opts.MultiTrackTransform
+  tracks = opts.FilterTracks(tracks)
+  exec := opts.GetExecutionContext(config)
+  defer exec.Release()
+  pool := exec.Pool
 
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case MultiTrackDataTransform:
-      f = a
-    }
+  // reserve memory for all sequences until the estimation is done
+  bytes := int64(0)
+  for _, length := range tracks[0].GetGenome().Lengths {
+    bytes += 8*int64(length/tracks[0].GetBinSize())*int64(len(tracks))
   }
-  pool := threadpool.New(config.Threads, config.Threads*1000)
+  if err := exec.Memory.Acquire(ctx, bytes); err != nil {
+    return err
+  }
+  defer exec.Memory.Release(bytes)
 
   x := []ConstMatrix{}
   // collect sequences
 LOOP1:
   for _, name := range tracks[0].GetSeqNames() {
+    if err := ContextError(ctx); err != nil {
+      return err
+    }
     xd := NullDenseVector(Float64Type, 0)
     nd := -1
     for i := 0; i < len(tracks); i++ {
@@ -281,7 +313,7 @@ LOOP1:
         nd = seq.NBins()
       }
       if seq.NBins() != nd {
-        return fmt.Errorf("sequence `%s' has varying length", name)
+        return NewDimensionError(nd, seq.NBins(), "sequence `%s' has varying length", name)
       }
       y := NullDenseVector(estimator.ScalarType(), nd)
       for j := 0; j < nd; j++ {
@@ -298,7 +330,13 @@ LOOP1:
     if f != nil {
       r = f.Eval(r)
     }
-    x = append(x, r)
+    // chunks are passed as separate observations to the estimator
+    for _, chunk := range SplitSequence(nd, opts.ChunkSize, 0) {
+      x = append(x, SliceSequencesMatrix(r, chunk.From, chunk.To, transposed))
+    }
+  }
+  if err := ContextError(ctx); err != nil {
+    return err
   }
   if err := estimator.EstimateOnData(x, nil, pool); err != nil {
     return err
@@ -309,78 +347,42 @@ LOOP1:
 /* utility
  * -------------------------------------------------------------------------- */
 
-func ImportAndEstimateOnMultiTrack(config SessionConfig, estimator MatrixEstimator, trackFiles []string, transposed bool, args ...interface{}) error {
+func ImportAndEstimateOnMultiTrack(config SessionConfig, estimator MatrixEstimator, trackFiles []string, transposed bool, options ...Option) error {
+  return ImportAndEstimateOnMultiTrackContext(context.Background(), config, estimator, trackFiles, transposed, options...)
+}
+
+func ImportAndEstimateOnMultiTrackContext(ctx context.Context, config SessionConfig, estimator MatrixEstimator, trackFiles []string, transposed bool, options ...Option) error {
   if len(trackFiles) == 0 {
     return nil
   }
-  // default parameters
-  var args_new []interface{}
-  var seqnames map[string]bool
-
-  // parse optional arguments
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case []string:
-      seqnames = make(map[string]bool)
-      for _, name := range a {
-        seqnames[name] = true
-      }
-    default:
-      args_new = append(args_new, arg)
-    }
-  }
-
   tracks := make([]Track, len(trackFiles))
 
   for i := 0; i < len(trackFiles); i++ {
     if t, err := ImportLazyTrack(config, trackFiles[i]); err != nil {
       return err
     } else {
-      if seqnames != nil {
-        t.FilterGenome(func(name string, length int) bool {
-          return seqnames[name]
-        })
-      }
       tracks[i] = t; defer t.Close()
     }
   }
-  return EstimateOnMultiTrack(config, estimator, tracks, transposed, args_new...)
+  return EstimateOnMultiTrackContext(ctx, config, estimator, tracks, transposed, options...)
+}
+
+func ImportAndBatchEstimateOnMultiTrack(config SessionConfig, estimator MatrixBatchEstimator, trackFiles []string, transposed bool, options ...Option) error {
+  return ImportAndBatchEstimateOnMultiTrackContext(context.Background(), config, estimator, trackFiles, transposed, options...)
 }
 
-func ImportAndBatchEstimateOnMultiTrack(config SessionConfig, estimator MatrixBatchEstimator, trackFiles []string, transposed bool, step int, args ...interface{}) error {
+func ImportAndBatchEstimateOnMultiTrackContext(ctx context.Context, config SessionConfig, estimator MatrixBatchEstimator, trackFiles []string, transposed bool, options ...Option) error {
   if len(trackFiles) == 0 {
     return nil
   }
-  // default parameters
-  var args_new []interface{}
-  var seqnames map[string]bool
-
-  // parse optional arguments
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case []string:
-      seqnames = make(map[string]bool)
-      for _, name := range a {
-        seqnames[name] = true
-      }
-    default:
-      args_new = append(args_new, arg)
-    }
-  }
-
   tracks := make([]Track, len(trackFiles))
 
   for i := 0; i < len(trackFiles); i++ {
     if t, err := ImportLazyTrack(config, trackFiles[i]); err != nil {
       return err
     } else {
-      if seqnames != nil {
-        t.FilterGenome(func(name string, length int) bool {
-          return seqnames[name]
-        })
-      }
       tracks[i] = t; defer t.Close()
     }
   }
-  return BatchEstimateOnMultiTrack(config, estimator, tracks, transposed, step, args_new...)
+  return BatchEstimateOnMultiTrackContext(ctx, config, estimator, tracks, transposed, options...)
 }
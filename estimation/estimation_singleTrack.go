@@ -18,23 +18,27 @@ package estimation
 
 /* -------------------------------------------------------------------------- */
 
-import   "fmt"
-import   "math"
+import   "context"
 
 import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/options"
+import . "github.com/pbenner/ngstat/utility"
 import . "github.com/pbenner/ngstat/track"
 import . "github.com/pbenner/ngstat/trackDataTransform"
-import . "github.com/pbenner/ngstat/utility"
 
 import . "github.com/pbenner/autodiff"
 import . "github.com/pbenner/autodiff/statistics"
 
 import . "github.com/pbenner/gonetics"
-import   "github.com/pbenner/threadpool"
 
 /* -------------------------------------------------------------------------- */
 
-func EstimateOnSingleTrackData(config SessionConfig, estimator VectorEstimator, data []Vector, args ...interface{}) error {
+func EstimateOnSingleTrackData(config SessionConfig, estimator VectorEstimator, data []Vector, options ...Option) error {
+  return EstimateOnSingleTrackDataContext(context.Background(), config, estimator, data, options...)
+}
+
+func EstimateOnSingleTrackDataContext(ctx context.Context, config SessionConfig, estimator VectorEstimator, data []Vector, options ...Option) error {
   if len(data) == 0 {
     return nil
   }
@@ -43,12 +47,10 @@ func EstimateOnSingleTrackData(config SessionConfig, estimator VectorEstimator,
   var x []Vector
   var y []ConstVector
 
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case SingleTrackDataTransform:
-      f = a
-    }
+  opts, err := ParseOptions("EstimateOnSingleTrackData", SingleTrackTransformOption | ThreadsOption | ExecutionContextOption, options); if err != nil {
+    return err
   }
+  f = opts.SingleTrackTransform
 
   if f != nil {
     x = make([]Vector, len(data))
@@ -63,54 +65,73 @@ func EstimateOnSingleTrackData(config SessionConfig, estimator VectorEstimator,
   for i := 0; i < len(x); i++ {
     y[i] = x[i]
   }
-  pool := threadpool.New(config.Threads, config.Threads*1000)
+  exec := opts.GetExecutionContext(config)
+  defer exec.Release()
+  pool := exec.Pool
 
+  // the estimator itself cannot be interrupted, check for
+  // cancellation before starting the estimation
+  if err := ContextError(ctx); err != nil {
+    return err
+  }
   if err := estimator.EstimateOnData(y, nil, pool); err != nil {
     return err
   }
   return nil
 }
 
-func EstimateOnSingleTrackConstData(config SessionConfig, estimator VectorEstimator, data []ConstVector, args ...interface{}) error {
+func EstimateOnSingleTrackConstData(config SessionConfig, estimator VectorEstimator, data []ConstVector, options ...Option) error {
+  return EstimateOnSingleTrackConstDataContext(context.Background(), config, estimator, data, options...)
+}
+
+func EstimateOnSingleTrackConstDataContext(ctx context.Context, config SessionConfig, estimator VectorEstimator, data []ConstVector, options ...Option) error {
+  opts, err := ParseOptions("EstimateOnSingleTrackConstData", ThreadsOption | ExecutionContextOption, options); if err != nil {
+    return err
+  }
   if len(data) == 0 {
     return nil
   }
-  pool := threadpool.New(config.Threads, config.Threads*1000)
+  exec := opts.GetExecutionContext(config)
+  defer exec.Release()
+  pool := exec.Pool
 
+  if err := ContextError(ctx); err != nil {
+    return err
+  }
   if err := estimator.EstimateOnData(data, nil, pool); err != nil {
     return err
   }
   return nil
 }
 
-func BatchEstimateOnSingleTrackData(config SessionConfig, estimator VectorBatchEstimator, data []Vector, args ...interface{}) error {
+func BatchEstimateOnSingleTrackData(config SessionConfig, estimator VectorBatchEstimator, data []Vector, options ...Option) error {
+  return BatchEstimateOnSingleTrackDataContext(context.Background(), config, estimator, data, options...)
+}
+
+func BatchEstimateOnSingleTrackDataContext(ctx context.Context, config SessionConfig, estimator VectorBatchEstimator, data []Vector, options ...Option) error {
   if len(data) == 0 {
     return nil
   }
   n := estimator.Dim()
   m := n
 
-  var f SingleTrackBatchDataTransform
-
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case SingleTrackBatchDataTransform:
-      f = a
-    }
+  opts, err := ParseOptions("BatchEstimateOnSingleTrackData", SingleTrackBatchTransformOption | ThreadsOption | ExecutionContextOption, options); if err != nil {
+    return err
   }
+  f := opts.SingleTrackBatchTransform
   // check dimensions
   if f != nil {
     if n1, n2 := f.Dims(); n1 != n {
-      return fmt.Errorf("data transform input dimension does not match data dimension")
+      return NewDimensionError(n, n1, "data transform input dimension does not match data dimension")
     } else
     if n2 != estimator.Dim() {
-      return fmt.Errorf("data transform output dimension does not match estimator dimension")
+      return NewDimensionError(estimator.Dim(), n2, "data transform output dimension does not match estimator dimension")
     } else {
       m = n2
     }
   } else {
     if n != estimator.Dim() {
-      return fmt.Errorf("estimator dimension does not match data dimension")
+      return NewDimensionError(n, estimator.Dim(), "estimator dimension does not match data dimension")
     }
   }
   // temporary memory
@@ -118,17 +139,22 @@ func BatchEstimateOnSingleTrackData(config SessionConfig, estimator VectorBatchE
   if f != nil {
     y = NullDenseVector(estimator.ScalarType(), m)
   }
-  pool := threadpool.New(config.Threads, config.Threads*1000)
+  exec := opts.GetExecutionContext(config)
+  defer exec.Release()
+  pool := exec.Pool
 
   if err := estimator.Initialize(pool); err != nil {
     return err
   }
 
   for d := 0; d < len(data); d++ {
+    if err := ContextError(ctx); err != nil {
+      return err
+    }
     x := data[d]
 
     if x.Dim() != n {
-      return fmt.Errorf("dimension of observation %d does not match estimator dimension", d)
+      return NewDimensionError(n, x.Dim(), "dimension of observation %d does not match estimator dimension", d)
     }
     if f != nil {
       if err := f.Eval(y, x); err != nil {
@@ -148,21 +174,24 @@ func BatchEstimateOnSingleTrackData(config SessionConfig, estimator VectorBatchE
 
 /* -------------------------------------------------------------------------- */
 
-func BatchEstimateOnSingleTrack(config SessionConfig, estimator VectorBatchEstimator, track Track, step int, args ...interface{}) error {
-  var f SingleTrackBatchDataTransform
+// Progress events are sent to the callback given with WithProgress,
+// otherwise they are logged.
+func BatchEstimateOnSingleTrack(config SessionConfig, estimator VectorBatchEstimator, track Track, options ...Option) error {
+  return BatchEstimateOnSingleTrackContext(context.Background(), config, estimator, track, options...)
+}
 
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case SingleTrackBatchDataTransform:
-      f = a
-    }
+func BatchEstimateOnSingleTrackContext(ctx context.Context, config SessionConfig, estimator VectorBatchEstimator, track Track, options ...Option) error {
+  opts, err := ParseOptions("BatchEstimateOnSingleTrack", SingleTrackBatchTransformOption | StepOption | TrackOptions | ProgressOption, options); if err != nil {
+    return err
   }
+  f := opts.SingleTrackBatchTransform
+  track = opts.FilterTrack(track)
   binSize := config.BinSize
   if binSize == 0 {
     binSize = track.GetBinSize()
   }
   if binSize == 0 {
-    return fmt.Errorf("could not determine track bin size")
+    return NewBinSizeError(0, 0, "could not determine track bin size")
   }
 
   n := estimator.Dim()
@@ -171,22 +200,33 @@ func BatchEstimateOnSingleTrack(config SessionConfig, estimator VectorBatchEstim
   if f != nil {
     n1, n2 := f.Dims()
     if n2 != m {
-      return fmt.Errorf("data transform output dimension (%d) does not match estimator dimension (%d)", n2, m)
+      return NewDimensionError(m, n2, "data transform output dimension (%d) does not match estimator dimension (%d)", n2, m)
     }
     n = n1
   }
   // set default step size
+  step := opts.Step
   if step <= 0 {
     step = n
   }
-  // allocate matrix where track slices are copied to
-  x := NullDenseVector(estimator.ScalarType(), n)
+  // windows are placed at multiples of the step size,
+  // windows with masked regions are skipped
+  parameters := DefaultWindowParameters(n)
+  parameters.Step   = step
+  parameters.Anchor = WindowAnchorStart
+  parameters.NaN    = WindowSkipNaN
+
+  it, err := NewSingleTrackWindowIterator(estimator.ScalarType(), track, parameters); if err != nil {
+    return err
+  }
   // storage for transformed data
-  y := x
+  y := Vector(nil)
   if f != nil {
     y = NullDenseVector(estimator.ScalarType(), m)
   }
-  pool := threadpool.New(config.Threads, config.Threads*1000)
+  exec := opts.GetExecutionContext(config)
+  defer exec.Release()
+  pool := exec.Pool
 
   if err := estimator.Initialize(pool); err != nil {
     return err
@@ -198,61 +238,89 @@ func BatchEstimateOnSingleTrack(config SessionConfig, estimator VectorBatchEstim
   for _, length := range track.GetGenome().Lengths {
     L += length/binSize
   }
-  if config.Verbose >= 1 {
-    NewProgress(L, L).PrintStderr(l)
-  }
-  for _, name := range track.GetSeqNames() {
-    seq, err := track.GetSequence(name); if err != nil {
+  progress := NewNamedProgress("Estimating", L, L)
+  callback := GetProgressCallback(config, opts.Progress)
+  progress.Report(callback, l, "")
+  for it.NextSequence() {
+    if err := ContextError(ctx); err != nil {
       return err
     }
-    // launch jobs
-  LOOP_SEQUENCE:
-    for i := 0; i < seq.NBins()-n; i += step {
-      // copy track slice to x and check for
-      // masked regions
-      for j := 0; j < n; j++ {
-        if math.IsNaN(seq.AtBin(i+j)) {
-          continue LOOP_SEQUENCE
-        }
-        x.At(j).SetFloat64(seq.AtBin(i+j))
-      }
+    windows := it.Sequence()
+    // reserve memory for the sequence
+    if err := exec.Memory.Acquire(ctx, windows.Bytes()); err != nil {
+      return err
+    }
+    windows.Load()
+
+    for k := 0; k < windows.Len(); k++ {
+      x := windows.Window(k).Vector
       if f != nil {
         if err := f.Eval(y, x); err != nil {
+          exec.Memory.Release(windows.Bytes())
           return err
         }
+        x = y
+      }
+      if err := estimator.NewObservation(x, nil, pool); err != nil {
+        exec.Memory.Release(windows.Bytes())
+        return err
       }
-      estimator.NewObservation(y, nil, pool)
     }
-    l += seq.NBins()
+    exec.Memory.Release(windows.Bytes())
 
-    if config.Verbose >= 1 {
-      NewProgress(L, L).PrintStderr(l)
-    }
-  }
+    l += windows.NBins()
 
+    progress.Report(callback, l, windows.Seqname)
+  }
+  if err := it.Err(); err != nil {
+    return err
+  }
   return nil
 }
 
-func EstimateOnSingleTrack(config SessionConfig, estimator VectorEstimator, track Track, args ...interface{}) error {
+// Estimate a model of variable dimension, such as a hidden Markov model, on
+// all sequences of a track. With the WithChunks option, sequences are split
+// into non-overlapping chunks that are passed to the estimator as separate
+// observations, which allows to parallelize the E-step over chunks. The
+// overlap is not used, since bins would be counted twice. For models with
+// independent observations the result is exact, whereas hidden Markov
+// models ignore transitions between chunks.
+func EstimateOnSingleTrack(config SessionConfig, estimator VectorEstimator, track Track, options ...Option) error {
+  return EstimateOnSingleTrackContext(context.Background(), config, estimator, track, options...)
+}
+
+func EstimateOnSingleTrackContext(ctx context.Context, config SessionConfig, estimator VectorEstimator, track Track, options ...Option) error {
   if estimator.Dim() != -1 {
-    return fmt.Errorf("estimator has wrong dimension (expected variable dimension, but estimator has dimension `%d'", estimator.Dim())
+    return NewDimensionError(-1, estimator.Dim(), "estimator has wrong dimension (expected variable dimension, but estimator has dimension `%d')", estimator.Dim())
   }
-  var f SingleTrackDataTransform
-
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case SingleTrackDataTransform:
-      f = a
-    }
+  opts, err := ParseOptions("EstimateOnSingleTrack", SingleTrackTransformOption | ChunkOption | TrackOptions, options); if err != nil {
+    return err
+  }
+  f := opts.SingleTrackTransform
+  track = opts.FilterTrack(track)
+  exec := opts.GetExecutionContext(config)
+  defer exec.Release()
+  pool := exec.Pool
+
+  // reserve memory for all sequences until the estimation is done
+  bytes := int64(0)
+  for _, length := range track.GetGenome().Lengths {
+    bytes += 8*int64(length/track.GetBinSize())
+  }
+  if err := exec.Memory.Acquire(ctx, bytes); err != nil {
+    return err
   }
-  pool := threadpool.New(config.Threads, config.Threads*1000)
+  defer exec.Memory.Release(bytes)
 
   x := []ConstVector{}
   // collect sequences
   for _, name := range track.GetSeqNames() {
-    seq, err := track.GetSequence(name); if err != nil {
+    if err := ContextError(ctx); err != nil {
       return err
     }
+    seq, err := track.GetSequence(name); if err != nil {
+      return SequenceError{Seqname: name, Err: err}
+    }
     y := NullDenseVector(estimator.ScalarType(), seq.NBins())
     for i := 0; i < seq.NBins(); i++ {
       y.At(i).SetFloat64(seq.AtBin(i))
@@ -260,7 +328,13 @@ func EstimateOnSingleTrack(config SessionConfig, estimator VectorEstimator, trac
     if f != nil {
       y = f.Eval(y)
     }
-    x = append(x, y)
+    // chunks are passed as separate observations to the estimator
+    for _, chunk := range SplitSequence(y.Dim(), opts.ChunkSize, 0) {
+      x = append(x, y.Slice(chunk.From, chunk.To))
+    }
+  }
+  if err := ContextError(ctx); err != nil {
+    return err
   }
   if err := estimator.EstimateOnData(x, nil, pool); err != nil {
     return err
@@ -271,66 +345,30 @@ func EstimateOnSingleTrack(config SessionConfig, estimator VectorEstimator, trac
 /* utility
  * -------------------------------------------------------------------------- */
 
-func ImportAndEstimateOnSingleTrack(config SessionConfig, estimator VectorEstimator, trackFile string, args ...interface{}) error {
-  // default parameters
-  var args_new []interface{}
-  var seqnames map[string]bool
-
-  // parse optional arguments
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case []string:
-      seqnames = make(map[string]bool)
-      for _, name := range a {
-        seqnames[name] = true
-      }
-    default:
-      args_new = append(args_new, arg)
-    }
-  }
+func ImportAndEstimateOnSingleTrack(config SessionConfig, estimator VectorEstimator, trackFile string, options ...Option) error {
+  return ImportAndEstimateOnSingleTrackContext(context.Background(), config, estimator, trackFile, options...)
+}
 
+func ImportAndEstimateOnSingleTrackContext(ctx context.Context, config SessionConfig, estimator VectorEstimator, trackFile string, options ...Option) error {
   if track, err := ImportLazyTrack(config, trackFile); err != nil {
     return err
   } else {
     defer track.Close()
 
-    if seqnames != nil {
-      track.FilterGenome(func(name string, length int) bool {
-        return seqnames[name]
-      })
-    }
-    return EstimateOnSingleTrack(config, estimator, track, args_new...)
+    return EstimateOnSingleTrackContext(ctx, config, estimator, track, options...)
   }
 }
 
-func ImportAndBatchEstimateOnSingleTrack(config SessionConfig, estimator VectorBatchEstimator, trackFile string, step int, args ...interface{}) error {
-  // default parameters
-  var args_new []interface{}
-  var seqnames map[string]bool
-
-  // parse optional arguments
-  for _, arg := range args {
-    switch a := arg.(type) {
-    case []string:
-      seqnames = make(map[string]bool)
-      for _, name := range a {
-        seqnames[name] = true
-      }
-    default:
-      args_new = append(args_new, arg)
-    }
-  }
+func ImportAndBatchEstimateOnSingleTrack(config SessionConfig, estimator VectorBatchEstimator, trackFile string, options ...Option) error {
+  return ImportAndBatchEstimateOnSingleTrackContext(context.Background(), config, estimator, trackFile, options...)
+}
 
+func ImportAndBatchEstimateOnSingleTrackContext(ctx context.Context, config SessionConfig, estimator VectorBatchEstimator, trackFile string, options ...Option) error {
   if track, err := ImportLazyTrack(config, trackFile); err != nil {
     return err
   } else {
     defer track.Close()
 
-    if seqnames != nil {
-      track.FilterGenome(func(name string, length int) bool {
-        return seqnames[name]
-      })
-    }
-    return BatchEstimateOnSingleTrack(config, estimator, track, step, args_new...)
+    return BatchEstimateOnSingleTrackContext(ctx, config, estimator, track, options...)
   }
 }
@@ -16,6 +16,7 @@ import   "github.com/pborman/getopt"
 import . "github.com/pbenner/ngstat/config"
 import . "github.com/pbenner/ngstat/classification"
 import . "github.com/pbenner/ngstat/estimation"
+import   "github.com/pbenner/ngstat/ngstatPlugin"
 import . "github.com/pbenner/ngstat/track"
 
 import . "github.com/pbenner/autodiff/statistics"
@@ -33,6 +34,10 @@ import . "github.com/pbenner/autodiff"
 
 var ConfigFilename = "config.json"
 
+var Manifest = ngstatPlugin.NewManifest("peakCaller", "1.0.0",
+  ngstatPlugin.Function{"LearnModel", "estimate a mixture model on a single track", "LearnModel <OUTPUT.json> <INPUT.bw>"},
+  ngstatPlugin.Function{"CallPeaks",  "compute posterior peak probabilities", "CallPeaks [--components=LIST] [--model=FILE] <OUTPUT.bw> <INPUT.bw>"})
+
 /* -------------------------------------------------------------------------- */
 
 func newEstimator(config SessionConfig) VectorEstimator {
@@ -16,6 +16,7 @@ import   "github.com/pborman/getopt"
 import . "github.com/pbenner/ngstat/config"
 import . "github.com/pbenner/ngstat/classification"
 import . "github.com/pbenner/ngstat/estimation"
+import   "github.com/pbenner/ngstat/ngstatPlugin"
 import . "github.com/pbenner/ngstat/track"
 
 import . "github.com/pbenner/autodiff/statistics"
@@ -33,6 +34,10 @@ import . "github.com/pbenner/autodiff"
 
 var ConfigFilename = "config.json"
 
+var Manifest = ngstatPlugin.NewManifest("peakCaller", "1.0.0",
+  ngstatPlugin.Function{"LearnModel", "estimate mixture models on treatment and control tracks", "LearnModel <treatment|control> <OUTPUT.json> <INPUT.bw>"},
+  ngstatPlugin.Function{"CallPeaks",  "compute posterior peak probabilities", "CallPeaks [--model-treatment=FILE] [--model-control=FILE] <OUTPUT.bw> <TREATMENT.bw> <CONTROL.bw>"})
+
 /* -------------------------------------------------------------------------- */
 
 func newEstimatorTreatment(config SessionConfig) VectorEstimator {
@@ -147,18 +152,17 @@ func callPeaks(config SessionConfig, filenameOut, filenameIn1, filenameIn2 strin
   scalarClassifier2 := scalarClassifier.MixturePosterior{mixture2, k2}
   vectorClassifier2 := vectorClassifier.ScalarBatchIid{scalarClassifier2, 1}
 
-  result1, err := ImportAndBatchClassifySingleTrack(config, vectorClassifier1, filenameIn1); if err != nil {
-    log.Fatal(err)
-  }
-  result2, err := ImportAndBatchClassifySingleTrack(config, vectorClassifier2, filenameIn2); if err != nil {
+  // posterior probability of a peak in the treatment but not in the control,
+  // which is computed in a single pass over both tracks
+  ensemble, err := NewMatrixBatchEnsemble(EnsembleFunc(func(x []float64) float64 {
+    return math.Exp(x[0])*(1.0-math.Exp(x[1]))
+  }), vectorClassifier1, vectorClassifier2); if err != nil {
     log.Fatal(err)
   }
-  if err := (GenericMutableTrack{result1}).MapList([]Track{result1, result2}, func(seqname string, position int, values... float64) float64 {
-    return math.Exp(values[0])*(1.0-math.Exp(values[1]))
-  }); err != nil {
+  result, err := ImportAndBatchClassifyEnsemble(config, ensemble, []string{filenameIn1, filenameIn2}); if err != nil {
     log.Fatal(err)
   }
-  return result1
+  return result
 }
 
 /* -------------------------------------------------------------------------- */
@@ -1,12 +1,15 @@
 module github.com/pbenner/ngstat
 
-go 1.13
+go 1.18
 
 require (
-	github.com/go-sql-driver/mysql v1.5.0 // indirect
+	github.com/BurntSushi/toml v1.3.2
 	github.com/pbenner/autodiff v1.0.0
 	github.com/pbenner/gonetics v0.0.0-20200513132454-40fc6f7ffc3c
 	github.com/pbenner/smartBinning v0.0.0-20180325163147-f3f37e2c46b2
 	github.com/pbenner/threadpool v0.0.0-20191122191339-0302c226b91e
 	github.com/pborman/getopt v0.0.0-20190409184431-ee0cd42419d3
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/go-sql-driver/mysql v1.5.0 // indirect
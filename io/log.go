@@ -0,0 +1,310 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package io
+
+/* -------------------------------------------------------------------------- */
+
+import   "bytes"
+import   "encoding/json"
+import   "fmt"
+import   "io"
+import   "os"
+import   "sync"
+import   "time"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/utility"
+
+/* -------------------------------------------------------------------------- */
+
+// Log records are written either as plain text or, if the `Log Format' of
+// the session config is `json', as one json object per line, i.e.
+//   {"time":"...","level":"info","msg":"Reading track `a.bw'","input":"a.bw","status":"done","duration":0.12}
+// Records contain key/value pairs given by the caller and the LogFields of
+// the config. In text mode only the message is printed, prefixed by the
+// LogFields of the config.
+
+type LogLevel int
+
+const (
+  LogLevelError LogLevel = iota
+  LogLevelWarning
+  LogLevelInfo
+  LogLevelDebug
+)
+
+func (level LogLevel) String() string {
+  switch level {
+  case LogLevelError:
+    return "error"
+  case LogLevelWarning:
+    return "warning"
+  case LogLevelInfo:
+    return "info"
+  default:
+    return "debug"
+  }
+}
+
+// Writer used for all log records.
+var LogWriter io.Writer = os.Stderr
+
+var logMutex sync.Mutex
+
+/* -------------------------------------------------------------------------- */
+
+// Errors and warnings are always logged, info messages require verbose
+// level 1 and debug messages verbose level 2.
+func logEnabled(config SessionConfig, level LogLevel) bool {
+  return level <= LogLevelWarning || config.Verbose >= int(level) - int(LogLevelWarning)
+}
+
+func logJson(config SessionConfig) bool {
+  return config.LogFormat == "json"
+}
+
+// Create a json log record. Later keys override earlier keys.
+func logRecord(config SessionConfig, level LogLevel, msg string, keyvals []interface{}) []byte {
+  var buffer bytes.Buffer
+  keys   := []string{"time", "level", "msg"}
+  values := map[string]interface{}{
+    "time" : time.Now().Format(time.RFC3339Nano),
+    "level": level.String(),
+    "msg"  : msg }
+  add := func(keyvals []interface{}) {
+    for i := 0; i < len(keyvals); i += 2 {
+      key := fmt.Sprint(keyvals[i])
+      var value interface{}
+      if i+1 < len(keyvals) {
+        value = keyvals[i+1]
+      }
+      if err, ok := value.(error); ok {
+        value = err.Error()
+      }
+      if _, ok := values[key]; !ok {
+        keys = append(keys, key)
+      }
+      values[key] = value
+    }
+  }
+  add(config.LogFields)
+  add(keyvals)
+  buffer.WriteString("{")
+  for i, key := range keys {
+    k, _ := json.Marshal(key)
+    v, err := json.Marshal(values[key]); if err != nil {
+      v, _ = json.Marshal(fmt.Sprint(values[key]))
+    }
+    if i > 0 {
+      buffer.WriteString(",")
+    }
+    buffer.Write(k)
+    buffer.WriteString(":")
+    buffer.Write(v)
+  }
+  buffer.WriteString("}\n")
+  return buffer.Bytes()
+}
+
+// Prefix of text log messages containing the LogFields of the config, i.e.
+// `[step=estimate] '.
+func logPrefix(config SessionConfig) string {
+  if len(config.LogFields) == 0 {
+    return ""
+  }
+  var buffer bytes.Buffer
+  buffer.WriteString("[")
+  for i := 0; i < len(config.LogFields); i += 2 {
+    if i > 0 {
+      buffer.WriteString(" ")
+    }
+    if i+1 < len(config.LogFields) {
+      fmt.Fprintf(&buffer, "%v=%v", config.LogFields[i], config.LogFields[i+1])
+    } else {
+      fmt.Fprintf(&buffer, "%v", config.LogFields[i])
+    }
+  }
+  buffer.WriteString("] ")
+  return buffer.String()
+}
+
+func logWrite(b []byte) {
+  logMutex.Lock()
+  defer logMutex.Unlock()
+  LogWriter.Write(b)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Write a log record with the given message and key/value pairs.
+func Log(config SessionConfig, level LogLevel, msg string, keyvals ...interface{}) {
+  logReport(config, level, msg, keyvals, time.Time{}, "")
+  if !logEnabled(config, level) {
+    return
+  }
+  if logJson(config) {
+    logWrite(logRecord(config, level, msg, keyvals))
+  } else {
+    switch level {
+    case LogLevelError, LogLevelWarning:
+      logWrite([]byte(fmt.Sprintf("%s%s: %s\n", logPrefix(config), level, msg)))
+    default:
+      logWrite([]byte(fmt.Sprintf("%s%s\n", logPrefix(config), msg)))
+    }
+  }
+}
+
+func LogError(config SessionConfig, msg string, keyvals ...interface{}) {
+  Log(config, LogLevelError, msg, keyvals...)
+}
+
+func LogWarning(config SessionConfig, msg string, keyvals ...interface{}) {
+  Log(config, LogLevelWarning, msg, keyvals...)
+}
+
+func LogInfo(config SessionConfig, msg string, keyvals ...interface{}) {
+  Log(config, LogLevelInfo, msg, keyvals...)
+}
+
+func LogDebug(config SessionConfig, msg string, keyvals ...interface{}) {
+  Log(config, LogLevelDebug, msg, keyvals...)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// A task is an operation with a duration, i.e. reading a track. In text
+// mode the message is printed when the task begins and `done' or `failed'
+// when it ends. In json mode a single record is written when the task
+// ends, which contains the status and duration (in seconds) of the task.
+// Tasks are recorded in the run report with their timings, where values
+// of `input' and `output' keys are recorded as inputs and outputs.
+type LogTask struct {
+  config  SessionConfig
+  level   LogLevel
+  msg     string
+  keyvals []interface{}
+  start   time.Time
+}
+
+func BeginTask(config SessionConfig, msg string, keyvals ...interface{}) LogTask {
+  task := LogTask{config, LogLevelInfo, msg, keyvals, time.Now()}
+  if logEnabled(config, task.level) && !logJson(config) {
+    logWrite([]byte(fmt.Sprintf("%s%s... ", logPrefix(config), msg)))
+  }
+  return task
+}
+
+func (task LogTask) end(status string, keyvals []interface{}) {
+  duration := time.Since(task.start)
+  keyvals   = append(append([]interface{}{}, task.keyvals...), keyvals...)
+  logReport(task.config, task.level, task.msg, keyvals, task.start, status)
+  if !logEnabled(task.config, task.level) {
+    return
+  }
+  if logJson(task.config) {
+    keyvals = append(keyvals, "status", status, "duration", duration.Seconds())
+    logWrite(logRecord(task.config, task.level, task.msg, keyvals))
+  } else {
+    logWrite([]byte(status + "\n"))
+  }
+}
+
+// Mark the task as successful, additional key/value pairs are added to
+// the log record.
+func (task LogTask) Done(keyvals ...interface{}) {
+  task.end("done", keyvals)
+}
+
+// Mark the task as failed. The error is added to the json log record.
+func (task LogTask) Failed(err error) {
+  if err != nil {
+    task.end("failed", []interface{}{"error", err})
+  } else {
+    task.end("failed", nil)
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Progress callback that writes progress events to the log. In text mode a
+// progress bar is printed for each named operation, in json mode a record
+// with the fraction of finished steps, rate (steps per second), elapsed time
+// and ETA (in seconds, -1 if unknown).
+type ProgressLogger struct {
+  Config SessionConfig
+}
+
+var logMultiProgress = NewMultiProgress(os.Stderr)
+
+func NewProgressLogger(config SessionConfig) ProgressLogger {
+  return ProgressLogger{config}
+}
+
+func (logger ProgressLogger) ProgressUpdate(event ProgressEvent) {
+  if !logEnabled(logger.Config, LogLevelInfo) {
+    return
+  }
+  if logJson(logger.Config) {
+    keyvals := []interface{}{}
+    if event.Seqname != "" {
+      keyvals = append(keyvals, "chromosome", event.Seqname)
+    }
+    eta := -1.0
+    if event.ETA >= 0 {
+      eta = event.ETA.Seconds()
+    }
+    keyvals = append(keyvals,
+      "progress", event.Fraction(),
+      "done",     event.Done,
+      "total",    event.Total,
+      "rate",     event.Rate,
+      "elapsed",  event.Elapsed.Seconds(),
+      "eta",      eta)
+    logWrite(logRecord(logger.Config, LogLevelInfo, event.Name, keyvals))
+  } else {
+    logMutex.Lock()
+    defer logMutex.Unlock()
+    logMultiProgress.Writer = LogWriter
+    logMultiProgress.ProgressUpdate(event)
+  }
+}
+
+// Return the given progress callback or, if it is nil, a
+// ProgressLogger.
+func GetProgressCallback(config SessionConfig, callback ProgressCallback) ProgressCallback {
+  if callback != nil {
+    return callback
+  }
+  return NewProgressLogger(config)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Writer that converts each line into a log record, which allows to redirect
+// the standard logger (i.e. log.Fatal) to the logging subsystem.
+type LogLineWriter struct {
+  Config SessionConfig
+  Level  LogLevel
+}
+
+func (w LogLineWriter) Write(p []byte) (int, error) {
+  for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+    Log(w.Config, w.Level, string(line))
+  }
+  return len(p), nil
+}
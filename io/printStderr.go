@@ -18,15 +18,26 @@ package io
 
 /* -------------------------------------------------------------------------- */
 
+import   "bytes"
 import   "fmt"
-import   "os"
 
 import . "github.com/pbenner/ngstat/config"
 
 /* -------------------------------------------------------------------------- */
 
+// Print a formatted message if the verbose level is at least `level'. This
+// function is kept for compatibility, new code should use Log or BeginTask.
+// In json mode each message is written as a separate record.
 func PrintStderr(config SessionConfig, level int, format string, args ...interface{}) {
-  if config.Verbose >= level {
-    fmt.Fprintf(os.Stderr, format, args...)
+  if config.Verbose < level {
+    return
+  }
+  if logJson(config) {
+    msg := string(bytes.TrimSpace([]byte(fmt.Sprintf(format, args...))))
+    if msg != "" {
+      logWrite(logRecord(config, LogLevel(int(LogLevelWarning) + level), msg, nil))
+    }
+  } else {
+    logWrite([]byte(fmt.Sprintf(format, args...)))
   }
 }
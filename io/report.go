@@ -0,0 +1,258 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package io
+
+/* -------------------------------------------------------------------------- */
+
+import   "bytes"
+import   "fmt"
+import   "io"
+import   "sync"
+import   "time"
+
+import . "github.com/pbenner/ngstat/config"
+
+/* -------------------------------------------------------------------------- */
+
+// A task recorded by BeginTask, durations are given in seconds.
+type RunReportTask struct {
+  Message  string
+  Fields   map[string]interface{} `json:",omitempty"`
+  Start    time.Time
+  Duration float64
+  Status   string
+}
+
+// A pipeline step, where status is one of `done', `failed' or `skipped'.
+type RunReportStep struct {
+  Name     string
+  Command  string
+  Inputs   []string
+  Outputs  []string
+  Start    time.Time
+  Duration float64
+  Status   string
+  Error    string `json:",omitempty"`
+}
+
+// Models used by a classification, where Seqnames and Classes map
+// sequences and region classes to model names. An empty model name means
+// that the sequence or region was not classified. Regions is the number of
+// regions imported from RegionsFile.
+type RunReportModelAssignment struct {
+  Function    string
+  Default     string
+  Seqnames    map[string]string `json:",omitempty"`
+  Classes     map[string]string `json:",omitempty"`
+  Regions     int               `json:",omitempty"`
+  RegionsFile string            `json:",omitempty"`
+}
+
+// A machine-readable report of a single run, which records timings, inputs,
+// outputs and the config used. Inputs and outputs are collected from
+// `input' and `output' fields of log tasks and from pipeline steps.
+type RunReport struct {
+  Command       []string
+  Version       string
+  Start         time.Time
+  End           time.Time
+  Duration      float64
+  Status        string
+  Error         string            `json:",omitempty"`
+  Config        SessionConfig
+  ConfigSources map[string]string `json:"Config Sources"`
+  Inputs        []string
+  Outputs       []string
+  Warnings      []string          `json:",omitempty"`
+  Tasks         []RunReportTask
+  Steps         []RunReportStep   `json:",omitempty"`
+  Models        []RunReportModelAssignment `json:",omitempty"`
+  mutex         sync.Mutex
+}
+
+/* -------------------------------------------------------------------------- */
+
+var runReport      *RunReport
+var runReportMutex  sync.Mutex
+
+// Set the report that records all tasks, nil disables recording.
+func SetRunReport(report *RunReport) {
+  runReportMutex.Lock()
+  defer runReportMutex.Unlock()
+  runReport = report
+}
+
+func GetRunReport() *RunReport {
+  runReportMutex.Lock()
+  defer runReportMutex.Unlock()
+  return runReport
+}
+
+// Record a log record in the current run report. Records with a status are
+// tasks, all other records are only recorded if they are warnings.
+func logReport(config SessionConfig, level LogLevel, msg string, keyvals []interface{}, start time.Time, status string) {
+  report := GetRunReport()
+  if report == nil {
+    return
+  }
+  if status == "" {
+    if level == LogLevelWarning {
+      report.mutex.Lock()
+      report.Warnings = append(report.Warnings, msg)
+      report.mutex.Unlock()
+    }
+    return
+  }
+  task := RunReportTask{msg, nil, start, time.Since(start).Seconds(), status}
+  for _, kv := range [][]interface{}{config.LogFields, keyvals} {
+    for i := 0; i+1 < len(kv); i += 2 {
+      key   := fmt.Sprint(kv[i])
+      value := kv[i+1]
+      if err, ok := value.(error); ok {
+        value = err.Error()
+      }
+      if task.Fields == nil {
+        task.Fields = make(map[string]interface{})
+      }
+      task.Fields[key] = value
+      if status != "done" {
+        continue
+      }
+      switch key {
+      case "input":
+        report.AddInput (fmt.Sprint(value))
+      case "output":
+        report.AddOutput(fmt.Sprint(value))
+      }
+    }
+  }
+  report.mutex.Lock()
+  report.Tasks = append(report.Tasks, task)
+  report.mutex.Unlock()
+}
+
+/* -------------------------------------------------------------------------- */
+
+func NewRunReport(config SessionConfig, args []string) *RunReport {
+  return &RunReport{
+    Command      : args,
+    Version      : Version,
+    Start        : time.Now(),
+    Status       : "running",
+    Config       : config,
+    ConfigSources: config.Sources,
+    Inputs       : []string{},
+    Outputs      : []string{},
+    Tasks        : []RunReportTask{} }
+}
+
+func appendUnique(s []string, value string) []string {
+  for _, v := range s {
+    if v == value {
+      return s
+    }
+  }
+  return append(s, value)
+}
+
+func (report *RunReport) AddInput(filename string) {
+  report.mutex.Lock()
+  defer report.mutex.Unlock()
+  report.Inputs = appendUnique(report.Inputs, filename)
+}
+
+func (report *RunReport) AddOutput(filename string) {
+  report.mutex.Lock()
+  defer report.mutex.Unlock()
+  report.Outputs = appendUnique(report.Outputs, filename)
+}
+
+// Record a pipeline step, inputs and outputs of executed steps are added to
+// the inputs and outputs of the report.
+func (report *RunReport) AddStep(step RunReportStep) {
+  if step.Status == "done" {
+    for _, input := range step.Inputs {
+      report.AddInput(input)
+    }
+    for _, output := range step.Outputs {
+      report.AddOutput(output)
+    }
+  }
+  report.mutex.Lock()
+  defer report.mutex.Unlock()
+  report.Steps = append(report.Steps, step)
+}
+
+// Record the models used by a classification.
+func (report *RunReport) AddModelAssignment(assignment RunReportModelAssignment) {
+  report.mutex.Lock()
+  defer report.mutex.Unlock()
+  report.Models = append(report.Models, assignment)
+}
+
+// Set end time and status of the run.
+func (report *RunReport) Finish(err error) {
+  report.mutex.Lock()
+  defer report.mutex.Unlock()
+  report.End      = time.Now()
+  report.Duration = report.End.Sub(report.Start).Seconds()
+  if err != nil {
+    report.Status = "failed"
+    report.Error  = err.Error()
+  } else {
+    report.Status = "done"
+    report.Error  = ""
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+func (report *RunReport) Import(reader io.Reader, args... interface{}) error {
+  report.mutex.Lock()
+  defer report.mutex.Unlock()
+  return JsonImport(reader, report)
+}
+
+func (report *RunReport) Export(writer io.Writer) error {
+  report.mutex.Lock()
+  defer report.mutex.Unlock()
+  return JsonExport(writer, report)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// A writer that marks the run as failed and exports the report to filename
+// before passing p on to w. It is used as output of the standard logger, so
+// that a report is written if the program terminates with log.Fatal.
+type runReportWriter struct {
+  report   *RunReport
+  writer    io.Writer
+  filename  string
+}
+
+func (w runReportWriter) Write(p []byte) (int, error) {
+  w.report.Finish(fmt.Errorf("%s", bytes.TrimSpace(p)))
+  if err := ExportFile(w.report, w.filename); err != nil {
+    fmt.Fprintf(w.writer, "writing run report `%s' failed: %v\n", w.filename, err)
+  }
+  return w.writer.Write(p)
+}
+
+func (report *RunReport) ExitWriter(w io.Writer, filename string) io.Writer {
+  return runReportWriter{report, w, filename}
+}
@@ -0,0 +1,80 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package ngstatPlugin
+
+/* -------------------------------------------------------------------------- */
+
+import   "debug/buildinfo"
+import   "fmt"
+import   "runtime/debug"
+import   "strings"
+
+/* -------------------------------------------------------------------------- */
+
+// Compare the build information of a plugin with the build information of
+// the running binary. Go's plugin package refuses to load plugins that were
+// built with a different toolchain or different versions of shared
+// packages, but does not tell which dependency caused the problem. This
+// function checks toolchain and module versions in advance and reports all
+// differences.
+func CheckBuildInfo(filename string) error {
+  pInfo, err := buildinfo.ReadFile(filename); if err != nil {
+    return fmt.Errorf("reading build information of plugin `%s' failed: %v", filename, err)
+  }
+  hInfo, ok := debug.ReadBuildInfo(); if !ok {
+    // binary was built without module support, nothing to compare
+    return nil
+  }
+  return compareBuildInfo(filename, pInfo, hInfo)
+}
+
+func compareBuildInfo(filename string, pInfo, hInfo *debug.BuildInfo) error {
+  mismatches := []string{}
+  if pInfo.GoVersion != hInfo.GoVersion {
+    mismatches = append(mismatches, fmt.Sprintf("go toolchain: plugin built with %s, ngstat built with %s", pInfo.GoVersion, hInfo.GoVersion))
+  }
+  // collect module versions of the running binary
+  modules := make(map[string]*debug.Module)
+  modules[hInfo.Main.Path] = &hInfo.Main
+  for _, m := range hInfo.Deps {
+    if m.Replace != nil {
+      modules[m.Path] = m.Replace
+    } else {
+      modules[m.Path] = m
+    }
+  }
+  pModules := append([]*debug.Module{&pInfo.Main}, pInfo.Deps...)
+  for _, m := range pModules {
+    if m.Replace != nil {
+      m = m.Replace
+    }
+    h, ok := modules[m.Path]; if !ok {
+      continue
+    }
+    // development builds carry no version information
+    if m.Version == "(devel)" || h.Version == "(devel)" {
+      continue
+    }
+    if m.Version != h.Version || (m.Sum != "" && h.Sum != "" && m.Sum != h.Sum) {
+      mismatches = append(mismatches, fmt.Sprintf("module `%s': plugin built with %s, ngstat built with %s", m.Path, m.Version, h.Version))
+    }
+  }
+  if len(mismatches) > 0 {
+    return fmt.Errorf("plugin `%s' is incompatible with this ngstat binary:\n  %s", filename, strings.Join(mismatches, "\n  "))
+  }
+  return nil
+}
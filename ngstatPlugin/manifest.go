@@ -0,0 +1,128 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package ngstatPlugin
+
+/* -------------------------------------------------------------------------- */
+
+import   "bytes"
+import   "fmt"
+import   "strconv"
+import   "strings"
+
+import . "github.com/pbenner/ngstat/config"
+
+/* -------------------------------------------------------------------------- */
+
+type Function struct {
+  Name        string
+  Description string
+  Usage       string
+}
+
+// A manifest describes a plugin and the functions it provides. Plugins
+// should export a variable called `Manifest', i.e.
+//   var Manifest = ngstatPlugin.NewManifest("peakCaller", "1.0.0",
+//     ngstatPlugin.Function{"CallPeaks", "call peaks", "CallPeaks <OUTPUT.bw> <INPUT.bw>"})
+type Manifest struct {
+  Name          string
+  Version       string
+  // version of ngstat the plugin was built against
+  NgstatVersion string
+  Functions   []Function
+}
+
+// Create a new manifest. The ngstat version is set to the version of the
+// ngstat package the plugin is compiled with.
+func NewManifest(name, version string, functions ...Function) Manifest {
+  return Manifest{
+    Name         : name,
+    Version      : version,
+    NgstatVersion: Version,
+    Functions    : functions }
+}
+
+/* -------------------------------------------------------------------------- */
+
+func (manifest Manifest) Lookup(name string) (Function, bool) {
+  for _, f := range manifest.Functions {
+    if f.Name == name {
+      return f, true
+    }
+  }
+  return Function{}, false
+}
+
+func (manifest Manifest) FunctionNames() []string {
+  r := make([]string, len(manifest.Functions))
+  for i, f := range manifest.Functions {
+    r[i] = f.Name
+  }
+  return r
+}
+
+// Check if the plugin can be executed by the given version of ngstat. Major
+// versions must be identical and the plugin must not require a newer minor
+// version.
+func (manifest Manifest) CheckCompatibility(version string) error {
+  v1, err := parseVersion(manifest.NgstatVersion); if err != nil {
+    return fmt.Errorf("plugin `%s' has invalid ngstat version: %v", manifest.Name, err)
+  }
+  v2, err := parseVersion(version); if err != nil {
+    return err
+  }
+  if v1[0] != v2[0] || v1[1] > v2[1] {
+    return fmt.Errorf("plugin `%s' was built against ngstat %s, which is incompatible with ngstat %s", manifest.Name, manifest.NgstatVersion, version)
+  }
+  return nil
+}
+
+func (manifest Manifest) String() string {
+  var buffer bytes.Buffer
+
+  fmt.Fprintf(&buffer, "Plugin: %s\n", manifest.Name)
+  fmt.Fprintf(&buffer, " -> Version        : %s\n", manifest.Version)
+  fmt.Fprintf(&buffer, " -> Ngstat Version : %s\n", manifest.NgstatVersion)
+  fmt.Fprintf(&buffer, "Functions:\n")
+  for _, f := range manifest.Functions {
+    fmt.Fprintf(&buffer, " -> %s\n", f.Name)
+    if f.Description != "" {
+      fmt.Fprintf(&buffer, "      %s\n", f.Description)
+    }
+    if f.Usage != "" {
+      fmt.Fprintf(&buffer, "      Usage: %s\n", f.Usage)
+    }
+  }
+  return buffer.String()
+}
+
+/* -------------------------------------------------------------------------- */
+
+func parseVersion(version string) ([3]int, error) {
+  r := [3]int{}
+  fields := strings.Split(strings.TrimPrefix(version, "v"), ".")
+  if len(fields) != 3 {
+    return r, fmt.Errorf("invalid version `%s'", version)
+  }
+  for i, field := range fields {
+    if v, err := strconv.ParseInt(field, 10, 64); err != nil {
+      return r, fmt.Errorf("invalid version `%s'", version)
+    } else {
+      r[i] = int(v)
+    }
+  }
+  return r, nil
+}
@@ -0,0 +1,213 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package ngstatPlugin
+
+/* -------------------------------------------------------------------------- */
+
+import   "fmt"
+import   "io"
+import   "io/ioutil"
+import   "net"
+import   "net/rpc"
+import   "net/rpc/jsonrpc"
+import   "os"
+import   "os/exec"
+import   "path/filepath"
+import   "syscall"
+import   "time"
+
+import . "github.com/pbenner/ngstat/config"
+
+/* -------------------------------------------------------------------------- */
+
+// Time a plugin is given to connect to the socket after it is started.
+const ProcessConnectTimeout = 30*time.Second
+
+// Time a plugin is given to exit after the connection is closed, before it
+// is terminated with SIGTERM, and again before it is killed.
+const ProcessExitTimeout = 5*time.Second
+
+/* -------------------------------------------------------------------------- */
+
+// A plugin running as a separate process.
+type Process struct {
+  program  string
+  cmd     *exec.Cmd
+  client  *rpc.Client
+  tmpDir   string
+  exited   chan error
+}
+
+type pipeConn struct {
+  io.ReadCloser
+  io.WriteCloser
+}
+
+func (obj pipeConn) Close() error {
+  err1 := obj.WriteCloser.Close()
+  err2 := obj.ReadCloser .Close()
+  if err1 != nil {
+    return err1
+  }
+  return err2
+}
+
+// Start a plugin process. If socket is true, communication is established
+// through a Unix socket, otherwise stdin and stdout of the plugin are used.
+// The plugin's stderr is forwarded to ngstat's stderr.
+func StartProcess(program string, socket bool, args ...string) (*Process, error) {
+  p := Process{program: program, exited: make(chan error, 1)}
+  p.cmd = exec.Command(program, args...)
+  p.cmd.Stderr = os.Stderr
+
+  var conn     io.ReadWriteCloser
+  var listener net.Listener
+  if socket {
+    if dir, err := ioutil.TempDir("", "ngstat-plugin"); err != nil {
+      return nil, err
+    } else {
+      p.tmpDir = dir
+    }
+    filename := filepath.Join(p.tmpDir, "socket")
+    if l, err := net.Listen("unix", filename); err != nil {
+      p.cleanup()
+      return nil, err
+    } else {
+      listener = l
+    }
+    // do not wait forever for plugins that never connect
+    if err := listener.(*net.UnixListener).SetDeadline(time.Now().Add(ProcessConnectTimeout)); err != nil {
+      listener.Close()
+      p.cleanup()
+      return nil, err
+    }
+    defer listener.Close()
+    p.cmd.Env    = append(os.Environ(), fmt.Sprintf("%s=%s", SocketVariable, filename))
+    p.cmd.Stdout = os.Stderr
+  } else {
+    stdin, err := p.cmd.StdinPipe(); if err != nil {
+      return nil, err
+    }
+    stdout, err := p.cmd.StdoutPipe(); if err != nil {
+      return nil, err
+    }
+    conn = pipeConn{stdout, stdin}
+  }
+  if err := p.cmd.Start(); err != nil {
+    p.cleanup()
+    return nil, fmt.Errorf("starting plugin `%s' failed: %v", program, err)
+  }
+  go func() {
+    p.exited <- p.cmd.Wait()
+  }()
+  if socket {
+    // wait for the plugin to connect, or to exit
+    accepted := make(chan error, 1)
+    go func() {
+      c, err := listener.Accept()
+      conn = c
+      accepted <- err
+    }()
+    select {
+    case err := <-accepted:
+      if err != nil {
+        p.cmd.Process.Kill()
+        p.cleanup()
+        if e, ok := err.(net.Error); ok && e.Timeout() {
+          return nil, fmt.Errorf("plugin `%s' did not connect within %v", program, ProcessConnectTimeout)
+        }
+        return nil, err
+      }
+    case err := <-p.exited:
+      p.cleanup()
+      return nil, fmt.Errorf("plugin `%s' exited before connecting: %v", program, err)
+    }
+  }
+  p.client = rpc.NewClientWithCodec(jsonrpc.NewClientCodec(conn))
+  return &p, nil
+}
+
+func (p *Process) cleanup() {
+  if p.tmpDir != "" {
+    os.RemoveAll(p.tmpDir)
+  }
+}
+
+// Translate communication errors into a message that describes why the
+// plugin process terminated.
+func (p *Process) error(err error) error {
+  if _, ok := err.(rpc.ServerError); ok {
+    return err
+  }
+  // give the process some time to exit
+  select {
+  case e := <-p.exited:
+    p.exited <- e
+    if e == nil {
+      return fmt.Errorf("plugin `%s' terminated unexpectedly", p.program)
+    }
+    return fmt.Errorf("plugin `%s' terminated unexpectedly: %v", p.program, e)
+  case <-time.After(time.Second):
+    return fmt.Errorf("communication with plugin `%s' failed: %v", p.program, err)
+  }
+}
+
+func (p *Process) Manifest() (Manifest, error) {
+  manifest := Manifest{}
+  if err := p.client.Call("Plugin.Manifest", &Empty{}, &manifest); err != nil {
+    return manifest, p.error(err)
+  }
+  return manifest, nil
+}
+
+func (p *Process) Call(config SessionConfig, function string, args []string) error {
+  if err := p.client.Call("Plugin.Call", newCallArgs(function, config, args), &CallReply{}); err != nil {
+    return p.error(err)
+  }
+  return nil
+}
+
+// Wait at most for the given time for the plugin to exit. Returns true and
+// the exit status if the plugin exited.
+func (p *Process) wait(timeout time.Duration) (bool, error) {
+  select {
+  case err := <-p.exited:
+    p.exited <- err
+    return true, err
+  case <-time.After(timeout):
+    return false, nil
+  }
+}
+
+// Close the connection and wait for the plugin to exit. Plugins that do not
+// exit within ProcessExitTimeout are terminated with SIGTERM, and killed if
+// they still do not exit.
+func (p *Process) Close() error {
+  defer p.cleanup()
+  p.client.Close()
+  if ok, err := p.wait(ProcessExitTimeout); ok {
+    return err
+  }
+  p.cmd.Process.Signal(syscall.SIGTERM)
+  if ok, err := p.wait(ProcessExitTimeout); ok {
+    return fmt.Errorf("plugin `%s' did not exit and was terminated: %w", p.program, err)
+  }
+  p.cmd.Process.Kill()
+  err := <-p.exited
+  p.exited <- err
+  return fmt.Errorf("plugin `%s' did not exit and was killed: %w", p.program, err)
+}
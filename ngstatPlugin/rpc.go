@@ -0,0 +1,140 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package ngstatPlugin
+
+/* -------------------------------------------------------------------------- */
+
+import   "fmt"
+import   "io"
+import   "net"
+import   "net/rpc"
+import   "net/rpc/jsonrpc"
+import   "os"
+
+import . "github.com/pbenner/ngstat/config"
+
+/* -------------------------------------------------------------------------- */
+
+// Plugins may run as separate processes that communicate with ngstat using
+// JSON-RPC 1.0 (as implemented by net/rpc/jsonrpc). By default requests are
+// read from stdin and replies are written to stdout. If the environment
+// variable NGSTAT_PLUGIN_SOCKET is set, the plugin connects to the given
+// Unix socket instead. A plugin must provide the following methods:
+//   Plugin.Manifest(Empty)    -> Manifest
+//   Plugin.Call    (CallArgs) -> CallReply
+// Tracks are exchanged as files, i.e. file names are passed as arguments.
+// Tracks are not shared through memory, since plugins may be written in any
+// language and files work the same way on all platforms.
+const SocketVariable = "NGSTAT_PLUGIN_SOCKET"
+
+type Empty struct {}
+
+// Arguments of a function call. Sources and log fields of the config are
+// not part of its json representation and are passed separately, so that
+// the plugin receives the same config as ngstat.
+type CallArgs struct {
+  Function  string
+  Config    SessionConfig
+  Sources   map[string]string
+  LogFields []interface{}
+  Args      []string
+}
+
+func newCallArgs(function string, config SessionConfig, args []string) *CallArgs {
+  return &CallArgs{
+    Function : function,
+    Config   : config,
+    Sources  : config.Sources,
+    LogFields: config.LogFields,
+    Args     : args }
+}
+
+// Return the config of a call, including sources and log fields.
+func (args *CallArgs) SessionConfig() SessionConfig {
+  config := args.Config
+  config.Sources   = args.Sources
+  config.LogFields = args.LogFields
+  return config
+}
+
+type CallReply struct {
+}
+
+type Handler func(config SessionConfig, args []string) error
+
+/* server
+ * -------------------------------------------------------------------------- */
+
+type service struct {
+  manifest Manifest
+  handlers map[string]Handler
+}
+
+func (obj *service) Manifest(args *Empty, reply *Manifest) error {
+  *reply = obj.manifest
+  return nil
+}
+
+func (obj *service) Call(args *CallArgs, reply *CallReply) (err error) {
+  handler, ok := obj.handlers[args.Function]; if !ok {
+    return fmt.Errorf("plugin `%s' does not provide function `%s'", obj.manifest.Name, args.Function)
+  }
+  // report panics as errors, so that ngstat can print a proper message
+  defer func() {
+    if r := recover(); r != nil {
+      err = fmt.Errorf("function `%s' panicked: %v", args.Function, r)
+    }
+  }()
+  return handler(args.SessionConfig(), args.Args)
+}
+
+type stdioConn struct {
+  io.Reader
+  io.Writer
+}
+
+func (obj stdioConn) Close() error {
+  return nil
+}
+
+// Serve requests from ngstat until the connection is closed. Since stdout
+// may be used for communication, os.Stdout is redirected to stderr.
+func Serve(manifest Manifest, handlers map[string]Handler) error {
+  for _, f := range manifest.Functions {
+    if _, ok := handlers[f.Name]; !ok {
+      return fmt.Errorf("no handler for function `%s'", f.Name)
+    }
+  }
+  server := rpc.NewServer()
+  if err := server.RegisterName("Plugin", &service{manifest, handlers}); err != nil {
+    return err
+  }
+  var conn io.ReadWriteCloser
+  if socket := os.Getenv(SocketVariable); socket != "" {
+    if c, err := net.DialTimeout("unix", socket, ProcessConnectTimeout); err != nil {
+      return err
+    } else {
+      conn = c
+    }
+  } else {
+    conn = stdioConn{os.Stdin, os.Stdout}
+  }
+  os.Stdout = os.Stderr
+
+  server.ServeCodec(jsonrpc.NewServerCodec(conn))
+  return nil
+}
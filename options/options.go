@@ -0,0 +1,312 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package options
+
+/* -------------------------------------------------------------------------- */
+
+import "fmt"
+import "strings"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/track"
+import . "github.com/pbenner/ngstat/trackDataTransform"
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+// Set of options supported by a function.
+type OptionKind uint
+
+const (
+  SingleTrackTransformOption OptionKind = 1 << iota
+  SingleTrackBatchTransformOption
+  MultiTrackTransformOption
+  MultiTrackBatchTransformOption
+  SeqnamesOption
+  MaskOption
+  StepOption
+  ThreadsOption
+  ExecutionContextOption
+  ProgressOption
+  PaddingOption
+  AggregationOption
+  ChunkOption
+  RegionsOption
+)
+
+// Options common to all functions that operate on tracks.
+const TrackOptions = SeqnamesOption | MaskOption | ThreadsOption | ExecutionContextOption
+
+/* -------------------------------------------------------------------------- */
+
+// Optional argument of estimation and classification functions. Options are
+// created with the With* functions.
+type Option struct {
+  name  string
+  kind  OptionKind
+  apply func(*Options)
+  err   error
+}
+
+func (option Option) Name() string {
+  return option.name
+}
+
+func (option Option) Kind() OptionKind {
+  return option.kind
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Parsed options. Fields of options that are not given have their zero
+// value.
+type Options struct {
+  SingleTrackTransform      SingleTrackDataTransform
+  SingleTrackBatchTransform SingleTrackBatchDataTransform
+  MultiTrackTransform       MultiTrackDataTransform
+  MultiTrackBatchTransform  MultiTrackBatchDataTransform
+  Seqnames                  []string
+  Mask                      GRanges
+  Step                      int
+  Threads                   int
+  ExecutionContext         *ExecutionContext
+  Progress                  ProgressCallback
+  Padding                   WindowPadding
+  Aggregation               WindowAggregation
+  ChunkSize                 int
+  ChunkOverlap              int
+  Regions                   GRanges
+  // true if a padding option is given
+  hasPadding                bool
+}
+
+// Parse options of function fname, which supports all options in supported.
+// An error is returned if an option is invalid or not supported.
+func ParseOptions(fname string, supported OptionKind, options []Option) (Options, error) {
+  r := Options{}
+  for _, option := range options {
+    if option.apply == nil {
+      return r, NewArgumentError("%s: invalid option", fname)
+    }
+    if option.err != nil {
+      return r, fmt.Errorf("%s: option `%s': %w", fname, option.name, option.err)
+    }
+    if option.kind & supported == 0 {
+      return r, NewArgumentError("%s: option `%s' is not supported", fname, option.name)
+    }
+    option.apply(&r)
+  }
+  return r, nil
+}
+
+// Returns the execution context given as option, or a private context which
+// must be released by the caller. The number of threads of private contexts
+// is taken from the options or the session config.
+func (options Options) GetExecutionContext(config SessionConfig) *ExecutionContext {
+  if options.Threads > 0 {
+    return GetExecutionContext(options.Threads, options.ExecutionContext)
+  }
+  return GetExecutionContext(config.Threads, options.ExecutionContext)
+}
+
+// Returns the memory budget of the execution context given as option, or
+// nil (i.e. unlimited) if there is none.
+func (options Options) GetMemoryBudget() *MemoryBudget {
+  if options.ExecutionContext == nil {
+    return nil
+  }
+  return options.ExecutionContext.Memory
+}
+
+// Returns the padding given as option, or padding p if there is none.
+func (options Options) GetPadding(p WindowPadding) WindowPadding {
+  if options.hasPadding {
+    return options.Padding
+  }
+  return p
+}
+
+/* -------------------------------------------------------------------------- */
+
+func WithSingleTrackTransform(f SingleTrackDataTransform) Option {
+  return newOption("WithSingleTrackTransform", SingleTrackTransformOption, f == nil, func(options *Options) {
+    options.SingleTrackTransform = f
+  })
+}
+
+func WithSingleTrackBatchTransform(f SingleTrackBatchDataTransform) Option {
+  return newOption("WithSingleTrackBatchTransform", SingleTrackBatchTransformOption, f == nil, func(options *Options) {
+    options.SingleTrackBatchTransform = f
+  })
+}
+
+func WithMultiTrackTransform(f MultiTrackDataTransform) Option {
+  return newOption("WithMultiTrackTransform", MultiTrackTransformOption, f == nil, func(options *Options) {
+    options.MultiTrackTransform = f
+  })
+}
+
+func WithMultiTrackBatchTransform(f MultiTrackBatchDataTransform) Option {
+  return newOption("WithMultiTrackBatchTransform", MultiTrackBatchTransformOption, f == nil, func(options *Options) {
+    options.MultiTrackBatchTransform = f
+  })
+}
+
+// Restrict computations to the given sequences. An empty list selects all
+// sequences.
+func WithSeqnames(seqnames ...string) Option {
+  return newOption("WithSeqnames", SeqnamesOption, false, func(options *Options) {
+    options.Seqnames = seqnames
+  })
+}
+
+// Exclude all bins that overlap the given regions, i.e. they are treated as
+// missing values.
+func WithMask(regions GRanges) Option {
+  return newOption("WithMask", MaskOption, false, func(options *Options) {
+    options.Mask = regions
+  })
+}
+
+// Restrict classification to bins that lie entirely within the given
+// regions. Results of these bins are the same as without this option,
+// whereas bins outside the regions may be missing values. Sliding window
+// classifiers evaluate only windows required for these bins, and
+// classifiers of variable dimension skip all chunks (see WithChunks) that
+// do not overlap any region.
+func WithRegions(regions GRanges) Option {
+  return newOption("WithRegions", RegionsOption, false, func(options *Options) {
+    options.Regions = regions
+  })
+}
+
+// Step size (in bins) between consecutive windows of sliding window
+// estimators and classifiers.
+func WithStep(step int) Option {
+  r := newOption("WithStep", StepOption, false, func(options *Options) {
+    options.Step = step
+  })
+  if step < 1 {
+    r.err = NewArgumentError("invalid step size `%d'", step)
+  }
+  return r
+}
+
+// Number of threads of the private execution context, the option has no
+// effect if an execution context is given.
+func WithThreads(threads int) Option {
+  r := newOption("WithThreads", ThreadsOption, false, func(options *Options) {
+    options.Threads = threads
+  })
+  if threads < 1 {
+    r.err = NewArgumentError("invalid number of threads `%d'", threads)
+  }
+  return r
+}
+
+func WithExecutionContext(exec *ExecutionContext) Option {
+  return newOption("WithExecutionContext", ExecutionContextOption, exec == nil, func(options *Options) {
+    options.ExecutionContext = exec
+  })
+}
+
+// Send progress events to the given callback instead of logging them.
+func WithProgress(callback ProgressCallback) Option {
+  return newOption("WithProgress", ProgressOption, callback == nil, func(options *Options) {
+    options.Progress = callback
+  })
+}
+
+// Treatment of windows that extend beyond the ends of a sequence.
+func WithPadding(padding WindowPadding) Option {
+  r := newOption("WithPadding", PaddingOption, false, func(options *Options) {
+    options.Padding    = padding
+    options.hasPadding = true
+  })
+  if padding < WindowPadNone || padding > WindowPadReflect {
+    r.err = NewArgumentError("invalid padding `%d'", padding)
+  }
+  return r
+}
+
+// Mode for assigning results of sliding window classifiers to bins.
+func WithAggregation(aggregation WindowAggregation) Option {
+  r := newOption("WithAggregation", AggregationOption, false, func(options *Options) {
+    options.Aggregation = aggregation
+  })
+  if aggregation < WindowAggregateCenter || aggregation > WindowAggregateMean {
+    r.err = NewArgumentError("invalid aggregation `%d'", aggregation)
+  }
+  return r
+}
+
+// Split sequences into chunks of the given size (in bins), which are
+// processed in parallel. Each chunk is extended by overlap bins on both
+// sides to reduce boundary effects.
+func WithChunks(size, overlap int) Option {
+  r := newOption("WithChunks", ChunkOption, false, func(options *Options) {
+    options.ChunkSize    = size
+    options.ChunkOverlap = overlap
+  })
+  if size < 1 {
+    r.err = NewArgumentError("invalid chunk size `%d'", size)
+  } else
+  if overlap < 0 {
+    r.err = NewArgumentError("invalid chunk overlap `%d'", overlap)
+  }
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+func newOption(name string, kind OptionKind, isNil bool, apply func(*Options)) Option {
+  r := Option{name: name, kind: kind, apply: apply}
+  if isNil {
+    r.err = NewArgumentError("argument is nil")
+  }
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Names of all options in the set.
+func (kind OptionKind) String() string {
+  names := []string{
+    "SingleTrackTransform",
+    "SingleTrackBatchTransform",
+    "MultiTrackTransform",
+    "MultiTrackBatchTransform",
+    "Seqnames",
+    "Mask",
+    "Step",
+    "Threads",
+    "ExecutionContext",
+    "Progress",
+    "Padding",
+    "Aggregation",
+    "Chunk",
+    "Regions" }
+  r := []string{}
+  for i, name := range names {
+    if kind & (1 << uint(i)) != 0 {
+      r = append(r, name)
+    }
+  }
+  return strings.Join(r, "|")
+}
@@ -0,0 +1,80 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package options
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "strings"
+import "testing"
+
+import . "github.com/pbenner/ngstat/utility"
+
+/* -------------------------------------------------------------------------- */
+
+func TestParseOptions(test *testing.T) {
+  for _, c := range []struct {
+    name      string
+    supported OptionKind
+    options   []Option
+    err       string
+  }{
+    { "no options",
+      TrackOptions, nil, "" },
+    { "supported options",
+      TrackOptions | StepOption, []Option{WithThreads(2), WithStep(3), WithSeqnames("chr1")}, "" },
+    { "unsupported option",
+      TrackOptions, []Option{WithThreads(2), WithStep(3)}, "option `WithStep' is not supported" },
+    { "unsupported chunks",
+      StepOption, []Option{WithChunks(100, 10)}, "option `WithChunks' is not supported" },
+    { "zero option",
+      TrackOptions, []Option{{}}, "invalid option" },
+    { "invalid step",
+      StepOption, []Option{WithStep(0)}, "invalid step size `0'" },
+    { "invalid threads",
+      TrackOptions, []Option{WithThreads(-1)}, "invalid number of threads `-1'" },
+    { "invalid chunk overlap",
+      ChunkOption, []Option{WithChunks(100, -1)}, "invalid chunk overlap `-1'" },
+    { "nil execution context",
+      TrackOptions, []Option{WithExecutionContext(nil)}, "argument is nil" },
+    { "invalid and unsupported option",
+      ThreadsOption, []Option{WithStep(0)}, "invalid step size `0'" },
+  } {
+    _, err := ParseOptions("test", c.supported, c.options)
+    if c.err == "" {
+      if err != nil {
+        test.Errorf("%s: unexpected error: %v", c.name, err)
+      }
+      continue
+    }
+    if err == nil {
+      test.Errorf("%s: expected error `%s'", c.name, c.err); continue
+    }
+    if !errors.Is(err, ErrInvalidArgument) {
+      test.Errorf("%s: error `%v' does not wrap ErrInvalidArgument", c.name, err)
+    }
+    if !strings.Contains(err.Error(), c.err) || !strings.HasPrefix(err.Error(), "test: ") {
+      test.Errorf("%s: got error `%v', expected `%s'", c.name, err, c.err)
+    }
+  }
+  r, err := ParseOptions("test", TrackOptions | StepOption, []Option{WithThreads(2), WithStep(3), WithSeqnames("chr1", "chr2")}); if err != nil {
+    test.Fatal(err)
+  }
+  if r.Threads != 2 || r.Step != 3 || len(r.Seqnames) != 2 {
+    test.Errorf("options not applied: threads `%d', step `%d', seqnames %v", r.Threads, r.Step, r.Seqnames)
+  }
+}
@@ -0,0 +1,147 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package options
+
+/* -------------------------------------------------------------------------- */
+
+import "math"
+
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+// A track that is restricted to a subset of sequences and where masked
+// regions are replaced by missing values. Masked sequences are copied when
+// they are accessed, the underlying track is never modified.
+type filteredTrack struct {
+  Track
+  genome Genome
+  mask   map[string][]Range
+}
+
+// Apply seqname filter and mask options to a track. The track is returned
+// unchanged if none of both options is given.
+func (options Options) FilterTrack(track Track) Track {
+  if len(options.Seqnames) == 0 && options.Mask.Length() == 0 {
+    return track
+  }
+  r := filteredTrack{Track: track}
+  r.genome = track.GetGenome()
+  if len(options.Seqnames) > 0 {
+    seqnames := make(map[string]bool)
+    for _, name := range options.Seqnames {
+      seqnames[name] = true
+    }
+    r.genome = r.genome.Filter(func(name string, length int) bool {
+      return seqnames[name]
+    })
+  }
+  if options.Mask.Length() > 0 {
+    r.mask = make(map[string][]Range)
+    for i := 0; i < options.Mask.Length(); i++ {
+      name := options.Mask.Seqnames[i]
+      r.mask[name] = append(r.mask[name], options.Mask.Ranges[i])
+    }
+  }
+  return r
+}
+
+func (track filteredTrack) GetGenome() Genome {
+  return track.genome
+}
+
+func (track filteredTrack) GetSeqNames() []string {
+  r := []string{}
+  for _, name := range track.Track.GetSeqNames() {
+    if _, err := track.genome.GetIdx(name); err == nil {
+      r = append(r, name)
+    }
+  }
+  return r
+}
+
+func (track filteredTrack) GetSequence(seqname string) (TrackSequence, error) {
+  seq, err := track.Track.GetSequence(seqname); if err != nil {
+    return seq, err
+  }
+  ranges, ok := track.mask[seqname]; if !ok {
+    return seq, nil
+  }
+  binSize := seq.GetBinSize()
+  // copy sequence
+  tmp := AllocSimpleTrack("", NewGenome([]string{seqname}, []int{seq.NBins()*binSize}), binSize)
+  dst, err := tmp.GetSequence(seqname); if err != nil {
+    return seq, err
+  }
+  for i := 0; i < seq.NBins(); i++ {
+    dst.SetBin(i, seq.AtBin(i))
+  }
+  for _, r := range ranges {
+    from := r.From/binSize
+    to   := (r.To+binSize-1)/binSize
+    if from < 0 {
+      from = 0
+    }
+    if to > dst.NBins() {
+      to = dst.NBins()
+    }
+    for i := from; i < to; i++ {
+      dst.SetBin(i, math.NaN())
+    }
+  }
+  return dst, nil
+}
+
+func (track filteredTrack) GetSlice(r GRangesRow) ([]float64, error) {
+  seq, err := track.Track.GetSlice(r); if err != nil || seq == nil {
+    return seq, err
+  }
+  ranges, ok := track.mask[r.Seqname]; if !ok {
+    return seq, nil
+  }
+  binSize := track.GetBinSize()
+  offset  := r.Range.From/binSize
+  if offset < 0 {
+    offset = 0
+  }
+  result  := make([]float64, len(seq))
+  copy(result, seq)
+  for _, m := range ranges {
+    from := m.From/binSize - offset
+    to   := (m.To+binSize-1)/binSize - offset
+    if from < 0 {
+      from = 0
+    }
+    if to > len(result) {
+      to = len(result)
+    }
+    for i := from; i < to; i++ {
+      result[i] = math.NaN()
+    }
+  }
+  return result, nil
+}
+
+// Apply FilterTrack to all tracks. A new slice is returned, the given slice
+// is not modified.
+func (options Options) FilterTracks(tracks []Track) []Track {
+  r := make([]Track, len(tracks))
+  for i, track := range tracks {
+    r[i] = options.FilterTrack(track)
+  }
+  return r
+}
@@ -23,6 +23,8 @@ import   "strconv"
 
 import . "github.com/pbenner/ngstat/config"
 import . "github.com/pbenner/ngstat/estimation"
+import   "github.com/pbenner/ngstat/ngstatPlugin"
+import . "github.com/pbenner/ngstat/options"
 import   "github.com/pbenner/ngstat/statistics/nonparametric"
 import . "github.com/pbenner/ngstat/track"
 
@@ -32,6 +34,14 @@ import   "github.com/pbenner/autodiff/statistics/vectorEstimator"
 
 /* -------------------------------------------------------------------------- */
 
+var Manifest = ngstatPlugin.NewManifest("nonparametric", "1.0.0",
+  ngstatPlugin.Function{
+    Name       : "Estimate",
+    Description: "estimate a nonparametric distribution on a single track",
+    Usage      : "Estimate <NBINS> <INPUT.bw> <OUTPUT.json> [<chrom1> <chrom2>...]" })
+
+/* -------------------------------------------------------------------------- */
+
 func Estimate(config SessionConfig, args []string) {
   if len(args) < 3 {
     log.Println("Usage: Estimate <NBINS> <INPUT.bw> <OUTPUT.json> [<chrom1> <chrom2>...] ")
@@ -50,7 +60,7 @@ func Estimate(config SessionConfig, args []string) {
   track, err := ImportTrack(config, filenameIn); if err != nil {
     panic(err)
   }
-  if err := BatchEstimateOnSingleTrack(config, estimator, track, -1, chromosomes); err != nil {
+  if err := BatchEstimateOnSingleTrack(config, estimator, track, WithSeqnames(chromosomes...)); err != nil {
     panic(err)
   }
   if estimate, err := estimator.GetEstimate(); err != nil {
@@ -61,3 +71,19 @@ func Estimate(config SessionConfig, args []string) {
     }
   }
 }
+
+/* -------------------------------------------------------------------------- */
+
+// When compiled as executable, the plugin runs as a separate process that
+// is controlled by `ngstat exec'.
+func main() {
+  handlers := map[string]ngstatPlugin.Handler{
+    "Estimate": func(config SessionConfig, args []string) error {
+      Estimate(config, args)
+      return nil
+    },
+  }
+  if err := ngstatPlugin.Serve(Manifest, handlers); err != nil {
+    log.Fatal(err)
+  }
+}
@@ -22,6 +22,8 @@ import   "fmt"
 import   "math"
 import   "sort"
 
+import . "github.com/pbenner/ngstat/utility"
+
 import . "github.com/pbenner/autodiff/statistics"
 
 import . "github.com/pbenner/autodiff"
@@ -39,7 +41,7 @@ type NonparametricDistribution struct {
 
 func NewDistribution(x, y []float64) (*NonparametricDistribution, error) {
   if len(x) != len(y) {
-    return nil, fmt.Errorf("dimensions do not match")
+    return nil, NewDimensionError(len(x), len(y), "dimensions do not match")
   }
   if r, err := NullDistribution(x); err != nil {
     return nil, err
@@ -110,7 +112,7 @@ func (dist *NonparametricDistribution) Index(x_ ConstScalar) (int, error) {
     return idx, nil
   } else {
     if x < dist.X[0] || x >= dist.X[len(dist.X)-1]+dist.Delta[len(dist.Delta)-1] {
-      return -1, fmt.Errorf("value `%v' is out of range", x)
+      return -1, NewArgumentError("value `%v' is out of range", x)
     } else {
       idx = sort.SearchFloat64s(dist.X, x)
       return idx-1, nil
@@ -172,10 +174,10 @@ func (dist *NonparametricDistribution) SetParameters(parameters Vector) error {
 func (dist *NonparametricDistribution) ImportConfig(config ConfigDistribution, t ScalarType) error {
 
   x, ok := config.GetNamedParametersAsFloats("X"); if !ok {
-    return fmt.Errorf("invalid config file")
+    return FormatError{Err: fmt.Errorf("invalid config file: parameter `X' is missing")}
   }
   y, ok := config.GetNamedParametersAsFloats("Y"); if !ok {
-    return fmt.Errorf("invalid config file")
+    return FormatError{Err: fmt.Errorf("invalid config file: parameter `Y' is missing")}
   }
 
   if tmp, err := NewDistribution(x, y); err != nil {
@@ -18,7 +18,7 @@ package main
 
 /* -------------------------------------------------------------------------- */
 
-//import   "fmt"
+import   "fmt"
 import   "log"
 import   "os"
 import   "strconv"
@@ -40,58 +40,99 @@ func main() {
   optBinOver   := options.    IntLong("bin-overlap",    0 ,      0, "number of overlapping bins when computing the summary")
   optTrackInit := options. StringLong("initial-value",  0 ,     "", "track initial value [default: 0]")
   optThreads   := options.    IntLong("threads",        0 ,      0, "number of threads")
+  optLogFormat := options. StringLong("log-format",     0 , "text", "format of log messages [text (default), json]")
+  optReport    := options. StringLong("report",         0 ,     "", "write a run report to the given file (json, yaml or toml)")
   optHelp      := options.   BoolLong("help",          'h',         "print help")
+  optVersion   := options.   BoolLong("version",        0 ,         "print version")
   optVerbose   := options.CounterLong("verbose",       'v',         "verbose level [-v or -vv]")
 
   options.SetParameters("<COMMAND>\n\n" +
     " Commands:\n" +
-    "     compile          - compile a plugin\n" +
-    "     exec             - execute a plugin\n")
+    "     compile                - compile a plugin\n" +
+    "     exec                   - execute a plugin\n" +
+    "     run                    - run a pipeline\n" +
+    "     config                 - show, validate or describe the configuration\n" +
+    "     estimate               - estimate a mixture model on a track\n" +
+    "     classify               - compute posterior probabilities using a mixture model\n" +
+    "     call-peaks             - call peaks on posterior tracks\n" +
+    "     segment                - segment a track using a hidden Markov model\n" +
+    "     evaluate               - evaluate predictions against a set of true regions\n" +
+    "     segmentation-histogram - compute histograms of track values for each state\n")
   options.Parse(os.Args)
 
-  config := DefaultSessionConfig()
-
   // command options
   if *optHelp {
     options.PrintUsage(os.Stdout)
     os.Exit(0)
   }
-  if *optVerbose != 0 {
-    config.Verbose = *optVerbose
+  if *optVersion {
+    fmt.Printf("ngstat %s\n", Version)
+    os.Exit(0)
+  }
+  // configuration layers ordered by precedence: defaults, system, user
+  // and project files, environment, config file, plugin, command line
+  layers, err := ImportConfigLayers()
+  if err != nil {
+    log.Fatalf("reading configuration failed: %v", err)
   }
   if *optConfig != "" {
-    current_config := config
-    PrintStderr(current_config, 1, "Importing config file `%s'... ", *optConfig)
-    if err := config.ImportFile(*optConfig); err != nil {
-      PrintStderr(current_config, 1, "failed\n")
+    if layer, err := ImportConfigLayerFile("config file", ConfigFile, *optConfig); err != nil {
       log.Fatalf("reading config file `%s' failed: %v", *optConfig, err)
+    } else {
+      layers = layers.Add(layer)
     }
-    PrintStderr(current_config, 1, "done\n")
+  }
+  flags := NewConfigLayer("command line", ConfigCommandLine)
+  if *optVerbose != 0 {
+    flags.Set("Verbose", *optVerbose)
   }
   if options.Lookup("bin-size").Seen() {
     if *optBinSize < 0 {
       log.Fatalf("invalid bin-size `%d'", *optBinSize)
     }
-    config.BinSize = *optBinSize
+    flags.Set("Bin Size", *optBinSize)
   }
   if options.Lookup("bin-summary").Seen() {
-    config.BinSummaryStatistics = *optBinStat
+    flags.Set("Bin Summary Statistics", *optBinStat)
   }
   if options.Lookup("bin-overlap").Seen() {
-    config.BinOverlap = *optBinOver
+    flags.Set("Bin Overlap", *optBinOver)
   }
   if options.Lookup("initial-value").Seen() {
     v, err := strconv.ParseFloat(*optTrackInit, 64)
     if err != nil {
       log.Fatalf("parsing initial value failed: %v", err)
     }
-    config.TrackInit = v
+    flags.Set("Track Initial Value", v)
   }
   if options.Lookup("threads").Seen() {
     if *optThreads < 1 {
       log.Fatalf("invalid number of threads `%d'", *optThreads)
     }
-    config.Threads = *optThreads
+    flags.Set("Threads", *optThreads)
+  }
+  if options.Lookup("log-format").Seen() {
+    flags.Set("Log Format", *optLogFormat)
+  }
+  layers = layers.Add(flags)
+
+  config, err := layers.Apply()
+  if err != nil {
+    log.Fatal(err)
+  }
+  // fatal errors are written as log records in json mode
+  if config.LogFormat == "json" {
+    log.SetFlags(0)
+    log.SetOutput(LogLineWriter{Config: config, Level: LogLevelError})
+  }
+  // the run report is also written if the command terminates with a fatal
+  // error
+  var report *RunReport
+  logWriter := log.Writer()
+  if *optReport != "" {
+    report = NewRunReport(config, os.Args)
+    SetRunReport(report)
+    log.SetOutput(report.ExitWriter(logWriter, *optReport))
   }
   // command arguments
   if len(options.Args()) == 0 {
@@ -104,9 +145,33 @@ func main() {
   case "compile":
     ngstat_compile_main(config, options.Args())
   case "exec":
-    ngstat_exec_main(config, options.Args())
+    ngstat_exec_main(config, layers, options.Args())
+  case "config":
+    ngstat_config_main(config, options.Args())
+  case "run":
+    ngstat_run_main(config, options.Args())
+  case "estimate":
+    ngstat_estimate_main(config, options.Args())
+  case "classify":
+    ngstat_classify_main(config, options.Args())
+  case "call-peaks":
+    ngstat_call_peaks_main(config, options.Args())
+  case "segment":
+    ngstat_segment_main(config, options.Args())
+  case "evaluate":
+    ngstat_evaluate_main(config, options.Args())
+  case "segmentation-histogram":
+    ngstat_segmentation_histogram_main(config, options.Args())
   default:
     options.PrintUsage(os.Stderr)
     os.Exit(1)
   }
+  if report != nil {
+    report.Finish(nil)
+    SetRunReport(nil)
+    log.SetOutput(logWriter)
+    if err := ExportFile(report, *optReport); err != nil {
+      log.Fatalf("writing run report `%s' failed: %v", *optReport, err)
+    }
+  }
 }
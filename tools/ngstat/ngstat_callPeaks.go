@@ -0,0 +1,137 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+/* -------------------------------------------------------------------------- */
+
+import   "fmt"
+import   "log"
+import   "os"
+import   "strconv"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/classification"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/track"
+
+import . "github.com/pbenner/gonetics"
+
+import   "github.com/pborman/getopt"
+
+/* -------------------------------------------------------------------------- */
+
+// Call peaks on one or more (posterior) tracks. If several tracks are given,
+// only peaks that are present in all tracks are reported. If summits is
+// true, peaks are called on a single track using the given summit
+// parameters.
+func ngstat_call_peaks(config SessionConfig, filenameOut string, filenamesIn []string, thresholds []float64, wsize int, summits bool, parameters SummitParameters) error {
+  tracks := make([]Track, len(filenamesIn))
+  for i, filename := range filenamesIn {
+    if track, err := ImportTrack(config, filename); err != nil {
+      return err
+    } else {
+      tracks[i] = track
+    }
+  }
+  var peaks GRanges
+  var err   error
+  switch {
+  case summits && len(tracks) != 1:
+    return fmt.Errorf("summit detection requires a single input track")
+  case summits:
+    peaks, err = GetSummitPeaks(tracks[0], thresholds[0], wsize, parameters)
+  case len(tracks) == 1:
+    peaks = GetPeaks(tracks[0], thresholds[0], wsize)
+  default:
+    peaks, err = GetIntersectingPeaks(tracks, thresholds, wsize)
+  }
+  if err != nil {
+    return err
+  }
+  task := BeginTask(config, fmt.Sprintf("Exporting peaks to `%s'", filenameOut), "output", filenameOut, "peaks", peaks.Length())
+  if err := exportPeaks(peaks, filenameOut); err != nil {
+    task.Failed(err)
+    return err
+  }
+  task.Done()
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+func ngstat_call_peaks_main(config SessionConfig, args []string) {
+
+  options := getopt.New()
+  options.SetProgram(fmt.Sprintf("%s call-peaks", os.Args[0]))
+
+  optThreshold  := options.StringLong("threshold",        0, "0.5", "comma separated list of thresholds, one for each track")
+  optWSize      := options.   IntLong("window-size",      0,     0, "cut a window of given size around each peak summit [default: report full peaks]")
+  optSummits    := options.  BoolLong("summits",          0,        "detect multiple summits within broad peaks")
+  optProminence := options.StringLong("min-prominence",   0, "0.0", "minimum prominence of a summit")
+  optValley     := options.StringLong("min-valley-depth", 0, "0.0", "minimum relative depth of the valley between two summits")
+  optSmoothing  := options.   IntLong("smoothing",        0,     0, "size of the moving average applied before summit detection")
+  optSplit      := options.  BoolLong("split",            0,        "report each summit as a separate peak")
+  optHelp       := options.  BoolLong("help",            'h',       "print help")
+
+  options.SetParameters("<OUTPUT.bed|OUTPUT.table> <INPUT.bw>...\n")
+  options.Parse(args)
+
+  // command options
+  if *optHelp {
+    options.PrintUsage(os.Stdout)
+    os.Exit(0)
+  }
+  // command arguments
+  if len(options.Args()) < 2 {
+    options.PrintUsage(os.Stderr)
+    os.Exit(1)
+  }
+  filenameOut := options.Args()[0]
+  filenamesIn := options.Args()[1:]
+
+  thresholds, err := parseFloats(*optThreshold); if err != nil {
+    log.Fatalf("parsing thresholds failed: %v", err)
+  }
+  if len(thresholds) == 1 {
+    for len(thresholds) < len(filenamesIn) {
+      thresholds = append(thresholds, thresholds[0])
+    }
+  }
+  if len(thresholds) != len(filenamesIn) {
+    log.Fatal("number of thresholds does not match number of input tracks")
+  }
+  if *optWSize < 0 {
+    log.Fatalf("invalid window size `%d'", *optWSize)
+  }
+  parameters := DefaultSummitParameters()
+  if v, err := strconv.ParseFloat(*optProminence, 64); err != nil {
+    log.Fatalf("parsing prominence failed: %v", err)
+  } else {
+    parameters.MinProminence = v
+  }
+  if v, err := strconv.ParseFloat(*optValley, 64); err != nil {
+    log.Fatalf("parsing valley depth failed: %v", err)
+  } else {
+    parameters.MinValleyDepth = v
+  }
+  parameters.Smoothing = *optSmoothing
+  parameters.Split     = *optSplit
+
+  if err := ngstat_call_peaks(config, filenameOut, filenamesIn, thresholds, *optWSize, *optSummits, parameters); err != nil {
+    log.Fatal(err)
+  }
+}
@@ -0,0 +1,231 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+/* -------------------------------------------------------------------------- */
+
+import   "fmt"
+import   "log"
+import   "math"
+import   "os"
+import   "path/filepath"
+import   "strings"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/classification"
+import . "github.com/pbenner/ngstat/track"
+
+import . "github.com/pbenner/autodiff"
+import . "github.com/pbenner/autodiff/statistics"
+import   "github.com/pbenner/autodiff/statistics/scalarClassifier"
+import   "github.com/pbenner/autodiff/statistics/scalarDistribution"
+import   "github.com/pbenner/autodiff/statistics/vectorClassifier"
+
+import . "github.com/pbenner/gonetics"
+
+import   "github.com/pborman/getopt"
+
+/* -------------------------------------------------------------------------- */
+
+// Compute for each bin the posterior probability that the value was
+// generated by one of the given mixture components. If separate is true,
+// posterior probabilities are computed for each component separately and
+// exported either as multi-column bedGraph or as one bigWig file per
+// component. Models other than the default model may be used for some
+// sequences or region classes, where the model assignment maps sequences
+// and region classes to model files (an empty file name skips them).
+func ngstat_classify(config SessionConfig, filenameOut, filenameModel, filenameIn string, components []int, logScale, separate bool, seqnameModels map[string]string, filenameRegions string, regionModels map[string]string) error {
+  assignment := NewModelAssignment(filenameModel)
+  for name, model := range seqnameModels {
+    assignment.Seqnames[name] = model
+  }
+  if filenameRegions != "" {
+    regions, err := ImportRegionClasses(config, filenameRegions); if err != nil {
+      return err
+    }
+    assignment.Regions     = regions
+    assignment.RegionsFile = filenameRegions
+    for class, model := range regionModels {
+      assignment.Classes[class] = model
+    }
+  } else
+  if len(regionModels) > 0 {
+    return fmt.Errorf("region models require a regions file")
+  }
+  mixtures := make(map[string]*scalarDistribution.Mixture)
+  for _, filename := range assignment.Models() {
+    if mixture, err := ngstat_classify_import_model(config, filename, components); err != nil {
+      return err
+    } else {
+      mixtures[filename] = mixture
+    }
+  }
+  // use the default model only if no other models are assigned
+  assigned := len(seqnameModels) > 0 || filenameRegions != ""
+
+  if separate {
+    return ngstat_classify_separate(config, filenameOut, filenameIn, mixtures, assignment, assigned, components, logScale)
+  }
+  classifiers := make(map[string]VectorBatchClassifier)
+  for filename, mixture := range mixtures {
+    classifiers[filename] = vectorClassifier.ScalarBatchIid{Classifier: scalarClassifier.MixturePosterior{Mixture: mixture, States: components}, N: 1}
+  }
+  var result MutableTrack
+  var err    error
+  if assigned {
+    result, err = ImportAndBatchClassifySingleTrackAssigned(config, classifiers, assignment, filenameIn)
+  } else {
+    result, err = ImportAndBatchClassifySingleTrack(config, classifiers[filenameModel], filenameIn)
+  }
+  if err != nil {
+    return err
+  }
+  if !logScale {
+    if err := (GenericMutableTrack{MutableTrack: result}).Map(result, func(seqname string, position int, value float64) float64 {
+      return math.Exp(value)
+    }); err != nil {
+      return err
+    }
+  }
+  return ExportTrack(config, result, filenameOut)
+}
+
+func ngstat_classify_import_model(config SessionConfig, filenameModel string, components []int) (*scalarDistribution.Mixture, error) {
+  var mixture *scalarDistribution.Mixture
+  task := BeginTask(config, fmt.Sprintf("Reading model `%s'", filenameModel), "input", filenameModel)
+  if d, err := ImportScalarPdf(filenameModel, Float64Type); err != nil {
+    task.Failed(err)
+    return nil, err
+  } else {
+    task.Done()
+    if m, ok := d.(*scalarDistribution.Mixture); !ok {
+      return nil, fmt.Errorf("model `%s' is not a mixture distribution", filenameModel)
+    } else {
+      mixture = m
+    }
+  }
+  for _, k := range components {
+    if k < 0 || k >= mixture.NComponents() {
+      return nil, fmt.Errorf("invalid mixture component `%d' for model `%s'", k, filenameModel)
+    }
+  }
+  return mixture, nil
+}
+
+func ngstat_classify_separate(config SessionConfig, filenameOut, filenameIn string, mixtures map[string]*scalarDistribution.Mixture, assignment ModelAssignment, assigned bool, components []int, logScale bool) error {
+  // one output for each component, the mixture density is evaluated only
+  // once for all components
+  states := make([][]int, len(components))
+  for j, k := range components {
+    states[j] = []int{k}
+  }
+  classifiers := make(map[string]VectorBatchMultiOutputClassifier)
+  for filename, mixture := range mixtures {
+    classifier, err := NewMixturePosteriors(mixture, 1, states...); if err != nil {
+      return err
+    }
+    classifiers[filename] = classifier
+  }
+  var result []MutableTrack
+  var err      error
+  if assigned {
+    result, err = ImportAndBatchClassifySingleTrackMultiOutputAssigned(config, classifiers, assignment, filenameIn)
+  } else {
+    result, err = ImportAndBatchClassifySingleTrackMultiOutput(config, classifiers[assignment.Default], filenameIn)
+  }
+  if err != nil {
+    return err
+  }
+  tracks := make([]Track, len(result))
+  names  := make([]string, len(result))
+  for j, track := range result {
+    if !logScale {
+      if err := (GenericMutableTrack{MutableTrack: track}).Map(track, func(seqname string, position int, value float64) float64 {
+        return math.Exp(value)
+      }); err != nil {
+        return err
+      }
+    }
+    tracks[j] = track
+    names [j] = fmt.Sprintf("component.%d", components[j])
+  }
+  if isBedGraphFilename(filenameOut) {
+    return ExportMultiColumnBedGraph(config, tracks, names, filenameOut)
+  }
+  // insert component into file name, i.e. out.bw becomes out.component.0.bw
+  ext       := filepath.Ext(filenameOut)
+  filenames := make([]string, len(result))
+  for j := range result {
+    filenames[j] = fmt.Sprintf("%s.%s%s", strings.TrimSuffix(filenameOut, ext), names[j], ext)
+  }
+  return ExportTracks(config, tracks, filenames)
+}
+
+func isBedGraphFilename(filename string) bool {
+  filename = strings.ToLower(strings.TrimSuffix(filename, ".gz"))
+  return strings.HasSuffix(filename, ".bedgraph") || strings.HasSuffix(filename, ".bg")
+}
+
+/* -------------------------------------------------------------------------- */
+
+func ngstat_classify_main(config SessionConfig, args []string) {
+
+  options := getopt.New()
+  options.SetProgram(fmt.Sprintf("%s classify", os.Args[0]))
+
+  optComponents := options.StringLong("components",     0, "", "comma separated list of foreground mixture components")
+  optLog        := options.  BoolLong("log",            0,     "export log posterior probabilities")
+  optSeparate   := options.  BoolLong("separate",       0,     "export posterior probabilities of each component separately, either as multi-column bedGraph (OUTPUT.bedGraph) or as one bigWig file per component")
+  optSeqModels  := options.StringLong("seqname-models", 0, "", "comma separated list of SEQNAME=MODEL.json pairs, sequences are classified with the given model instead of the default model (SEQNAME= skips a sequence)")
+  optRegions    := options.StringLong("regions",        0, "", "bed file with region classes in the fourth column")
+  optRegModels  := options.StringLong("region-models",  0, "", "comma separated list of CLASS=MODEL.json pairs, regions of the given class are classified with the given model (CLASS= skips regions)")
+  optHelp       := options.  BoolLong("help",          'h',    "print help")
+
+  options.SetParameters("<MODEL.json> <OUTPUT.bw> <INPUT.bw>\n")
+  options.Parse(args)
+
+  // command options
+  if *optHelp {
+    options.PrintUsage(os.Stdout)
+    os.Exit(0)
+  }
+  // command arguments
+  if len(options.Args()) != 3 {
+    options.PrintUsage(os.Stderr)
+    os.Exit(1)
+  }
+  components, err := parseInts(*optComponents); if err != nil {
+    log.Fatalf("parsing components failed: %v", err)
+  }
+  if len(components) == 0 {
+    log.Fatal("empty set of foreground components")
+  }
+  filenameModel := options.Args()[0]
+  filenameOut   := options.Args()[1]
+  filenameIn    := options.Args()[2]
+
+  seqnameModels, err := parseAssignments(*optSeqModels); if err != nil {
+    log.Fatalf("parsing seqname models failed: %v", err)
+  }
+  regionModels, err := parseAssignments(*optRegModels); if err != nil {
+    log.Fatalf("parsing region models failed: %v", err)
+  }
+  if err := ngstat_classify(config, filenameOut, filenameModel, filenameIn, components, *optLog, *optSeparate, seqnameModels, *optRegions, regionModels); err != nil {
+    log.Fatal(err)
+  }
+}
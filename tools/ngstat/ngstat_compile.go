@@ -18,25 +18,433 @@ package main
 
 /* -------------------------------------------------------------------------- */
 
+import   "bufio"
+import   "bytes"
+import   "crypto/sha256"
+import   "encoding/hex"
+import   "encoding/json"
 import   "fmt"
+import   "io"
+import   "io/ioutil"
 import   "log"
 import   "os"
 import   "os/exec"
+import   "path/filepath"
+import   "runtime/debug"
+import   "sort"
+import   "strings"
 
 import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+import   "github.com/pbenner/ngstat/ngstatPlugin"
 
 import   "github.com/pborman/getopt"
 
 /* -------------------------------------------------------------------------- */
 
+// Collect go files of a plugin. Sources are either given as list of go files
+// or as a single directory.
+func ngstat_compile_sources(sources []string) ([]string, error) {
+  if len(sources) == 1 {
+    if info, err := os.Stat(sources[0]); err != nil {
+      return nil, err
+    } else if info.IsDir() {
+      files, err := filepath.Glob(filepath.Join(sources[0], "*.go")); if err != nil {
+        return nil, err
+      }
+      r := []string{}
+      for _, file := range files {
+        if !strings.HasSuffix(file, "_test.go") {
+          r = append(r, file)
+        }
+      }
+      if len(r) == 0 {
+        return nil, fmt.Errorf("directory `%s' contains no go files", sources[0])
+      }
+      return r, nil
+    }
+  }
+  for _, file := range sources {
+    if filepath.Ext(file) != ".go" {
+      return nil, fmt.Errorf("invalid source file `%s'", file)
+    }
+  }
+  return sources, nil
+}
+
+// Find the ngstat source tree by searching for a go.mod file that declares
+// the given module path, starting at the given directory.
+func ngstat_compile_find_module(dir, path string) (string, error) {
+  dir, err := filepath.Abs(dir); if err != nil {
+    return "", err
+  }
+  for {
+    if f, err := os.Open(filepath.Join(dir, "go.mod")); err == nil {
+      scanner := bufio.NewScanner(f)
+      for scanner.Scan() {
+        if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "module" && fields[1] == path {
+          f.Close()
+          return dir, nil
+        }
+      }
+      f.Close()
+    }
+    parent := filepath.Dir(dir)
+    if parent == dir {
+      return "", fmt.Errorf("source tree of module `%s' not found", path)
+    }
+    dir = parent
+  }
+}
+
+// The ngstat module a plugin is compiled against, which is either a local
+// source tree or the module as downloaded by the go command.
+type compileModule struct {
+  Dir       string
+  Sum       string
+  GoModSum  string
+  // go directive and requirements of the go.mod file
+  GoVersion string
+  Require   [][2]string
+}
+
+// Parse the go directive and all requirements of a go.mod file.
+func ngstat_compile_parse_gomod(module *compileModule, content string) {
+  block := false
+  for _, line := range strings.Split(content, "\n") {
+    if i := strings.Index(line, "//"); i >= 0 {
+      line = line[0:i]
+    }
+    fields := strings.Fields(line)
+    switch {
+    case len(fields) == 0:
+    case block && fields[0] == ")":
+      block = false
+    case block && len(fields) == 2:
+      module.Require = append(module.Require, [2]string{fields[0], fields[1]})
+    case fields[0] == "go" && len(fields) == 2:
+      module.GoVersion = fields[1]
+    case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+      block = true
+    case fields[0] == "require" && len(fields) == 3:
+      module.Require = append(module.Require, [2]string{fields[1], fields[2]})
+    }
+  }
+}
+
+// Locate the ngstat module of the running binary and read its go.mod file.
+// If ngstatDir is empty, the module is downloaded by the go command.
+func ngstat_compile_module(config SessionConfig, env []string, info *debug.BuildInfo, ngstatDir string) (compileModule, error) {
+  module := compileModule{Dir: ngstatDir}
+  if ngstatDir == "" {
+    var buffer bytes.Buffer
+    if err := ngstat_compile_run(config, os.TempDir(), env, &buffer, "go", "mod", "download", "-json", fmt.Sprintf("%s@%s", info.Main.Path, info.Main.Version)); err != nil {
+      return module, fmt.Errorf("downloading module `%s@%s' failed: %v", info.Main.Path, info.Main.Version, err)
+    }
+    r := struct {
+      Dir      string
+      Sum      string
+      GoModSum string
+      Error    string
+    }{}
+    if err := json.Unmarshal(buffer.Bytes(), &r); err != nil {
+      return module, err
+    }
+    if r.Error != "" {
+      return module, fmt.Errorf("downloading module `%s@%s' failed: %s", info.Main.Path, info.Main.Version, r.Error)
+    }
+    module.Dir      = r.Dir
+    module.Sum      = r.Sum
+    module.GoModSum = r.GoModSum
+  }
+  content, err := ioutil.ReadFile(filepath.Join(module.Dir, "go.mod")); if err != nil {
+    return module, err
+  }
+  ngstat_compile_parse_gomod(&module, string(content))
+  return module, nil
+}
+
+// Generate a go.mod file that pins all dependencies to the versions used
+// by the running ngstat binary. If ngstat was built from a modified or
+// local source tree, the tree given by ngstatDir is used instead. The go
+// directive is the one of the ngstat module. Modules with go 1.17 or later
+// must list all modules that provide packages, including modules that are
+// not linked into the binary, hence the requirements of the ngstat module
+// are added to the modules from the build information.
+func ngstat_compile_gomod(info *debug.BuildInfo, module compileModule, ngstatDir string) string {
+  var buffer bytes.Buffer
+  fmt.Fprintf(&buffer, "module ngstat-plugin\n\n")
+  if module.GoVersion != "" {
+    fmt.Fprintf(&buffer, "go %s\n\n", module.GoVersion)
+  }
+  fmt.Fprintf(&buffer, "require (\n")
+  if ngstatDir != "" {
+    fmt.Fprintf(&buffer, "\t%s v0.0.0\n", info.Main.Path)
+  } else {
+    fmt.Fprintf(&buffer, "\t%s %s\n", info.Main.Path, info.Main.Version)
+  }
+  linked := make(map[string]bool)
+  for _, m := range info.Deps {
+    fmt.Fprintf(&buffer, "\t%s %s\n", m.Path, m.Version)
+    linked[m.Path] = true
+  }
+  for _, r := range module.Require {
+    if !linked[r[0]] && r[0] != info.Main.Path {
+      fmt.Fprintf(&buffer, "\t%s %s\n", r[0], r[1])
+    }
+  }
+  fmt.Fprintf(&buffer, ")\n")
+  if ngstatDir != "" {
+    fmt.Fprintf(&buffer, "\nreplace %s => %s\n", info.Main.Path, ngstatDir)
+  }
+  for _, m := range info.Deps {
+    if m.Replace != nil {
+      if m.Replace.Version != "" {
+        fmt.Fprintf(&buffer, "\nreplace %s => %s %s\n", m.Path, m.Replace.Path, m.Replace.Version)
+      } else {
+        fmt.Fprintf(&buffer, "\nreplace %s => %s\n", m.Path, m.Replace.Path)
+      }
+    }
+  }
+  return buffer.String()
+}
+
+// Generate a go.sum file for the module graph of the running ngstat binary.
+// Checksums of the whole graph are taken from the go.sum file of the ngstat
+// module. Checksums of all modules linked into the binary are added from
+// the build information.
+func ngstat_compile_gosum(info *debug.BuildInfo, module compileModule, ngstatDir string) (string, error) {
+  lines := []string{}
+  if content, err := ioutil.ReadFile(filepath.Join(module.Dir, "go.sum")); err == nil {
+    lines = append(lines, strings.Split(string(content), "\n")...)
+  } else
+  if !os.IsNotExist(err) {
+    return "", err
+  }
+  if ngstatDir == "" {
+    lines = append(lines, fmt.Sprintf("%s %s %s", info.Main.Path, info.Main.Version, module.Sum))
+    lines = append(lines, fmt.Sprintf("%s %s/go.mod %s", info.Main.Path, info.Main.Version, module.GoModSum))
+  }
+  for _, m := range info.Deps {
+    if m.Replace != nil {
+      m = m.Replace
+    }
+    if m.Sum != "" {
+      lines = append(lines, fmt.Sprintf("%s %s %s", m.Path, m.Version, m.Sum))
+    }
+  }
+  // remove empty and duplicate lines
+  sort.Strings(lines)
+  var buffer bytes.Buffer
+  for i, line := range lines {
+    if line = strings.TrimSpace(line); line != "" && (i == 0 || line != strings.TrimSpace(lines[i-1])) {
+      fmt.Fprintf(&buffer, "%s\n", line)
+    }
+  }
+  return buffer.String(), nil
+}
+
+// Extract build flags and environment variables from the build settings of
+// the running binary, which must be identical for host and plugin.
+func ngstat_compile_settings(info *debug.BuildInfo) ([]string, []string) {
+  args := []string{}
+  env  := []string{}
+  for _, s := range info.Settings {
+    switch {
+    case s.Key == "-tags" || s.Key == "-gcflags" || s.Key == "-asmflags":
+      args = append(args, fmt.Sprintf("%s=%s", s.Key, s.Value))
+    case s.Key == "-trimpath" || s.Key == "-race" || s.Key == "-msan" || s.Key == "-asan":
+      if s.Value == "true" {
+        args = append(args, s.Key)
+      }
+    case s.Key == "DefaultGODEBUG":
+    case strings.HasPrefix(s.Key, "CGO_") || strings.HasPrefix(s.Key, "GO"):
+      env = append(env, fmt.Sprintf("%s=%s", s.Key, s.Value))
+    }
+  }
+  if strings.HasPrefix(info.GoVersion, "go") && !strings.Contains(info.GoVersion, " ") {
+    env = append(env, fmt.Sprintf("GOTOOLCHAIN=%s", info.GoVersion))
+  }
+  return args, env
+}
+
+// Compute the cache key of a build. The key includes the running binary,
+// since a local ngstat source tree may have changed between builds.
+func ngstat_compile_hash(gomod string, args, env, files []string) (string, error) {
+  h := sha256.New()
+  fmt.Fprintf(h, "%s\n%v\n%v\n", gomod, args, env)
+  if executable, err := os.Executable(); err != nil {
+    return "", err
+  } else {
+    content, err := ioutil.ReadFile(executable); if err != nil {
+      return "", err
+    }
+    h.Write(content)
+  }
+  sorted := append([]string{}, files...)
+  sort.Strings(sorted)
+  for _, file := range sorted {
+    content, err := ioutil.ReadFile(file); if err != nil {
+      return "", err
+    }
+    fmt.Fprintf(h, "%s\n%d\n", filepath.Base(file), len(content))
+    h.Write(content)
+  }
+  return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func ngstat_compile_copy(dst, src string) error {
+  content, err := ioutil.ReadFile(src); if err != nil {
+    return err
+  }
+  return ioutil.WriteFile(dst, content, 0755)
+}
+
+// Run a command in the given directory. The output of the command is
+// written to stdout if not nil.
+func ngstat_compile_run(config SessionConfig, dir string, env []string, stdout io.Writer, name string, args ...string) error {
+  cmd := exec.Command(name, args...)
+  cmd.Dir    = dir
+  cmd.Env    = append(os.Environ(), env...)
+  cmd.Stderr = os.Stderr
+  if stdout != nil {
+    cmd.Stdout = stdout
+  } else
+  if config.Verbose > 1 {
+    cmd.Stdout = os.Stderr
+  }
+  LogDebug(config, fmt.Sprintf("Running `%s %s' in `%s'", name, strings.Join(args, " "), dir), "command", append([]string{name}, args...), "dir", dir)
+  return cmd.Run()
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Compile a plugin against the module graph of the running ngstat binary.
+// Builds are cached by a hash of sources, module graph and build settings.
+func ngstat_compile(config SessionConfig, sources []string, output, buildDir, cacheDir, ngstatDir string, useCache bool) error {
+  info, ok := debug.ReadBuildInfo(); if !ok {
+    return fmt.Errorf("ngstat binary has no build information")
+  }
+  files, err := ngstat_compile_sources(sources); if err != nil {
+    return err
+  }
+  if output == "" {
+    output = strings.TrimSuffix(filepath.Base(files[0]), ".go") + ".so"
+    if len(sources) == 1 && filepath.Ext(sources[0]) != ".go" {
+      output = filepath.Base(filepath.Clean(sources[0])) + ".so"
+    }
+  }
+  if output, err = filepath.Abs(output); err != nil {
+    return err
+  }
+  // ngstat itself must be taken from a source tree if the binary was built
+  // from a local checkout
+  if ngstatDir == "" && (info.Main.Version == "(devel)" || info.Main.Version == "" || strings.HasSuffix(info.Main.Version, "+dirty")) {
+    if dir, err := ngstat_compile_find_module(filepath.Dir(files[0]), info.Main.Path); err != nil {
+      return fmt.Errorf("ngstat was built from a local source tree, please specify its location with --ngstat-dir (%v)", err)
+    } else {
+      ngstatDir = dir
+    }
+  }
+  if ngstatDir != "" {
+    if ngstatDir, err = filepath.Abs(ngstatDir); err != nil {
+      return err
+    }
+  }
+  args, env := ngstat_compile_settings(info)
+  module, err := ngstat_compile_module(config, env, info, ngstatDir); if err != nil {
+    return fmt.Errorf("reading ngstat module failed: %v", err)
+  }
+  gomod := ngstat_compile_gomod(info, module, ngstatDir)
+
+  hash, err := ngstat_compile_hash(gomod, args, env, files); if err != nil {
+    return err
+  }
+  cached := filepath.Join(cacheDir, hash+".so")
+  if useCache {
+    if _, err := os.Stat(cached); err == nil {
+      LogInfo(config, fmt.Sprintf("Using cached plugin build `%s'", cached), "output", output, "cache", cached)
+      return ngstat_compile_copy(output, cached)
+    }
+  }
+  // prepare build directory
+  if buildDir == "" {
+    if dir, err := ioutil.TempDir("", "ngstat-build"); err != nil {
+      return err
+    } else {
+      buildDir = dir
+      defer os.RemoveAll(buildDir)
+    }
+  } else {
+    if err := os.MkdirAll(buildDir, 0755); err != nil {
+      return err
+    }
+  }
+  for _, file := range files {
+    if err := ngstat_compile_copy(filepath.Join(buildDir, filepath.Base(file)), file); err != nil {
+      return err
+    }
+  }
+  task := BeginTask(config, fmt.Sprintf("Compiling plugin `%s'", output), "output", output)
+  // the module graph is fixed by go.mod and go.sum, it is never resolved
+  // or modified by the build
+  gosum, err := ngstat_compile_gosum(info, module, ngstatDir); if err != nil {
+    err = fmt.Errorf("resolving plugin dependencies failed: %v", err)
+    task.Failed(err)
+    return err
+  }
+  if err := ioutil.WriteFile(filepath.Join(buildDir, "go.mod"), []byte(gomod), 0644); err != nil {
+    task.Failed(err)
+    return err
+  }
+  if err := ioutil.WriteFile(filepath.Join(buildDir, "go.sum"), []byte(gosum), 0644); err != nil {
+    task.Failed(err)
+    return err
+  }
+  buildArgs := append([]string{"build", "-buildmode=plugin", "-mod=readonly", "-o", output}, args...)
+  if config.Verbose > 1 {
+    buildArgs = append(buildArgs, "-v")
+  }
+  if err := ngstat_compile_run(config, buildDir, env, nil, "go", append(buildArgs, ".")...); err != nil {
+    task.Failed(err)
+    return err
+  }
+  task.Done()
+  // check that the plugin is compatible with this binary
+  if err := ngstatPlugin.CheckBuildInfo(output); err != nil {
+    return err
+  }
+  if useCache {
+    if err := os.MkdirAll(cacheDir, 0755); err != nil {
+      return err
+    }
+    if err := ngstat_compile_copy(cached, output); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
 func ngstat_compile_main(config SessionConfig, args []string) {
 
+  cacheDir, _ := os.UserCacheDir()
+  if cacheDir != "" {
+    cacheDir = filepath.Join(cacheDir, "ngstat", "plugins")
+  }
+
   options := getopt.New()
-  options.SetProgram(fmt.Sprintf("%s statistics", os.Args[0]))
+  options.SetProgram(fmt.Sprintf("%s compile", os.Args[0]))
 
-  optHelp := options.   BoolLong("help",     'h',     "print help")
+  optOutput    := options.StringLong("output",      'o',       "", "output file [default: <PLUGIN>.so]")
+  optBuildDir  := options.StringLong("build-dir",    0 ,       "", "build directory [default: temporary directory]")
+  optCacheDir  := options.StringLong("cache-dir",    0 , cacheDir, "directory for caching plugin builds")
+  optNgstatDir := options.StringLong("ngstat-dir",   0 ,       "", "ngstat source tree [default: determined automatically]")
+  optNoCache   := options.  BoolLong("no-cache",     0 ,           "do not use cached builds")
+  optHelp      := options.  BoolLong("help",        'h',           "print help")
 
-  options.SetParameters("<PLUGIN.go>\n")
+  options.SetParameters("<PLUGIN.go>... | <PLUGIN_DIRECTORY>\n")
   options.Parse(args)
 
   // command options
@@ -49,14 +457,9 @@ func ngstat_compile_main(config SessionConfig, args []string) {
     options.PrintUsage(os.Stderr)
     os.Exit(1)
   }
+  useCache := !*optNoCache && *optCacheDir != ""
 
-  filename := options.Args()[0]
-
-  cmd := exec.Command("go", "build", "-buildmode=plugin", "-i", "-v", filename)
-  cmd.Stdout = os.Stdout
-  cmd.Stderr = os.Stderr
-
-  if err := cmd.Run(); err != nil {
+  if err := ngstat_compile(config, options.Args(), *optOutput, *optBuildDir, *optCacheDir, *optNgstatDir, useCache); err != nil {
     log.Fatal(err)
   }
 }
@@ -0,0 +1,78 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+/* -------------------------------------------------------------------------- */
+
+import   "fmt"
+import   "log"
+import   "os"
+
+import . "github.com/pbenner/ngstat/config"
+
+import   "github.com/pborman/getopt"
+
+/* -------------------------------------------------------------------------- */
+
+func ngstat_config_main(config SessionConfig, args []string) {
+
+  options := getopt.New()
+  options.SetProgram(fmt.Sprintf("%s config", os.Args[0]))
+
+  optSchema := options.  BoolLong("schema",  0 ,         "print JSON Schema of config files")
+  optExport := options.  BoolLong("export",  0 ,         "print effective config")
+  optFormat := options.StringLong("format",  0 , "json", "format of exported config [json (default), yaml, toml]")
+  optHelp   := options.  BoolLong("help",   'h',         "print help")
+
+  options.SetParameters("[<CONFIG.{json,yaml,toml}>...]\n\n" +
+    " Print the effective configuration and the source of each value. If\n" +
+    " config files are given, they are validated instead.\n")
+  options.Parse(args)
+
+  // command options
+  if *optHelp {
+    options.PrintUsage(os.Stdout)
+    os.Exit(0)
+  }
+  switch {
+  case *optSchema:
+    if err := ExportSessionConfigSchema(os.Stdout); err != nil {
+      log.Fatal(err)
+    }
+    fmt.Println()
+  case len(options.Args()) > 0:
+    failed := false
+    for _, filename := range options.Args() {
+      if _, err := ImportConfigLayerFile("config file", ConfigFile, filename); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        failed = true
+      }
+    }
+    if failed {
+      os.Exit(1)
+    }
+  case *optExport:
+    if err := ExportFormat(&config, os.Stdout, *optFormat); err != nil {
+      log.Fatal(err)
+    }
+    if *optFormat == FormatJson {
+      fmt.Println()
+    }
+  default:
+    fmt.Print(config.String())
+  }
+}
@@ -0,0 +1,102 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+/* -------------------------------------------------------------------------- */
+
+import   "fmt"
+import   "log"
+import   "os"
+import   "strconv"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/estimation"
+import . "github.com/pbenner/ngstat/options"
+
+import . "github.com/pbenner/autodiff/statistics"
+import   "github.com/pbenner/autodiff/statistics/scalarEstimator"
+import   "github.com/pbenner/autodiff/statistics/vectorDistribution"
+import   "github.com/pbenner/autodiff/statistics/vectorEstimator"
+
+import   "github.com/pborman/getopt"
+
+/* -------------------------------------------------------------------------- */
+
+func ngstat_estimate(config SessionConfig, filenameOut, filenameIn string, components []ScalarEstimator, epsilon float64, maxSteps int, seqnames []string) error {
+  mixture, err := scalarEstimator.NewDiscreteMixtureEstimator(nil, components, epsilon, maxSteps); if err != nil {
+    return err
+  }
+  mixture.Verbose = config.Verbose
+
+  estimator, err := vectorEstimator.NewScalarIid(mixture, -1); if err != nil {
+    return err
+  }
+  if err := ImportAndEstimateOnSingleTrack(config, estimator, filenameIn, WithSeqnames(seqnames...)); err != nil {
+    return err
+  }
+  d, err := estimator.GetEstimate(); if err != nil {
+    return err
+  }
+  task := BeginTask(config, fmt.Sprintf("Writing model `%s'", filenameOut), "output", filenameOut)
+  if err := ExportDistribution(filenameOut, d.(*vectorDistribution.ScalarIid).Distribution); err != nil {
+    task.Failed(err)
+    return err
+  }
+  task.Done()
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+func ngstat_estimate_main(config SessionConfig, args []string) {
+
+  options := getopt.New()
+  options.SetProgram(fmt.Sprintf("%s estimate", os.Args[0]))
+
+  optComponents := options.StringLong("components", 0, "delta:0,poisson,geometric,geometric", "comma separated list of mixture components [delta:X, poisson[:LAMBDA], geometric[:P], negative-binomial[:R:P], normal[:MU:SIGMA]]")
+  optEpsilon    := options.StringLong("epsilon",    0, "1e-8", "stop estimation if the change in likelihood is smaller than epsilon")
+  optMaxSteps   := options.   IntLong("max-steps",  0,     -1, "maximum number of EM steps [default: unlimited]")
+  optSeqnames   := options.StringLong("seqnames",   0,     "", "comma separated list of sequences used for estimation")
+  optHelp       := options.  BoolLong("help",      'h',        "print help")
+
+  options.SetParameters("<OUTPUT.json> <INPUT.bw>\n")
+  options.Parse(args)
+
+  // command options
+  if *optHelp {
+    options.PrintUsage(os.Stdout)
+    os.Exit(0)
+  }
+  // command arguments
+  if len(options.Args()) != 2 {
+    options.PrintUsage(os.Stderr)
+    os.Exit(1)
+  }
+  components, err := parseMixtureComponents(*optComponents); if err != nil {
+    log.Fatal(err)
+  }
+  epsilon, err := strconv.ParseFloat(*optEpsilon, 64); if err != nil {
+    log.Fatalf("parsing epsilon failed: %v", err)
+  }
+  filenameOut := options.Args()[0]
+  filenameIn  := options.Args()[1]
+
+  if err := ngstat_estimate(config, filenameOut, filenameIn, components, epsilon, *optMaxSteps, parseStrings(*optSeqnames)); err != nil {
+    log.Fatal(err)
+  }
+}
@@ -0,0 +1,171 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+/* -------------------------------------------------------------------------- */
+
+import   "bufio"
+import   "fmt"
+import   "io"
+import   "log"
+import   "math"
+import   "os"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/classification"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/track"
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/gonetics"
+
+import   "github.com/pborman/getopt"
+
+/* -------------------------------------------------------------------------- */
+
+// Convert a prediction track and a set of true regions into a vector of
+// test values and a vector of binary labels (one entry per bin). Bins with
+// NaN predictions are skipped.
+func ngstat_evaluate_data(track Track, truth GRanges) ([]int, []float64, error) {
+  binSize := track.GetBinSize()
+  labels  := []int{}
+  values  := []float64{}
+  for _, name := range track.GetSeqNames() {
+    seq, err := track.GetSequence(name); if err != nil {
+      return nil, nil, err
+    }
+    g := make([]int, seq.NBins())
+    for i := 0; i < truth.Length(); i++ {
+      if truth.Seqnames[i] != name {
+        continue
+      }
+      for k := truth.Ranges[i].From/binSize; k < DivIntUp(truth.Ranges[i].To, binSize) && k < seq.NBins(); k++ {
+        g[k] = 1
+      }
+    }
+    for i := 0; i < seq.NBins(); i++ {
+      if v := seq.AtBin(i); !math.IsNaN(v) {
+        labels = append(labels, g[i])
+        values = append(values, v)
+      }
+    }
+  }
+  if len(values) == 0 {
+    return nil, nil, fmt.Errorf("prediction track contains no data")
+  }
+  return labels, values, nil
+}
+
+func ngstat_evaluate_write(w io.Writer, curve string, labels []int, values []float64, n int) error {
+  var thr, x, y []float64
+  var xName, yName string
+  var err error
+  switch curve {
+  case "roc":
+    thr, x, y, err = RocCurve(labels, values, n)
+    xName, yName = "fpr", "tpr"
+  case "precision-recall":
+    thr, x, y, err = PrecisionRecallCurve(labels, values, n)
+    xName, yName = "recall", "precision"
+  default:
+    return fmt.Errorf("invalid curve `%s'", curve)
+  }
+  if err != nil {
+    return err
+  }
+  auc, err := AUC(x, y); if err != nil {
+    return err
+  }
+  if _, err := fmt.Fprintf(w, "# auc: %f\n", auc); err != nil {
+    return err
+  }
+  if _, err := fmt.Fprintf(w, "threshold\t%s\t%s\n", xName, yName); err != nil {
+    return err
+  }
+  for i := 0; i < len(thr); i++ {
+    if _, err := fmt.Fprintf(w, "%v\t%v\t%v\n", thr[i], x[i], y[i]); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// Evaluate a prediction track against a set of true regions and write the
+// ROC or precision-recall curve together with its AUC.
+func ngstat_evaluate(config SessionConfig, w io.Writer, filenamePrediction, filenameTruth, curve string, n int) error {
+  track, err := ImportTrack(config, filenamePrediction); if err != nil {
+    return err
+  }
+  truth := GRanges{}
+  task := BeginTask(config, fmt.Sprintf("Importing regions from `%s'", filenameTruth), "input", filenameTruth)
+  if err := truth.ImportBed3(filenameTruth); err != nil {
+    task.Failed(err)
+    return err
+  }
+  task.Done()
+
+  labels, values, err := ngstat_evaluate_data(track, truth); if err != nil {
+    return err
+  }
+  return ngstat_evaluate_write(w, curve, labels, values, n)
+}
+
+/* -------------------------------------------------------------------------- */
+
+func ngstat_evaluate_main(config SessionConfig, args []string) {
+
+  options := getopt.New()
+  options.SetProgram(fmt.Sprintf("%s evaluate", os.Args[0]))
+
+  optCurve  := options.StringLong("curve",  0, "roc", "performance curve [roc (default), precision-recall]")
+  optN      := options.   IntLong("n",      0,  1000, "number of thresholds")
+  optOutput := options.StringLong("output", 0,    "", "output file [default: stdout]")
+  optHelp   := options.  BoolLong("help",  'h',       "print help")
+
+  options.SetParameters("<PREDICTION.bw> <TRUTH.bed>\n")
+  options.Parse(args)
+
+  // command options
+  if *optHelp {
+    options.PrintUsage(os.Stdout)
+    os.Exit(0)
+  }
+  // command arguments
+  if len(options.Args()) != 2 {
+    options.PrintUsage(os.Stderr)
+    os.Exit(1)
+  }
+  if *optN < 1 {
+    log.Fatalf("invalid number of thresholds `%d'", *optN)
+  }
+  filenamePrediction := options.Args()[0]
+  filenameTruth      := options.Args()[1]
+
+  var w io.Writer = os.Stdout
+  if *optOutput != "" {
+    f, err := os.Create(*optOutput); if err != nil {
+      log.Fatal(err)
+    }
+    defer f.Close()
+    b := bufio.NewWriter(f)
+    defer b.Flush()
+    w = b
+  }
+  if err := ngstat_evaluate(config, w, filenamePrediction, filenameTruth, *optCurve, *optN); err != nil {
+    log.Fatal(err)
+  }
+}
@@ -22,26 +22,35 @@ import   "fmt"
 import   "log"
 import   "os"
 import   "plugin"
+import   "strings"
 
 import . "github.com/pbenner/ngstat/config"
 import . "github.com/pbenner/ngstat/io"
+import   "github.com/pbenner/ngstat/ngstatPlugin"
 
 import   "github.com/pborman/getopt"
 
 /* -------------------------------------------------------------------------- */
 
-func ngstat_exec_load_config(config *SessionConfig, plugin *plugin.Plugin) {
+// Plugins may provide config values through a config file (ConfigFilename),
+// a config variable (ConfigVariable), or a map of values indexed by config
+// keys (ConfigValues). Values from the plugin override all config files and
+// environment variables, but not options given on the command line. Only
+// keys set by the plugin are overridden, i.e. fields of ConfigVariable that
+// are equal to the defaults are ignored.
+func ngstat_exec_load_config(config *SessionConfig, layers ConfigLayers, plugin *plugin.Plugin) {
   f, err := plugin.Lookup("ConfigFilename")
   if err == nil {
     switch filename := f.(type) {
     case *string:
-      current_config := *config
-      PrintStderr(current_config, 1, "Importing config file `%s'... ", *filename)
-      if err := config.ImportFile(*filename); err != nil {
-        PrintStderr(current_config, 1, "failed\n")
+      task := BeginTask(*config, fmt.Sprintf("Importing config file `%s'", *filename), "input", *filename)
+      if layer, err := ImportConfigLayerFile("plugin file", ConfigPlugin, *filename); err != nil {
+        task.Failed(err)
         log.Fatalf("reading config file `%s' failed: %v", *filename, err)
+      } else {
+        layers = layers.Add(layer)
       }
-      PrintStderr(current_config, 1, "done\n")
+      task.Done()
     default:
       log.Fatal("error while reading config filename: variable has invalid type")
     }
@@ -50,12 +59,31 @@ func ngstat_exec_load_config(config *SessionConfig, plugin *plugin.Plugin) {
   if err == nil {
     switch configPtr := c.(type) {
     case *SessionConfig:
-      PrintStderr(*config, 1, "Importing config from plugin.\n")
-      *config = *configPtr
+      LogInfo(*config, "Importing config from plugin")
+      layers = layers.Add(NewConfigLayerFromConfig("plugin", ConfigPlugin, *configPtr))
     default:
       log.Fatal("error while reading config: variable has invalid type")
     }
   }
+  v, err := plugin.Lookup("ConfigValues")
+  if err == nil {
+    switch values := v.(type) {
+    case *map[string]interface{}:
+      LogInfo(*config, "Importing config values from plugin")
+      if layer, err := NewConfigLayerFromValues("plugin", ConfigPlugin, *values); err != nil {
+        log.Fatal(err)
+      } else {
+        layers = layers.Add(layer)
+      }
+    default:
+      log.Fatal("error while reading config values: variable has invalid type")
+    }
+  }
+  if c, err := layers.Apply(); err != nil {
+    log.Fatal(err)
+  } else {
+    *config = c
+  }
 }
 
 /* -------------------------------------------------------------------------- */
@@ -81,20 +109,84 @@ func ngstat_exec_generic_main(config SessionConfig, args []string, plugin *plugi
   case func():
     f()
   default:
-    log.Fatal("error while executing plugin: function has invalid type")
+    log.Fatalf("error while executing plugin: function `%s' has invalid type `%T' (expected e.g. `func(config SessionConfig, args []string)')", fname, g)
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Import the manifest of a plugin. Plugins without manifest are accepted
+// for backward compatibility, in which case nil is returned.
+func ngstat_exec_load_manifest(config SessionConfig, plugin *plugin.Plugin) *ngstatPlugin.Manifest {
+  m, err := plugin.Lookup("Manifest")
+  if err != nil {
+    LogDebug(config, "Plugin has no manifest")
+    return nil
+  }
+  switch manifest := m.(type) {
+  case *ngstatPlugin.Manifest:
+    if err := manifest.CheckCompatibility(Version); err != nil {
+      log.Fatal(err)
+    }
+    return manifest
+  default:
+    log.Fatal("error while reading manifest: variable has invalid type")
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Execute a plugin that runs as a separate process.
+func ngstat_exec_process(config SessionConfig, filename string, socket, list bool, args []string) {
+  p, err := ngstatPlugin.StartProcess(filename, socket)
+  if err != nil {
+    log.Fatal(err)
+  }
+  manifest, err := p.Manifest()
+  if err != nil {
+    log.Fatal(err)
+  }
+  if err := manifest.CheckCompatibility(Version); err != nil {
+    p.Close()
+    log.Fatal(err)
+  }
+  if list {
+    p.Close()
+    fmt.Print(manifest.String())
+    return
+  }
+  command := args[0]
+
+  if _, ok := manifest.Lookup(command); !ok {
+    p.Close()
+    log.Fatalf("plugin `%s' does not provide function `%s' (available functions: %s)", manifest.Name, command, strings.Join(manifest.FunctionNames(), ", "))
+  }
+  fmt.Fprintf(os.Stderr, "%s", config.String())
+
+  if err := p.Call(config, command, args[1:]); err != nil {
+    p.Close()
+    log.Fatal(err)
+  }
+  if err := p.Close(); err != nil {
+    log.Fatalf("plugin `%s' exited with error: %v", manifest.Name, err)
   }
 }
 
 /* -------------------------------------------------------------------------- */
 
-func ngstat_exec_main(config SessionConfig, args []string) {
+func ngstat_exec_main(config SessionConfig, layers ConfigLayers, args []string) {
 
   options := getopt.New()
   options.SetProgram(fmt.Sprintf("%s statistics", os.Args[0]))
 
-  optHelp := options.   BoolLong("help",     'h',     "print help")
+  optList    := options.   BoolLong("list",      0 ,     "list functions provided by the plugin")
+  optForce   := options.   BoolLong("force",     0 ,     "skip compatibility check of the plugin build")
+  optProcess := options.   BoolLong("process",   0 ,     "run plugin as separate process (default for plugins without .so extension)")
+  optSocket  := options.   BoolLong("socket",    0 ,     "communicate with plugin process through a Unix socket instead of stdin/stdout")
+  optHelp    := options.   BoolLong("help",     'h',     "print help")
 
-  options.SetParameters("<PLUGIN.so> <FUNCTION_NAME>\n")
+  options.SetParameters("<PLUGIN.so|PLUGIN> <FUNCTION_NAME>\n")
   options.Parse(args)
 
   // command options
@@ -103,19 +195,42 @@ func ngstat_exec_main(config SessionConfig, args []string) {
     os.Exit(0)
   }
   // command arguments
-  if len(options.Args()) < 2 {
+  if len(options.Args()) < 2 && !(*optList && len(options.Args()) == 1) {
     options.PrintUsage(os.Stderr)
     os.Exit(1)
   }
 
   filename := options.Args()[0]
-  command  := options.Args()[1]
 
+  if *optProcess || *optSocket || !strings.HasSuffix(filename, ".so") {
+    ngstat_exec_process(config, filename, *optSocket, *optList, options.Args()[1:])
+    return
+  }
+  if !*optForce {
+    if err := ngstatPlugin.CheckBuildInfo(filename); err != nil {
+      log.Fatal(err)
+    }
+  }
   p, err := plugin.Open(filename)
   if err != nil {
     log.Fatalf("opening plugin `%s' failed: %v", filename, err)
   }
+  manifest := ngstat_exec_load_manifest(config, p)
 
-  ngstat_exec_load_config(&config, p)
+  if *optList {
+    if manifest == nil {
+      log.Fatalf("plugin `%s' has no manifest", filename)
+    }
+    fmt.Print(manifest.String())
+    return
+  }
+  command := options.Args()[1]
+
+  if manifest != nil {
+    if _, ok := manifest.Lookup(command); !ok {
+      log.Fatalf("plugin `%s' does not provide function `%s' (available functions: %s)", manifest.Name, command, strings.Join(manifest.FunctionNames(), ", "))
+    }
+  }
+  ngstat_exec_load_config(&config, layers, p)
   ngstat_exec_generic_main(config, options.Args()[2:len(options.Args())], p, command)
 }
@@ -0,0 +1,391 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+/* -------------------------------------------------------------------------- */
+
+import   "bytes"
+import   "encoding/json"
+import   "fmt"
+import   "io"
+import   "math"
+import   "os"
+import   "strings"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/classification"
+import . "github.com/pbenner/ngstat/track"
+
+import . "github.com/pbenner/gonetics"
+
+/* pipeline definition
+ * -------------------------------------------------------------------------- */
+
+// A pipeline is a set of steps, where each step runs a command on a set of
+// input files and produces a set of output files. Dependencies between steps
+// are given by input and output files, and by explicit DependsOn entries.
+type Pipeline struct {
+  Config    json.RawMessage
+  Steps   []PipelineStep
+}
+
+type PipelineStep struct {
+  Name        string
+  Command     string
+  Inputs    []string
+  Outputs   []string
+  DependsOn []string
+  Options     json.RawMessage
+  Config      json.RawMessage
+}
+
+func (pipeline *Pipeline) Import(reader io.Reader, args... interface{}) error {
+  return JsonImportStrict(reader, pipeline)
+}
+
+func (pipeline *Pipeline) Export(writer io.Writer) error {
+  return JsonExport(writer, pipeline)
+}
+
+func (pipeline *Pipeline) ImportFile(filename string) error {
+  return ImportFile(pipeline, filename)
+}
+
+/* pipeline commands
+ * -------------------------------------------------------------------------- */
+
+type pipelineCommand struct {
+  // minimum and maximum number of inputs (-1: unlimited)
+  MinInputs   int
+  MaxInputs   int
+  // minimum and maximum number of outputs
+  MinOutputs  int
+  MaxOutputs  int
+  // allocate options with default values
+  Options     func() interface{}
+  Run         func(config SessionConfig, inputs, outputs []string, options interface{}) error
+}
+
+type pipelineTransformOptions struct {
+  Function    string
+  Pseudocount float64
+}
+
+type pipelineEstimateOptions struct {
+  Components  string
+  Epsilon     float64
+  MaxSteps    int      `json:"Max Steps"`
+  Seqnames  []string
+}
+
+type pipelineClassifyOptions struct {
+  Components    []int
+  Log             bool
+  Separate        bool
+  SeqnameModels   map[string]string `json:"Seqname Models"`
+  Regions         string
+  RegionModels    map[string]string `json:"Region Models"`
+}
+
+type pipelineCallPeaksOptions struct {
+  Thresholds   []float64
+  WindowSize     int     `json:"Window Size"`
+  Summits        bool
+  MinProminence  float64 `json:"Min Prominence"`
+  MinValleyDepth float64 `json:"Min Valley Depth"`
+  Smoothing      int
+  Split          bool
+}
+
+type pipelineSegmentOptions struct {
+  StateNames []string `json:"State Names"`
+  Palette      string
+  ChunkSize    int    `json:"Chunk Size"`
+  ChunkOverlap int    `json:"Chunk Overlap"`
+}
+
+type pipelineEvaluateOptions struct {
+  Curve string
+  N     int
+}
+
+type pipelineSegmentationHistogramOptions struct {
+  Genome string
+  States int
+}
+
+var pipelineCommands = map[string]pipelineCommand{
+  "import-track": pipelineCommand{1, 1, 1, 1,
+    func() interface{} { return nil },
+    func(config SessionConfig, inputs, outputs []string, options interface{}) error {
+      if track, err := ImportTrack(config, inputs[0]); err != nil {
+        return err
+      } else {
+        return ExportTrack(config, track, outputs[0])
+      }
+    } },
+  "transform": pipelineCommand{1, 1, 1, 1,
+    func() interface{} { return &pipelineTransformOptions{} },
+    func(config SessionConfig, inputs, outputs []string, options interface{}) error {
+      opts := options.(*pipelineTransformOptions)
+      f, err := pipelineTransformFunction(opts.Function); if err != nil {
+        return err
+      }
+      track, err := ImportTrack(config, inputs[0]); if err != nil {
+        return err
+      }
+      if err := (GenericMutableTrack{MutableTrack: track}).Map(track, func(seqname string, position int, value float64) float64 {
+        return f(value + opts.Pseudocount)
+      }); err != nil {
+        return err
+      }
+      return ExportTrack(config, track, outputs[0])
+    } },
+  "estimate": pipelineCommand{1, 1, 1, 1,
+    func() interface{} { return &pipelineEstimateOptions{Components: "delta:0,poisson,geometric,geometric", Epsilon: 1e-8, MaxSteps: -1} },
+    func(config SessionConfig, inputs, outputs []string, options interface{}) error {
+      opts := options.(*pipelineEstimateOptions)
+      components, err := parseMixtureComponents(opts.Components); if err != nil {
+        return err
+      }
+      return ngstat_estimate(config, outputs[0], inputs[0], components, opts.Epsilon, opts.MaxSteps, opts.Seqnames)
+    } },
+  "classify": pipelineCommand{2, 2, 1, 1,
+    func() interface{} { return &pipelineClassifyOptions{} },
+    func(config SessionConfig, inputs, outputs []string, options interface{}) error {
+      opts := options.(*pipelineClassifyOptions)
+      if len(opts.Components) == 0 {
+        return fmt.Errorf("empty set of foreground components")
+      }
+      return ngstat_classify(config, outputs[0], inputs[0], inputs[1], opts.Components, opts.Log, opts.Separate, opts.SeqnameModels, opts.Regions, opts.RegionModels)
+    } },
+  "call-peaks": pipelineCommand{1, -1, 1, 1,
+    func() interface{} { return &pipelineCallPeaksOptions{Thresholds: []float64{0.5}} },
+    func(config SessionConfig, inputs, outputs []string, options interface{}) error {
+      opts := options.(*pipelineCallPeaksOptions)
+      thresholds := opts.Thresholds
+      if len(thresholds) == 1 {
+        for len(thresholds) < len(inputs) {
+          thresholds = append(thresholds, thresholds[0])
+        }
+      }
+      if len(thresholds) != len(inputs) {
+        return fmt.Errorf("number of thresholds does not match number of inputs")
+      }
+      parameters := DefaultSummitParameters()
+      parameters.MinProminence  = opts.MinProminence
+      parameters.MinValleyDepth = opts.MinValleyDepth
+      parameters.Smoothing      = opts.Smoothing
+      parameters.Split          = opts.Split
+      return ngstat_call_peaks(config, outputs[0], inputs, thresholds, opts.WindowSize, opts.Summits, parameters)
+    } },
+  "segment": pipelineCommand{2, 2, 1, 2,
+    func() interface{} { return &pipelineSegmentOptions{ChunkOverlap: 1000} },
+    func(config SessionConfig, inputs, outputs []string, options interface{}) error {
+      opts   := options.(*pipelineSegmentOptions)
+      legend := ""
+      if len(outputs) == 2 {
+        legend = outputs[1]
+      }
+      return ngstat_segment(config, outputs[0], inputs[0], inputs[1], opts.StateNames, opts.Palette, legend, opts.ChunkSize, opts.ChunkOverlap)
+    } },
+  "evaluate": pipelineCommand{2, 2, 1, 1,
+    func() interface{} { return &pipelineEvaluateOptions{Curve: "roc", N: 1000} },
+    func(config SessionConfig, inputs, outputs []string, options interface{}) error {
+      opts := options.(*pipelineEvaluateOptions)
+      return pipelineWriteFile(outputs[0], func(w io.Writer) error {
+        return ngstat_evaluate(config, w, inputs[0], inputs[1], opts.Curve, opts.N)
+      })
+    } },
+  "segmentation-histogram": pipelineCommand{2, -1, 1, 1,
+    func() interface{} { return &pipelineSegmentationHistogramOptions{} },
+    func(config SessionConfig, inputs, outputs []string, options interface{}) error {
+      opts := options.(*pipelineSegmentationHistogramOptions)
+      return pipelineWriteFile(outputs[0], func(w io.Writer) error {
+        return ngstat_segmentation_histogram(config, w, inputs[0], inputs[1:], opts.Genome, opts.States)
+      })
+    } },
+}
+
+func pipelineCommandNames() []string {
+  return []string{"import-track", "transform", "estimate", "classify", "call-peaks", "segment", "evaluate", "segmentation-histogram"}
+}
+
+func pipelineTransformFunction(name string) (func(float64) float64, error) {
+  switch name {
+  case "", "identity":
+    return func(x float64) float64 { return x }, nil
+  case "log":
+    return math.Log, nil
+  case "log2":
+    return math.Log2, nil
+  case "log10":
+    return math.Log10, nil
+  case "exp":
+    return math.Exp, nil
+  case "sqrt":
+    return math.Sqrt, nil
+  case "abs":
+    return math.Abs, nil
+  default:
+    return nil, fmt.Errorf("invalid transform function `%s'", name)
+  }
+}
+
+func pipelineWriteFile(filename string, f func(io.Writer) error) error {
+  w, err := os.Create(filename); if err != nil {
+    return err
+  }
+  if err := f(w); err != nil {
+    w.Close()
+    return err
+  }
+  return w.Close()
+}
+
+/* pipeline validation
+ * -------------------------------------------------------------------------- */
+
+// Decode options of a step, unknown options are rejected.
+func (step PipelineStep) decodeOptions(command pipelineCommand) (interface{}, error) {
+  options := command.Options()
+  if len(step.Options) == 0 {
+    return options, nil
+  }
+  if options == nil {
+    return nil, fmt.Errorf("command `%s' has no options", step.Command)
+  }
+  decoder := json.NewDecoder(bytes.NewReader(step.Options))
+  decoder.DisallowUnknownFields()
+  if err := decoder.Decode(options); err != nil {
+    return nil, fmt.Errorf("invalid options: %v", err)
+  }
+  return options, nil
+}
+
+// Apply configuration values of the pipeline or a step on top of the given
+// configuration.
+func pipelineConfig(config SessionConfig, source string, raw json.RawMessage) (SessionConfig, error) {
+  if len(raw) == 0 {
+    return config, nil
+  }
+  if layer, err := ImportConfigLayer(source, ConfigFile, bytes.NewReader(raw)); err != nil {
+    return config, err
+  } else {
+    if err := config.ApplyLayer(layer); err != nil {
+      return config, err
+    }
+  }
+  if err := config.Validate(); err != nil {
+    return config, fmt.Errorf("%s: %v", source, err)
+  }
+  return config, nil
+}
+
+// Check the pipeline for errors and return the order in which steps must
+// be executed. Steps are executed in the order given in the pipeline file,
+// unless a step depends on a later one.
+func (pipeline *Pipeline) Validate() ([]int, error) {
+  names    := make(map[string]int)
+  producer := make(map[string]int)
+  for i, step := range pipeline.Steps {
+    if step.Name == "" {
+      return nil, fmt.Errorf("step %d: missing name", i+1)
+    }
+    if _, ok := names[step.Name]; ok {
+      return nil, fmt.Errorf("step `%s': name is not unique", step.Name)
+    }
+    names[step.Name] = i
+    command, ok := pipelineCommands[step.Command]; if !ok {
+      return nil, fmt.Errorf("step `%s': invalid command `%s' (available commands: %s)", step.Name, step.Command, strings.Join(pipelineCommandNames(), ", "))
+    }
+    if n := len(step.Inputs); n < command.MinInputs || (command.MaxInputs != -1 && n > command.MaxInputs) {
+      return nil, fmt.Errorf("step `%s': invalid number of inputs for command `%s'", step.Name, step.Command)
+    }
+    if n := len(step.Outputs); n < command.MinOutputs || n > command.MaxOutputs {
+      return nil, fmt.Errorf("step `%s': invalid number of outputs for command `%s'", step.Name, step.Command)
+    }
+    if _, err := step.decodeOptions(command); err != nil {
+      return nil, fmt.Errorf("step `%s': %v", step.Name, err)
+    }
+    if _, err := pipelineConfig(DefaultSessionConfig(), fmt.Sprintf("step `%s'", step.Name), step.Config); err != nil {
+      return nil, err
+    }
+    for _, output := range step.Outputs {
+      if j, ok := producer[output]; ok {
+        return nil, fmt.Errorf("step `%s': output `%s' is also produced by step `%s'", step.Name, output, pipeline.Steps[j].Name)
+      }
+      producer[output] = i
+    }
+  }
+  // collect dependencies
+  deps := make([][]int, len(pipeline.Steps))
+  for i, step := range pipeline.Steps {
+    for _, input := range step.Inputs {
+      if j, ok := producer[input]; ok {
+        if j == i {
+          return nil, fmt.Errorf("step `%s': input `%s' is also an output of this step", step.Name, input)
+        }
+        deps[i] = append(deps[i], j)
+      } else {
+        if _, err := os.Stat(input); err != nil {
+          return nil, fmt.Errorf("step `%s': input `%s' does not exist and is not produced by any step", step.Name, input)
+        }
+      }
+    }
+    for _, name := range step.DependsOn {
+      if j, ok := names[name]; !ok {
+        return nil, fmt.Errorf("step `%s': depends on unknown step `%s'", step.Name, name)
+      } else {
+        deps[i] = append(deps[i], j)
+      }
+    }
+  }
+  // topological sort
+  order := []int{}
+  done  := make([]bool, len(pipeline.Steps))
+  for len(order) < len(pipeline.Steps) {
+    progress := false
+    for i := range pipeline.Steps {
+      if done[i] {
+        continue
+      }
+      ready := true
+      for _, j := range deps[i] {
+        if !done[j] {
+          ready = false
+        }
+      }
+      if ready {
+        order    = append(order, i)
+        done[i]  = true
+        progress = true
+        break
+      }
+    }
+    if !progress {
+      cycle := []string{}
+      for i, step := range pipeline.Steps {
+        if !done[i] {
+          cycle = append(cycle, step.Name)
+        }
+      }
+      return nil, fmt.Errorf("pipeline contains a cycle involving steps `%s'", strings.Join(cycle, "', `"))
+    }
+  }
+  return order, nil
+}
@@ -0,0 +1,159 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+/* -------------------------------------------------------------------------- */
+
+import   "fmt"
+import   "log"
+import   "os"
+import   "time"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+
+import   "github.com/pborman/getopt"
+
+/* -------------------------------------------------------------------------- */
+
+// A step is up to date if all outputs exist and are newer than all inputs.
+func pipelineStepUpToDate(step PipelineStep) bool {
+  tInput := time.Time{}
+  for _, input := range step.Inputs {
+    if info, err := os.Stat(input); err != nil {
+      return false
+    } else {
+      if info.ModTime().After(tInput) {
+        tInput = info.ModTime()
+      }
+    }
+  }
+  for _, output := range step.Outputs {
+    if info, err := os.Stat(output); err != nil {
+      return false
+    } else {
+      if !info.ModTime().After(tInput) {
+        return false
+      }
+    }
+  }
+  return true
+}
+
+func ngstat_run(config SessionConfig, pipeline *Pipeline, force, dryRun bool) error {
+  order, err := pipeline.Validate(); if err != nil {
+    return err
+  }
+  config, err = pipelineConfig(config, "pipeline", pipeline.Config); if err != nil {
+    return err
+  }
+  // outputs that are (or would be) recreated during this run
+  stale := make(map[string]bool)
+
+  for _, i := range order {
+    step := pipeline.Steps[i]
+    // check if step must be executed
+    run := force || !pipelineStepUpToDate(step)
+    for _, input := range step.Inputs {
+      if stale[input] {
+        run = true
+      }
+    }
+    if !run {
+      LogInfo(config, fmt.Sprintf("Skipping step `%s' (outputs are up to date)", step.Name), "step", step.Name)
+      if report := GetRunReport(); report != nil && !dryRun {
+        report.AddStep(RunReportStep{Name: step.Name, Command: step.Command, Inputs: step.Inputs, Outputs: step.Outputs, Start: time.Now(), Status: "skipped"})
+      }
+      continue
+    }
+    for _, output := range step.Outputs {
+      stale[output] = true
+    }
+    if dryRun {
+      fmt.Printf("%s: %s %v -> %v\n", step.Name, step.Command, step.Inputs, step.Outputs)
+      continue
+    }
+    stepConfig, err := pipelineConfig(config, fmt.Sprintf("step `%s'", step.Name), step.Config); if err != nil {
+      return err
+    }
+    stepConfig  = stepConfig.WithLogFields("step", step.Name)
+    command    := pipelineCommands[step.Command]
+    options, _ := step.decodeOptions(command)
+
+    LogInfo(config, fmt.Sprintf("Running step `%s' (%s)", step.Name, step.Command), "step", step.Name, "command", step.Command)
+    start := time.Now()
+    err    = command.Run(stepConfig, step.Inputs, step.Outputs, options)
+    if report := GetRunReport(); report != nil {
+      r := RunReportStep{Name: step.Name, Command: step.Command, Inputs: step.Inputs, Outputs: step.Outputs, Start: start, Duration: time.Since(start).Seconds(), Status: "done"}
+      if err != nil {
+        r.Status = "failed"
+        r.Error  = err.Error()
+      }
+      report.AddStep(r)
+    }
+    if err != nil {
+      return fmt.Errorf("step `%s' failed: %v", step.Name, err)
+    }
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+func ngstat_run_main(config SessionConfig, args []string) {
+
+  options := getopt.New()
+  options.SetProgram(fmt.Sprintf("%s run", os.Args[0]))
+
+  optForce    := options.BoolLong("force",    'f', "run all steps, even if outputs are up to date")
+  optDryRun   := options.BoolLong("dry-run",  'n', "print steps that would be executed")
+  optValidate := options.BoolLong("validate",  0 , "only validate the pipeline")
+  optHelp     := options.BoolLong("help",     'h', "print help")
+
+  options.SetParameters("<PIPELINE.json>\n")
+  options.Parse(args)
+
+  // command options
+  if *optHelp {
+    options.PrintUsage(os.Stdout)
+    os.Exit(0)
+  }
+  // command arguments
+  if len(options.Args()) != 1 {
+    options.PrintUsage(os.Stderr)
+    os.Exit(1)
+  }
+  filename := options.Args()[0]
+  pipeline := Pipeline{}
+
+  task := BeginTask(config, fmt.Sprintf("Importing pipeline `%s'", filename), "input", filename)
+  if err := pipeline.ImportFile(filename); err != nil {
+    task.Failed(err)
+    log.Fatalf("reading pipeline `%s' failed: %v", filename, err)
+  }
+  task.Done()
+
+  if *optValidate {
+    if _, err := pipeline.Validate(); err != nil {
+      log.Fatal(err)
+    }
+    return
+  }
+  if err := ngstat_run(config, &pipeline, *optForce, *optDryRun); err != nil {
+    log.Fatal(err)
+  }
+}
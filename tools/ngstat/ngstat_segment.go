@@ -0,0 +1,130 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+/* -------------------------------------------------------------------------- */
+
+import   "fmt"
+import   "log"
+import   "os"
+import   "strings"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/classification"
+import . "github.com/pbenner/ngstat/options"
+import . "github.com/pbenner/ngstat/track"
+
+import . "github.com/pbenner/autodiff"
+import . "github.com/pbenner/autodiff/statistics"
+import   "github.com/pbenner/autodiff/statistics/vectorClassifier"
+import   "github.com/pbenner/autodiff/statistics/vectorDistribution"
+
+import   "github.com/pborman/getopt"
+
+/* -------------------------------------------------------------------------- */
+
+// Segment a track using the Viterbi path of a hidden Markov model and
+// export the segmentation as bed file. Sequences are split into overlapping
+// chunks if chunkSize is positive.
+func ngstat_segment(config SessionConfig, filenameOut, filenameModel, filenameIn string, stateNames []string, palette, legend string, chunkSize, chunkOverlap int) error {
+  var hmm *vectorDistribution.Hmm
+  task := BeginTask(config, fmt.Sprintf("Reading model `%s'", filenameModel), "input", filenameModel)
+  if d, err := ImportVectorPdf(filenameModel, Float64Type); err != nil {
+    task.Failed(err)
+    return err
+  } else {
+    task.Done()
+    if m, ok := d.(*vectorDistribution.Hmm); !ok {
+      return fmt.Errorf("model `%s' is not a hidden Markov model", filenameModel)
+    } else {
+      hmm = m
+    }
+  }
+  if len(stateNames) == 0 {
+    for i := 0; i < hmm.NStates(); i++ {
+      stateNames = append(stateNames, fmt.Sprintf("s%d", i))
+    }
+  }
+  if len(stateNames) != hmm.NStates() {
+    return fmt.Errorf("number of state names does not match number of states `%d'", hmm.NStates())
+  }
+  track, err := ImportTrack(config, filenameIn); if err != nil {
+    return err
+  }
+  options := []Option{}
+  if chunkSize > 0 {
+    options = append(options, WithChunks(chunkSize, chunkOverlap))
+  }
+  result, err := ClassifySingleTrack(config, vectorClassifier.HmmClassifier{Hmm: hmm}, track, options...); if err != nil {
+    return err
+  }
+  var p *Palette
+  if palette != "" {
+    if r, err := GetPalette(palette, hmm.NStates()); err != nil {
+      return err
+    } else {
+      p = &r
+    }
+  }
+  compress := strings.HasSuffix(filenameOut, ".gz")
+  if err := ExportTrackSegmentation(config, result, filenameOut, "segmentation", "", compress, stateNames, nil, nil, p); err != nil {
+    return err
+  }
+  if legend != "" {
+    if err := ExportTrackSegmentationLegend(config, legend, stateNames, nil, p); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+func ngstat_segment_main(config SessionConfig, args []string) {
+
+  options := getopt.New()
+  options.SetProgram(fmt.Sprintf("%s segment", os.Args[0]))
+
+  optStateNames   := options.StringLong("state-names",   0,   "", "comma separated list of state names [default: s0, s1, ...]")
+  optPalette      := options.StringLong("palette",       0,   "", "name of a color palette or json file [default: qualitative]")
+  optLegend       := options.StringLong("legend",        0,   "", "export legend to given file (.svg or .tsv)")
+  optChunkSize    := options.   IntLong("chunk-size",    0,    0, "split sequences into chunks of given size (in bins) that are processed in parallel [default: no chunks]")
+  optChunkOverlap := options.   IntLong("chunk-overlap", 0, 1000, "overlap (in bins) between consecutive chunks")
+  optHelp         := options.  BoolLong("help",         'h',      "print help")
+
+  options.SetParameters("<MODEL.json> <OUTPUT.bed> <INPUT.bw>\n")
+  options.Parse(args)
+
+  // command options
+  if *optHelp {
+    options.PrintUsage(os.Stdout)
+    os.Exit(0)
+  }
+  // command arguments
+  if len(options.Args()) != 3 {
+    options.PrintUsage(os.Stderr)
+    os.Exit(1)
+  }
+  filenameModel := options.Args()[0]
+  filenameOut   := options.Args()[1]
+  filenameIn    := options.Args()[2]
+
+  if err := ngstat_segment(config, filenameOut, filenameModel, filenameIn, parseStrings(*optStateNames), *optPalette, *optLegend, *optChunkSize, *optChunkOverlap); err != nil {
+    log.Fatal(err)
+  }
+}
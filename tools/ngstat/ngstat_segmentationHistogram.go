@@ -0,0 +1,111 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+/* -------------------------------------------------------------------------- */
+
+import   "bufio"
+import   "fmt"
+import   "io"
+import   "log"
+import   "os"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/track"
+
+import . "github.com/pbenner/gonetics"
+
+import   "github.com/pborman/getopt"
+
+/* -------------------------------------------------------------------------- */
+
+// Compute histograms of track values for each state of a segmentation. If
+// no genome file is given, the genome is taken from the first track. If
+// nstates is zero, states are determined from the segmentation. If no bin
+// size is set, the bin size of the first track is used.
+func ngstat_segmentation_histogram(config SessionConfig, writer io.Writer, filenameSegmentation string, filenamesIn []string, filenameGenome string, nstates int) error {
+  genome := Genome{}
+  if filenameGenome != "" {
+    if err := genome.Import(filenameGenome); err != nil {
+      return err
+    }
+  }
+  if filenameGenome == "" || config.BinSize == 0 {
+    track, err := ImportLazyTrack(config, filenamesIn[0]); if err != nil {
+      return err
+    }
+    if filenameGenome == "" {
+      genome = track.GetGenome()
+    }
+    // use bin size of the first track
+    if config.BinSize == 0 {
+      config.BinSize = track.GetBinSize()
+    }
+    track.Close()
+  }
+  var stateMap map[string]int
+  if nstates == 0 {
+    _, stateNames, err := ImportTrackSegmentationWithStates(config, filenameSegmentation, genome, nil); if err != nil {
+      return err
+    }
+    stateMap = make(map[string]int)
+    for i, name := range stateNames {
+      stateMap[name] = i
+    }
+    nstates = len(stateNames)
+  }
+  w := bufio.NewWriter(writer)
+  if err := WriteSegmentationHistogram(config, w, filenameSegmentation, filenamesIn, nstates, genome, stateMap); err != nil {
+    return err
+  }
+  return w.Flush()
+}
+
+/* -------------------------------------------------------------------------- */
+
+func ngstat_segmentation_histogram_main(config SessionConfig, args []string) {
+
+  options := getopt.New()
+  options.SetProgram(fmt.Sprintf("%s segmentation-histogram", os.Args[0]))
+
+  optGenome := options.StringLong("genome", 0, "", "genome file [default: genome of the first track]")
+  optStates := options.   IntLong("states", 0,  0, "number of states [default: determined from segmentation]")
+  optHelp   := options.  BoolLong("help",  'h',    "print help")
+
+  options.SetParameters("<SEGMENTATION.bed> <INPUT.bw>...\n")
+  options.Parse(args)
+
+  // command options
+  if *optHelp {
+    options.PrintUsage(os.Stdout)
+    os.Exit(0)
+  }
+  // command arguments
+  if len(options.Args()) < 2 {
+    options.PrintUsage(os.Stderr)
+    os.Exit(1)
+  }
+  if *optStates < 0 {
+    log.Fatalf("invalid number of states `%d'", *optStates)
+  }
+  filenameSegmentation := options.Args()[0]
+  filenamesIn          := options.Args()[1:]
+
+  if err := ngstat_segmentation_histogram(config, os.Stdout, filenameSegmentation, filenamesIn, *optGenome, *optStates); err != nil {
+    log.Fatal(err)
+  }
+}
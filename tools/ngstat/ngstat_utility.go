@@ -0,0 +1,150 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+/* -------------------------------------------------------------------------- */
+
+import   "fmt"
+import   "math/rand"
+import   "path/filepath"
+import   "strconv"
+import   "strings"
+
+import . "github.com/pbenner/autodiff/statistics"
+import   "github.com/pbenner/autodiff/statistics/scalarEstimator"
+
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+func parseInts(str string) ([]int, error) {
+  r := []int{}
+  if str == "" {
+    return r, nil
+  }
+  for _, s := range strings.Split(str, ",") {
+    if i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err != nil {
+      return nil, err
+    } else {
+      r = append(r, int(i))
+    }
+  }
+  return r, nil
+}
+
+func parseFloats(str string) ([]float64, error) {
+  r := []float64{}
+  if str == "" {
+    return r, nil
+  }
+  for _, s := range strings.Split(str, ",") {
+    if v, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err != nil {
+      return nil, err
+    } else {
+      r = append(r, v)
+    }
+  }
+  return r, nil
+}
+
+func parseStrings(str string) []string {
+  if str == "" {
+    return nil
+  }
+  return strings.Split(str, ",")
+}
+
+// Parse a comma separated list of KEY=VALUE pairs, where values may be
+// empty.
+func parseAssignments(str string) (map[string]string, error) {
+  r := make(map[string]string)
+  for _, s := range parseStrings(str) {
+    fields := strings.SplitN(strings.TrimSpace(s), "=", 2)
+    if len(fields) != 2 || fields[0] == "" {
+      return nil, fmt.Errorf("invalid assignment `%s'", s)
+    }
+    r[fields[0]] = fields[1]
+  }
+  return r, nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Export peaks either as bed6 file or as table, depending on the file
+// extension.
+func exportPeaks(peaks GRanges, filename string) error {
+  ext := filepath.Ext(strings.TrimSuffix(filename, ".gz"))
+  compress := strings.HasSuffix(filename, ".gz")
+  switch ext {
+  case ".bed":
+    return peaks.ExportBed6(filename, compress)
+  case ".table", ".txt", ".tsv":
+    return peaks.ExportTable(filename, true, true, compress)
+  default:
+    return fmt.Errorf("invalid output format `%s' (expected .bed or .table)", ext)
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Parse a comma separated list of mixture components, where each component
+// is given as NAME[:PARAMETERS]. Parameters are separated by colons, missing
+// parameters are initialized randomly, i.e.
+//   delta:0,poisson,geometric:0.1,negative-binomial:1:0.5,normal:0:1
+func parseMixtureComponents(str string) ([]ScalarEstimator, error) {
+  components := []ScalarEstimator{}
+  for _, spec := range parseStrings(str) {
+    fields := strings.Split(strings.TrimSpace(spec), ":")
+    name   := fields[0]
+    values, err := parseFloats(strings.Join(fields[1:], ",")); if err != nil {
+      return nil, fmt.Errorf("invalid parameters for component `%s': %v", spec, err)
+    }
+    // return i-th parameter or a default value
+    parameter := func(i int, d float64) float64 {
+      if i < len(values) {
+        return values[i]
+      }
+      return d
+    }
+    var estimator ScalarEstimator
+    switch name {
+    case "delta":
+      if len(values) != 1 {
+        return nil, fmt.Errorf("delta component requires a location parameter")
+      }
+      estimator, err = scalarEstimator.NewDeltaEstimator(values[0])
+    case "poisson":
+      estimator, err = scalarEstimator.NewPoissonEstimator(parameter(0, rand.Float64()))
+    case "geometric":
+      estimator, err = scalarEstimator.NewGeometricEstimator(parameter(0, rand.Float64()))
+    case "negative-binomial":
+      estimator, err = scalarEstimator.NewNegativeBinomialEstimator(parameter(0, 1.0), parameter(1, rand.Float64()))
+    case "normal":
+      estimator, err = scalarEstimator.NewNormalEstimator(parameter(0, rand.Float64()), parameter(1, 1.0), parameter(2, 1e-8))
+    default:
+      return nil, fmt.Errorf("invalid mixture component `%s'", name)
+    }
+    if err != nil {
+      return nil, err
+    }
+    components = append(components, estimator)
+  }
+  if len(components) == 0 {
+    return nil, fmt.Errorf("empty set of mixture components")
+  }
+  return components, nil
+}
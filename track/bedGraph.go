@@ -0,0 +1,175 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package track
+
+/* -------------------------------------------------------------------------- */
+
+import   "bufio"
+import   "compress/gzip"
+import   "fmt"
+import   "io"
+import   "math"
+import   "os"
+import   "strings"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/autodiff"
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+// Export each track to a separate bigWig file.
+func ExportTracks(config SessionConfig, tracks []Track, trackFilenames []string) error {
+  if len(tracks) != len(trackFilenames) {
+    return NewDimensionError(len(tracks), len(trackFilenames), "number of file names does not match number of tracks")
+  }
+  for i, track := range tracks {
+    if err := ExportTrack(config, track, trackFilenames[i]); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+func bedGraphRowEqual(a, b []float64) bool {
+  for j := range a {
+    if a[j] != b[j] && !(math.IsNaN(a[j]) && math.IsNaN(b[j])) {
+      return false
+    }
+  }
+  return true
+}
+
+func bedGraphRowMissing(a []float64) bool {
+  for j := range a {
+    if !math.IsNaN(a[j]) {
+      return false
+    }
+  }
+  return true
+}
+
+// Write tracks as bedGraph with one value column per track. Consecutive
+// bins with identical values are merged and bins where all values are
+// missing are skipped. If names are given, a header line with column
+// names is written.
+func WriteMultiColumnBedGraph(w io.Writer, tracks []Track, names []string) error {
+  if len(tracks) == 0 {
+    return nil
+  }
+  if names != nil && len(names) != len(tracks) {
+    return NewDimensionError(len(tracks), len(names), "number of column names does not match number of tracks")
+  }
+  if names != nil {
+    if _, err := fmt.Fprintf(w, "#chrom\tstart\tend\t%s\n", strings.Join(names, "\t")); err != nil {
+      return err
+    }
+  }
+  it, err := NewMultiTrackWindowIterator(Float64Type, tracks, DefaultWindowParameters(1)); if err != nil {
+    return err
+  }
+  binSize := tracks[0].GetBinSize()
+  genome  := tracks[0].GetGenome()
+
+  writeRow := func(seqname string, from, to int, values []float64) error {
+    if bedGraphRowMissing(values) {
+      return nil
+    }
+    if length, err := genome.SeqLength(seqname); err == nil && to > length {
+      to = length
+    }
+    if _, err := fmt.Fprintf(w, "%s\t%d\t%d", seqname, from, to); err != nil {
+      return err
+    }
+    for _, v := range values {
+      if _, err := fmt.Fprintf(w, "\t%v", v); err != nil {
+        return err
+      }
+    }
+    _, err := fmt.Fprintf(w, "\n")
+    return err
+  }
+  row  := make([]float64, len(tracks))
+  last := make([]float64, len(tracks))
+  for it.NextSequence() {
+    name      := it.Sequence().Seqname
+    sequences := it.Sequence().Sequences
+    nbins     := it.Sequence().NBins()
+    from      := 0
+    for i := 0; i < nbins; i++ {
+      for j, seq := range sequences {
+        row[j] = seq.AtBin(i)
+      }
+      if i > 0 && !bedGraphRowEqual(row, last) {
+        if err := writeRow(name, from*binSize, i*binSize, last); err != nil {
+          return err
+        }
+        from = i
+      }
+      copy(last, row)
+    }
+    if nbins > 0 {
+      if err := writeRow(name, from*binSize, nbins*binSize, last); err != nil {
+        return err
+      }
+    }
+  }
+  return it.Err()
+}
+
+// Export tracks as multi-column bedGraph, the file is compressed if the
+// file name ends with `.gz'.
+func ExportMultiColumnBedGraph(config SessionConfig, tracks []Track, names []string, filename string) error {
+  task := BeginTask(config, fmt.Sprintf("Writing bedGraph `%s'", filename), "output", filename)
+  f, err := os.Create(filename)
+  if err != nil {
+    task.Failed(err)
+    return err
+  }
+  defer f.Close()
+
+  var g *gzip.Writer
+  var w *bufio.Writer
+  if strings.HasSuffix(filename, ".gz") {
+    g = gzip.NewWriter(f)
+    w = bufio.NewWriter(g)
+  } else {
+    w = bufio.NewWriter(f)
+  }
+  if err := WriteMultiColumnBedGraph(w, tracks, names); err != nil {
+    task.Failed(err)
+    return err
+  }
+  if err := w.Flush(); err != nil {
+    task.Failed(err)
+    return err
+  }
+  if g != nil {
+    if err := g.Close(); err != nil {
+      task.Failed(err)
+      return err
+    }
+  }
+  task.Done()
+  return nil
+}
@@ -0,0 +1,67 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package track
+
+/* -------------------------------------------------------------------------- */
+
+import . "github.com/pbenner/ngstat/utility"
+
+/* -------------------------------------------------------------------------- */
+
+// Part of a sequence that is processed independently of the rest of the
+// sequence. The chunk is processed on the bins [From, To), which extend the
+// core [CoreFrom, CoreTo) by an overlap on both sides. Only results within
+// the core are kept, so that neighboring chunks switch at the center of
+// their overlap zone.
+type SequenceChunk struct {
+  From     int
+  To       int
+  CoreFrom int
+  CoreTo   int
+}
+
+// Length of the chunk including the overlap.
+func (chunk SequenceChunk) Len() int {
+  return chunk.To - chunk.From
+}
+
+// Split a sequence of n bins into chunks with cores of the given size, each
+// extended by overlap bins on both sides (bounded by the sequence). The
+// whole sequence is a single chunk if size is not positive or larger than
+// the sequence.
+func SplitSequence(n, size, overlap int) []SequenceChunk {
+  if size <= 0 || size >= n {
+    return []SequenceChunk{SequenceChunk{0, n, 0, n}}
+  }
+  if overlap < 0 {
+    overlap = 0
+  }
+  r := make([]SequenceChunk, 0, (n+size-1)/size)
+  for from := 0; from < n; from += size {
+    to := from+size
+    if to > n {
+      to = n
+    }
+    r = append(r, SequenceChunk{
+      From    : MaxInt(0, from-overlap),
+      To      : MinInt(n, to+overlap),
+      CoreFrom: from,
+      CoreTo  : to })
+  }
+  return r
+}
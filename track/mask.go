@@ -29,17 +29,18 @@ import . "github.com/pbenner/gonetics"
 /* -------------------------------------------------------------------------- */
 
 func MaskRegionsOnTrack(config SessionConfig, track Track, r GRanges) error {
-  PrintStderr(config, 1, "Masking regions... ")
+  task := BeginTask(config, "Masking regions", "regions", r.Length())
   for i := 0; i < r.Length(); i++ {
     if seq, err := track.GetSlice(r.Row(i)); err == nil {
       for j := 0; j < len(seq); j++ {
         seq[j] = math.NaN()
       }
     } else {
-      PrintStderr(config, 1, "failed\n")
-      return fmt.Errorf("error while trying to exclude region: %v", err)
+      err = fmt.Errorf("error while trying to exclude region: %v", err)
+      task.Failed(err)
+      return err
     }
   }
-  PrintStderr(config, 1, "done\n")
+  task.Done()
   return nil
 }
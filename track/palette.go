@@ -0,0 +1,348 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package track
+
+/* -------------------------------------------------------------------------- */
+
+import   "fmt"
+import   "bufio"
+import   "io"
+import   "math"
+import   "os"
+import   "path/filepath"
+import   "strconv"
+import   "strings"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/utility"
+
+/* -------------------------------------------------------------------------- */
+
+// A palette is a list of colors in bed itemRgb notation (i.e. `r,g,b').
+type Palette struct {
+  Name     string
+  Colors []string
+}
+
+/* -------------------------------------------------------------------------- */
+
+var palettes = map[string][]string{
+  // Paul Tol's bright and muted qualitative schemes
+  "bright": []string{
+    "68,119,170", "238,102,119", "34,136,51", "204,187,68", "102,204,238", "170,51,119", "187,187,187" },
+  "muted": []string{
+    "51,34,136", "136,204,238", "68,170,153", "17,119,51", "153,153,51", "221,204,119", "204,102,119", "136,34,85", "170,68,153", "221,221,221" },
+  // ColorBrewer Set1 and Dark2
+  "set1": []string{
+    "228,26,28", "55,126,184", "77,175,74", "152,78,163", "255,127,0", "255,255,51", "166,86,40", "247,129,191", "153,153,153" },
+  "dark2": []string{
+    "27,158,119", "217,95,2", "117,112,179", "231,41,138", "102,166,30", "230,171,2", "166,118,29", "102,102,102" },
+  // Tableau 20
+  "tableau20": []string{
+    "31,119,180", "174,199,232", "255,127,14", "255,187,120", "44,160,44", "152,223,138", "214,39,40", "255,152,150", "148,103,189", "197,176,213",
+    "140,86,75", "196,156,148", "227,119,194", "247,182,210", "127,127,127", "199,199,199", "188,189,34", "219,219,141", "23,190,207", "158,218,229" },
+  // Kelly's colors of maximum contrast (without black and white)
+  "kelly": []string{
+    "255,179,0", "128,62,117", "255,104,0", "166,189,215", "193,0,32", "206,162,98", "129,112,102", "0,125,52", "246,118,142", "0,83,138",
+    "255,122,92", "83,55,122", "255,142,0", "179,40,81", "244,200,0", "127,24,13", "147,170,0", "89,51,21", "241,58,19", "35,44,22" },
+}
+
+// Names of all built-in palettes.
+func PaletteNames() []string {
+  return []string{"qualitative", "bright", "muted", "set1", "dark2", "tableau20", "kelly", "rainbow", "rgb-cube"}
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Get a built-in palette with at least n colors. The special palettes
+// `qualitative' (default), `rainbow' and `rgb-cube' are generated on
+// demand, all others are extended with generated colors if n exceeds
+// the number of predefined colors.
+func NewPalette(name string, n int) (Palette, error) {
+  if n < 1 {
+    return Palette{}, NewArgumentError("invalid number of colors `%d'", n)
+  }
+  switch name {
+  case "", "qualitative":
+    // pick the smallest predefined palette that is large enough
+    for _, p := range []string{"bright", "muted", "tableau20"} {
+      if len(palettes[p]) >= n {
+        return Palette{"qualitative", append([]string{}, palettes[p][0:n]...)}, nil
+      }
+    }
+    return Palette{"qualitative", getGoldenAngleColors(n)}, nil
+  case "rainbow":
+    return Palette{name, getGoldenAngleColors(n)}, nil
+  case "rgb-cube":
+    return Palette{name, getNColors(n)}, nil
+  }
+  if colors, ok := palettes[name]; !ok {
+    return Palette{}, fmt.Errorf("invalid palette `%s'", name)
+  } else {
+    p := Palette{name, append([]string{}, colors...)}
+    if n > len(colors) {
+      p.Colors = append(p.Colors, getGoldenAngleColors(n)[len(colors):]...)
+    }
+    return p, nil
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Number of colors in the palette.
+func (p Palette) Len() int {
+  return len(p.Colors)
+}
+
+// Get color i. Colors are recycled if i exceeds the size of the palette.
+// An empty palette returns black for all colors.
+func (p Palette) At(i int) string {
+  if len(p.Colors) == 0 {
+    return "0,0,0"
+  }
+  if i %= len(p.Colors); i < 0 {
+    i += len(p.Colors)
+  }
+  return p.Colors[i]
+}
+
+// Compute n shades of color i that are suitable for coloring the children
+// of a state that has color i. Shades range from a darker to a lighter
+// version of the parent color.
+func (p Palette) Shades(i, n int) []string {
+  r := make([]string, n)
+  if n == 1 {
+    r[0] = p.At(i)
+    return r
+  }
+  c, _ := parseRgb(p.At(i))
+  for k := 0; k < n; k++ {
+    // interpolate between -0.5 (darker) and +0.5 (lighter)
+    t := -0.5 + float64(k)/float64(n-1)
+    var s [3]int
+    for j := 0; j < 3; j++ {
+      if t < 0 {
+        s[j] = int(math.Round(float64(c[j])*(1.0+t)))
+      } else {
+        s[j] = int(math.Round(float64(c[j]) + float64(255-c[j])*t))
+      }
+    }
+    r[k] = fmt.Sprintf("%d,%d,%d", s[0], s[1], s[2])
+  }
+  return r
+}
+
+// Assign a color to each distinct name in the order of first appearance.
+func (p Palette) RgbMap(names []string) map[string]string {
+  rgbMap := make(map[string]string)
+  for _, name := range names {
+    if _, ok := rgbMap[name]; !ok {
+      rgbMap[name] = p.At(len(rgbMap))
+    }
+  }
+  return rgbMap
+}
+
+/* -------------------------------------------------------------------------- */
+
+func (p *Palette) Import(reader io.Reader, args... interface{}) error {
+  if err := JsonImportStrict(reader, p); err != nil {
+    return err
+  }
+  if len(p.Colors) == 0 {
+    return fmt.Errorf("palette has no colors")
+  }
+  for i, color := range p.Colors {
+    if c, err := parseRgb(color); err != nil {
+      return fmt.Errorf("invalid color `%s' at position `%d': %v", color, i, err)
+    } else {
+      p.Colors[i] = fmt.Sprintf("%d,%d,%d", c[0], c[1], c[2])
+    }
+  }
+  return nil
+}
+
+func (p *Palette) Export(writer io.Writer) error {
+  return JsonExport(writer, p)
+}
+
+// Import a custom palette from a json file, i.e.
+//   { "Name": "custom", "Colors": [ "31,119,180", "#ff7f0e" ] }
+func ImportPalette(filename string) (Palette, error) {
+  p := Palette{}
+  if err := ImportFile(&p, filename); err != nil {
+    return p, err
+  }
+  return p, nil
+}
+
+// Get a palette either by name or from a json file if name is an
+// existing file.
+func GetPalette(name string, n int) (Palette, error) {
+  if _, err := os.Stat(name); name != "" && err == nil {
+    return ImportPalette(name)
+  }
+  return NewPalette(name, n)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Export a legend that maps state names to colors. The format is determined
+// by the file extension (`.svg' or tab separated values otherwise).
+func ExportSegmentationLegend(config SessionConfig, filename string, stateNames []string, rgbMap map[string]string) error {
+  f, err := os.Create(filename)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  w := bufio.NewWriter(f)
+  if strings.ToLower(filepath.Ext(filename)) == ".svg" {
+    err = writeSegmentationLegendSvg(w, stateNames, rgbMap)
+  } else {
+    err = writeSegmentationLegendTsv(w, stateNames, rgbMap)
+  }
+  if err != nil {
+    return err
+  }
+  return w.Flush()
+}
+
+func writeSegmentationLegendTsv(w io.Writer, stateNames []string, rgbMap map[string]string) error {
+  if _, err := fmt.Fprintf(w, "name\titemRgb\thex\n"); err != nil {
+    return err
+  }
+  for _, name := range uniqueStateNames(stateNames) {
+    c, err := parseRgb(rgbMap[name]); if err != nil {
+      return fmt.Errorf("invalid color for state `%s': %v", name, err)
+    }
+    if _, err := fmt.Fprintf(w, "%s\t%s\t#%02x%02x%02x\n", name, rgbMap[name], c[0], c[1], c[2]); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func writeSegmentationLegendSvg(w io.Writer, stateNames []string, rgbMap map[string]string) error {
+  names := uniqueStateNames(stateNames)
+  // width of the longest name
+  n := 0
+  for _, name := range names {
+    if len(name) > n {
+      n = len(name)
+    }
+  }
+  if _, err := fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\">\n", 40+8*n, 20*len(names)+10); err != nil {
+    return err
+  }
+  for i, name := range names {
+    c, err := parseRgb(rgbMap[name]); if err != nil {
+      return fmt.Errorf("invalid color for state `%s': %v", name, err)
+    }
+    if _, err := fmt.Fprintf(w, "  <rect x=\"5\" y=\"%d\" width=\"15\" height=\"15\" fill=\"rgb(%d,%d,%d)\"/>\n", 5+20*i, c[0], c[1], c[2]); err != nil {
+      return err
+    }
+    if _, err := fmt.Fprintf(w, "  <text x=\"25\" y=\"%d\" font-family=\"sans-serif\" font-size=\"12\">%s</text>\n", 17+20*i, escapeXml(name)); err != nil {
+      return err
+    }
+  }
+  if _, err := fmt.Fprintf(w, "</svg>\n"); err != nil {
+    return err
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Generate colors by rotating the hue with the golden angle, which gives
+// well separated neighboring colors for any n. Saturation and value
+// alternate to further increase the contrast.
+func getGoldenAngleColors(n int) []string {
+  s := make([]string, n)
+  h := 0.0
+  for i := 0; i < n; i++ {
+    sat := []float64{0.75, 0.55, 0.90}[i % 3]
+    val := []float64{0.85, 0.65, 0.95}[(i/3) % 3]
+    r, g, b := hsvToRgb(h, sat, val)
+    s[i] = fmt.Sprintf("%d,%d,%d", r, g, b)
+    h = math.Mod(h + 137.507764, 360.0)
+  }
+  return s
+}
+
+func hsvToRgb(h, s, v float64) (int, int, int) {
+  c := v*s
+  x := c*(1.0 - math.Abs(math.Mod(h/60.0, 2.0) - 1.0))
+  m := v - c
+  var r, g, b float64
+  switch {
+  case h <  60: r, g, b = c, x, 0
+  case h < 120: r, g, b = x, c, 0
+  case h < 180: r, g, b = 0, c, x
+  case h < 240: r, g, b = 0, x, c
+  case h < 300: r, g, b = x, 0, c
+  default     : r, g, b = c, 0, x
+  }
+  return int(math.Round((r+m)*255)), int(math.Round((g+m)*255)), int(math.Round((b+m)*255))
+}
+
+// Parse colors given either as `r,g,b' or `#rrggbb'.
+func parseRgb(color string) ([3]int, error) {
+  var c [3]int
+  color = strings.TrimSpace(color)
+  if strings.HasPrefix(color, "#") {
+    if len(color) != 7 {
+      return c, fmt.Errorf("expected format `#rrggbb'")
+    }
+    for j := 0; j < 3; j++ {
+      if v, err := strconv.ParseUint(color[1+2*j:3+2*j], 16, 8); err != nil {
+        return c, err
+      } else {
+        c[j] = int(v)
+      }
+    }
+    return c, nil
+  }
+  fields := strings.Split(color, ",")
+  if len(fields) != 3 {
+    return c, fmt.Errorf("expected format `r,g,b'")
+  }
+  for j := 0; j < 3; j++ {
+    if v, err := strconv.ParseUint(strings.TrimSpace(fields[j]), 10, 8); err != nil {
+      return c, err
+    } else {
+      c[j] = int(v)
+    }
+  }
+  return c, nil
+}
+
+func uniqueStateNames(stateNames []string) []string {
+  m := make(map[string]struct{})
+  r := []string{}
+  for _, name := range stateNames {
+    if _, ok := m[name]; !ok {
+      m[name] = struct{}{}
+      r = append(r, name)
+    }
+  }
+  return r
+}
+
+func escapeXml(str string) string {
+  return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;").Replace(str)
+}
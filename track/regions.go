@@ -0,0 +1,113 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package track
+
+/* -------------------------------------------------------------------------- */
+
+import   "bufio"
+import   "compress/gzip"
+import   "fmt"
+import   "io"
+import   "os"
+import   "strconv"
+import   "strings"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+// Read regions from a bed file with at least four columns, where the fourth
+// column (name) is the class of a region. The class is stored as meta
+// column `name'.
+func ReadRegionClasses(reader io.Reader) (GRanges, error) {
+  seqnames := []string{}
+  from     := []int{}
+  to       := []int{}
+  names    := []string{}
+
+  scanner := bufio.NewScanner(reader)
+  for line := 1; scanner.Scan(); line++ {
+    fields := strings.Fields(scanner.Text())
+    // skip empty lines, comments and track lines
+    if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || fields[0] == "track" || fields[0] == "browser" {
+      continue
+    }
+    if len(fields) < 4 {
+      return GRanges{}, FormatError{Line: line, Err: fmt.Errorf("expected at least four columns (chrom, start, end, class)")}
+    }
+    t1, err := strconv.Atoi(fields[1]); if err != nil {
+      return GRanges{}, FormatError{Line: line, Column: 2, Err: err}
+    }
+    t2, err := strconv.Atoi(fields[2]); if err != nil {
+      return GRanges{}, FormatError{Line: line, Column: 3, Err: err}
+    }
+    if t1 < 0 || t2 < t1 {
+      return GRanges{}, FormatError{Line: line, Err: fmt.Errorf("invalid region `%d-%d'", t1, t2)}
+    }
+    seqnames = append(seqnames, fields[0])
+    from     = append(from,     t1)
+    to       = append(to,       t2)
+    names    = append(names,    fields[3])
+  }
+  if err := scanner.Err(); err != nil {
+    return GRanges{}, err
+  }
+  r := NewGRanges(seqnames, from, to, nil)
+  r.AddMeta("name", names)
+  return r, nil
+}
+
+// Import regions with classes from a bed file, which may be gzipped (see
+// ReadRegionClasses).
+func ImportRegionClasses(config SessionConfig, filename string) (GRanges, error) {
+  task := BeginTask(config, fmt.Sprintf("Reading regions `%s'", filename), "input", filename)
+  r, err := importRegionClasses(filename); if err != nil {
+    task.Failed(err)
+    return r, err
+  }
+  task.Done()
+  return r, nil
+}
+
+func importRegionClasses(filename string) (GRanges, error) {
+  f, err := os.Open(filename); if err != nil {
+    return GRanges{}, err
+  }
+  defer f.Close()
+
+  var reader io.Reader = f
+  if strings.HasSuffix(filename, ".gz") {
+    g, err := gzip.NewReader(f); if err != nil {
+      return GRanges{}, FormatError{Filename: filename, Err: err}
+    }
+    defer g.Close()
+    reader = g
+  }
+  r, err := ReadRegionClasses(reader); if err != nil {
+    if e, ok := err.(FormatError); ok {
+      e.Filename = filename
+      return r, e
+    }
+    return r, err
+  }
+  return r, nil
+}
@@ -26,9 +26,12 @@ import   "compress/gzip"
 import   "io"
 import   "io/ioutil"
 import   "os"
+import   "sort"
 import   "strconv"
+import   "strings"
 
 import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/io"
 import . "github.com/pbenner/ngstat/utility"
 
 import . "github.com/pbenner/gonetics"
@@ -53,87 +56,336 @@ func getNColors(n int) []string {
 
 /* -------------------------------------------------------------------------- */
 
-func ExportTrackSegmentation(config SessionConfig, track Track, bedFilename, bedName, bedDescription string, compress bool, stateNames []string, rgbMap map[string]string, scores []Track) error {
-  return (GenericTrack{track}).ExportSegmentation(bedFilename, bedName, bedDescription, compress, stateNames, rgbMap, scores)
+// Return the given palette or, if palette is nil, the default palette
+// with n colors.
+func getSegmentationPalette(n int, palette *Palette) (Palette, error) {
+  if palette == nil {
+    return NewPalette("qualitative", n)
+  }
+  if palette.Len() == 0 {
+    return *palette, fmt.Errorf("palette `%s' has no colors", palette.Name)
+  }
+  return *palette, nil
+}
+
+// Convert a segmentation track to genomic ranges with a `state' meta
+// column, where consecutive bins with the same state are merged. Bins
+// with NaN values are gaps and are not included.
+func segmentationGRanges(track Track) (GRanges, error) {
+  binSize  := track.GetBinSize()
+  seqnames := []string{}
+  from     := []int{}
+  to       := []int{}
+  state    := []float64{}
+  for _, name := range track.GetSeqNames() {
+    seq, err := track.GetSequence(name); if err != nil {
+      return GRanges{}, SequenceError{Seqname: name, Err: err}
+    }
+    for i := 0; i < seq.NBins(); i++ {
+      v := seq.AtBin(i)
+      if math.IsNaN(v) {
+        continue
+      }
+      if n := len(state); n > 0 && seqnames[n-1] == name && to[n-1] == i*binSize && state[n-1] == v {
+        to[n-1] += binSize
+      } else {
+        seqnames = append(seqnames, name)
+        from     = append(from,     i*binSize)
+        to       = append(to,       (i+1)*binSize)
+        state    = append(state,    v)
+      }
+    }
+  }
+  r := NewGRanges(seqnames, from, to, nil)
+  r.AddMeta("state", state)
+  return r, nil
+}
+
+// Export a segmentation as bed file. If no rgbMap is given, colors are taken
+// from the palette, or from the qualitative palette if palette is nil. Bins
+// with NaN values are not assigned to any state and are exported as gaps.
+func ExportTrackSegmentation(config SessionConfig, track Track, bedFilename, bedName, bedDescription string, compress bool, stateNames []string, rgbMap map[string]string, scores []Track, palette *Palette) error {
+  r, err := segmentationGRanges(track); if err != nil {
+    return err
+  }
+  state := r.GetMetaFloat("state")
+  if len(stateNames) == 0 {
+    // determine number of states
+    sMax := 0
+    for i := 0; i < len(state); i++ {
+      if s := int(state[i]); s > sMax {
+        sMax = s
+      }
+    }
+    // generate state names
+    stateNames = make([]string, sMax+1)
+    for i := 0; i < len(stateNames); i++ {
+      stateNames[i] = fmt.Sprintf("s%d", i)
+    }
+  }
+  if len(rgbMap) == 0 {
+    if p, err := getSegmentationPalette(len(uniqueStateNames(stateNames)), palette); err != nil {
+      return err
+    } else {
+      rgbMap = p.RgbMap(stateNames)
+    }
+  }
+  name       := make([]string, len(state))
+  score      := make([]int,    len(state))
+  thickStart := make([]int,    len(state))
+  thickEnd   := make([]int,    len(state))
+  itemRgb    := make([]string, len(state))
+
+  for i := 0; i < r.Length(); i++ {
+    s := int(state[i])
+    if s < 0 || math.Floor(state[i]) != state[i] {
+      return NewStateError(state[i], "invalid state `%f' at `%s:%d-%d'", state[i], r.Seqnames[i], r.Ranges[i].From, r.Ranges[i].To)
+    }
+    if s >= len(stateNames) {
+      return NewStateError(s, "insufficient number of state names")
+    }
+    color, ok := rgbMap[stateNames[s]]; if !ok {
+      return NewStateError(stateNames[s], "rgbMap is missing a color for state `%s'", stateNames[s])
+    }
+    name      [i] = stateNames[s]
+    thickStart[i] = r.Ranges[i].From
+    thickEnd  [i] = r.Ranges[i].To
+    itemRgb   [i] = color
+    if len(scores) > 0 {
+      if slice, err := scores[s].GetSlice(r.Row(i)); err != nil {
+        return err
+      } else {
+        for _, value := range slice {
+          if v := int(value*100); score[i] < v {
+            score[i] = v
+          }
+        }
+      }
+    }
+  }
+  r.AddMeta("name",       name)
+  r.AddMeta("score",      score)
+  r.AddMeta("thickStart", thickStart)
+  r.AddMeta("thickEnd",   thickEnd)
+  r.AddMeta("itemRgb",    itemRgb)
+  // write result to file
+  task := BeginTask(config, fmt.Sprintf("Writing segmentation `%s'", bedFilename), "output", bedFilename)
+  if err := exportTrackSegmentation(r, bedFilename, bedName, bedDescription, compress); err != nil {
+    task.Failed(err)
+    return err
+  }
+  task.Done()
+  return nil
+}
+
+// Export the legend of a segmentation, using the same colors as
+// ExportTrackSegmentation.
+func ExportTrackSegmentationLegend(config SessionConfig, filename string, stateNames []string, rgbMap map[string]string, palette *Palette) error {
+  if len(rgbMap) == 0 {
+    if p, err := getSegmentationPalette(len(uniqueStateNames(stateNames)), palette); err != nil {
+      return err
+    } else {
+      rgbMap = p.RgbMap(stateNames)
+    }
+  }
+  return ExportSegmentationLegend(config, filename, stateNames, rgbMap)
+}
+
+/* -------------------------------------------------------------------------- */
+
+type segmentationRecord struct {
+  Seqname  string
+  From     int
+  To       int
+  Name     string
+  Line     int
+}
+
+type segmentationRecords []segmentationRecord
+
+func (obj segmentationRecords) Len() int {
+  return len(obj)
+}
+
+func (obj segmentationRecords) Less(i, j int) bool {
+  if obj[i].Seqname != obj[j].Seqname {
+    return obj[i].Seqname < obj[j].Seqname
+  }
+  return obj[i].From < obj[j].From
+}
+
+func (obj segmentationRecords) Swap(i, j int) {
+  obj[i], obj[j] = obj[j], obj[i]
 }
 
 /* -------------------------------------------------------------------------- */
 
-func importTrackSegmentation(filename string) (GRanges, error) {
+func readTrackSegmentation(reader io.Reader, filename string) (segmentationRecords, error) {
+  records := segmentationRecords{}
+  scanner := bufio.NewScanner(reader)
+  scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+  for line := 1; scanner.Scan(); line++ {
+    str := strings.TrimSpace(scanner.Text())
+    // skip empty lines, comments and any number of header lines
+    if str == "" || strings.HasPrefix(str, "#") || strings.HasPrefix(str, "track") || strings.HasPrefix(str, "browser") {
+      continue
+    }
+    fields := strings.Fields(str)
+    if len(fields) < 4 {
+      return nil, FormatError{Filename: filename, Line: line, Err: fmt.Errorf("invalid segmentation record: name column is missing")}
+    }
+    from, err := strconv.ParseInt(fields[1], 10, 64); if err != nil {
+      return nil, FormatError{Filename: filename, Line: line, Err: fmt.Errorf("invalid start position: %w", err)}
+    }
+    to, err := strconv.ParseInt(fields[2], 10, 64); if err != nil {
+      return nil, FormatError{Filename: filename, Line: line, Err: fmt.Errorf("invalid end position: %w", err)}
+    }
+    if from < 0 || to < from {
+      return nil, FormatError{Filename: filename, Line: line, Err: fmt.Errorf("invalid range [%d, %d)", from, to)}
+    }
+    records = append(records, segmentationRecord{fields[0], int(from), int(to), fields[3], line})
+  }
+  if err := scanner.Err(); err != nil {
+    return nil, fmt.Errorf("%s: %v", filename, err)
+  }
+  sort.Stable(records)
+  // check for overlapping records
+  for i := 1; i < len(records); i++ {
+    if records[i-1].Seqname == records[i].Seqname && records[i-1].To > records[i].From {
+      return nil, FormatError{Filename: filename, Err: fmt.Errorf("record at line %d overlaps with record at line %d", records[i].Line, records[i-1].Line)}
+    }
+  }
+  return records, nil
+}
+
+func importTrackSegmentation(filename string) (segmentationRecords, error) {
   var r io.Reader
-  var g GRanges
   // open file
   f, err := os.Open(filename)
   if err != nil {
-    return g, err
+    return nil, err
   }
   defer f.Close()
   // check if file is gzipped
   if IsGzip(filename) {
     gz, err := gzip.NewReader(f)
     if err != nil {
-      return g, err
+      return nil, err
     }
     defer gz.Close()
     r = gz
   } else {
     r = f
   }
-  // skip track line
-  reader := bufio.NewReader(r)
-  reader.ReadLine()
-  // parse remaining file
-  if err := g.ReadBed9(reader); err != nil {
-    return g, err
-  } else {
-    return g, nil
-  }
+  return readTrackSegmentation(r, filename)
 }
 
+// Import a segmentation from a bed file. States are determined by the
+// name column. If stateMap is nil, state names of the form `s<k>' are
+// mapped to state k. Bins not covered by any record are set to NaN.
 func ImportTrackSegmentation(config SessionConfig, bedFilename string, genome Genome, stateMap map[string]int) (Track, error) {
+  track, _, err := ImportTrackSegmentationWithStates(config, bedFilename, genome, stateMap)
+  return track, err
+}
+
+// Import a segmentation from a bed file. If stateMap is nil and all names are
+// of the form `s<k>', state k is assigned to name `s<k>'. Otherwise arbitrary
+// labels are allowed and a state map is built in the order of first
+// appearance. The second return value contains the name of each state.
+// Bins not covered by any record are set to NaN. Records must not overlap
+// and must be aligned to the bin size.
+func ImportTrackSegmentationWithStates(config SessionConfig, bedFilename string, genome Genome, stateMap map[string]int) (Track, []string, error) {
+  task := BeginTask(config, fmt.Sprintf("Reading segmentation `%s'", bedFilename), "input", bedFilename)
+  records, err := importTrackSegmentation(bedFilename); if err != nil {
+    task.Failed(err)
+    return nil, nil, err
+  }
+  task.Done()
+  binSize := config.BinSize
+  if binSize <= 0 {
+    return nil, nil, NewBinSizeError(0, binSize, "invalid bin size `%d'", binSize)
+  }
+  if stateMap == nil {
+    stateMap = newSegmentationStateMap(records)
+  }
+  stateNames := []string{}
+  for name, k := range stateMap {
+    if k < 0 {
+      return nil, nil, NewStateError(k, "invalid state `%d' for name `%s'", k, name)
+    }
+    for len(stateNames) <= k {
+      stateNames = append(stateNames, "")
+    }
+    stateNames[k] = name
+  }
+  track := AllocSimpleTrack("", genome, binSize)
+  // mark all bins as unassigned
+  if err := (GenericMutableTrack{MutableTrack: track}).Map(track, func(seqname string, i int, value float64) float64 {
+    return math.NaN()
+  }); err != nil {
+    return nil, nil, err
+  }
   var s TrackMutableSequence
-  if r, err := importTrackSegmentation(bedFilename); err != nil {
-    return nil, err
-  } else {
-    track  := AllocSimpleTrack("", genome, config.BinSize)
-    states := r.GetMetaStr("name")
-
-    if len(states) != r.Length() {
-      return nil, fmt.Errorf("invalid segmentation bed file: name column is missing")
-    }
-    for i := 0; i < r.Length(); i++ {
-      seqname := r.Seqnames[i]
-      from    := r.Ranges  [i].From
-      to      := r.Ranges  [i].To
-      if i == 0 || r.Seqnames[i-1] != r.Seqnames[i] {
-        if s_, err := track.GetMutableSequence(seqname); err != nil {
-          return nil, err
-        } else {
-          s = s_
-        }
-      }
-      if stateMap == nil {
-        for k := from; k < to; k += config.BinSize {
-          if len(states[i]) <= 1 {
-            return nil, fmt.Errorf("invalid state at line %d", i+2)
-          }
-          value, err := strconv.ParseInt(states[i][1:], 10, 64); if err != nil {
-            return nil, err
-          }
-          s.Set(k, float64(value))
-        }
+  for i, r := range records {
+    if i == 0 || records[i-1].Seqname != r.Seqname {
+      if s_, err := track.GetMutableSequence(r.Seqname); err != nil {
+        return nil, nil, FormatError{Filename: bedFilename, Line: r.Line, Err: SequenceError{Seqname: r.Seqname, Err: err}}
       } else {
-        for k := from; k < to; k += config.BinSize {
-          if value, ok := stateMap[states[i]]; !ok {
-            return nil, fmt.Errorf("state `%s' not found in state map", states[i])
-          } else {
-            s.Set(k, float64(value))
-          }
-        }
+        s = s_
       }
     }
-    return track, nil
+    seqlen, err := genome.SeqLength(r.Seqname); if err != nil {
+      return nil, nil, FormatError{Filename: bedFilename, Line: r.Line, Err: SequenceError{Seqname: r.Seqname, Err: err}}
+    }
+    if r.To > seqlen {
+      return nil, nil, FormatError{Filename: bedFilename, Line: r.Line, Err: fmt.Errorf("record exceeds length of sequence `%s'", r.Seqname)}
+    }
+    if r.From % binSize != 0 || (r.To % binSize != 0 && r.To != seqlen) {
+      return nil, nil, FormatError{Filename: bedFilename, Line: r.Line, Err: NewBinSizeError(binSize, 0, "record [%d, %d) is not aligned to bin size `%d'", r.From, r.To, binSize)}
+    }
+    value, ok := stateMap[r.Name]
+    if !ok {
+      return nil, nil, FormatError{Filename: bedFilename, Line: r.Line, Err: NewStateError(r.Name, "state `%s' not found in state map", r.Name)}
+    }
+    // the last incomplete bin of a sequence is dropped by convention
+    for k := r.From/binSize; k < DivIntUp(r.To, binSize) && k < s.NBins(); k++ {
+      s.SetBin(k, float64(value))
+    }
+  }
+  return track, stateNames, nil
+}
+
+// Build a state map from state names. Names of the form `s<k>' are mapped
+// to k, unless there are names that do not follow this scheme. Otherwise,
+// states are numbered in the order of their first appearance in the file.
+func newSegmentationStateMap(records segmentationRecords) map[string]int {
+  // records are sorted by position, restore file order
+  records = append(segmentationRecords{}, records...)
+  sort.SliceStable(records, func(i, j int) bool {
+    return records[i].Line < records[j].Line
+  })
+  stateMap := make(map[string]int)
+  numbered := true
+  for _, r := range records {
+    if len(r.Name) <= 1 || r.Name[0] != 's' {
+      numbered = false; break
+    }
+    if k, err := strconv.ParseInt(r.Name[1:], 10, 64); err != nil || k < 0 || fmt.Sprintf("s%d", k) != r.Name {
+      numbered = false; break
+    } else {
+      stateMap[r.Name] = int(k)
+    }
+  }
+  if numbered {
+    return stateMap
+  }
+  stateMap = make(map[string]int)
+  for _, r := range records {
+    if _, ok := stateMap[r.Name]; !ok {
+      stateMap[r.Name] = len(stateMap)
+    }
   }
+  return stateMap
 }
 
 /* -------------------------------------------------------------------------- */
@@ -160,22 +412,23 @@ func exportTrackSegmentation(granges GRanges, bedFilename, name, description str
   return ioutil.WriteFile(bedFilename, buffer.Bytes(), 0666)
 }
 
-func ExportHierarchicalTrackSegmentation(config SessionConfig, track Track, bedFilename, bedName, bedDescription string, compress bool, stateNames, rgbChart []string, tree generic.HmmNode, level int) error {
-  r, err := GenericTrack{track}.GRanges("state"); if err != nil {
-    return err
-  }
-  rgbMap := make(map[int]int)
-  rgbCnt := 0
+// Map states of the lowest level to states at the given level of the
+// tree. The second return value contains for each state at the given
+// level the index of its parent node.
+func hierarchicalStateMap(tree generic.HmmNode, level int) (map[int]int, []int, error) {
+  rgbMap  := make(map[int]int)
+  rgbCnt  := 0
+  parents := []int{}
+  parCnt  := 0
   var f func(node generic.HmmNode, d int) ([]int, error)
   f = func(node generic.HmmNode, d int) ([]int, error) {
     if d == level {
       if node.Children == nil {
-        for i := 0; i < len(node.Children); i++ {
-          for k := node.States[0]; k < node.States[1]; k++ {
-            rgbMap[k] = rgbCnt
-          }
-          rgbCnt++
+        for k := node.States[0]; k < node.States[1]; k++ {
+          rgbMap[k] = rgbCnt
         }
+        parents = append(parents, parCnt)
+        rgbCnt++
       } else {
         for i := 0; i < len(node.Children); i++ {
           if r, err := f(node.Children[i], d+1); err != nil {
@@ -185,9 +438,11 @@ func ExportHierarchicalTrackSegmentation(config SessionConfig, track Track, bedF
               rgbMap[k] = rgbCnt
             }
           }
+          parents = append(parents, parCnt)
           rgbCnt++
         }
       }
+      parCnt++
       return nil, nil
     } else {
       states := []int{}
@@ -208,10 +463,61 @@ func ExportHierarchicalTrackSegmentation(config SessionConfig, track Track, bedF
     }
   }
   if _, err := f(tree, 0); err != nil {
-    return err
+    return nil, nil, err
   }
   if len(rgbMap) == 0 {
-    return fmt.Errorf("invalid level")
+    return nil, nil, NewArgumentError("invalid level `%d'", level)
+  }
+  return rgbMap, parents, nil
+}
+
+// Get a color for each state at a given level. If there is more than one
+// parent node, children are colored with shades of the parent color.
+func hierarchicalRgbChart(parents []int, palette *Palette) ([]string, error) {
+  // count number of children for each parent
+  nChildren := []int{}
+  for _, p := range parents {
+    for len(nChildren) <= p {
+      nChildren = append(nChildren, 0)
+    }
+    nChildren[p]++
+  }
+  if len(nChildren) <= 1 {
+    if p, err := getSegmentationPalette(len(parents), palette); err != nil {
+      return nil, err
+    } else {
+      // colors are recycled if the palette is too small
+      rgbChart := make([]string, len(parents))
+      for i := range parents {
+        rgbChart[i] = p.At(i)
+      }
+      return rgbChart, nil
+    }
+  }
+  q, err := getSegmentationPalette(len(nChildren), palette); if err != nil {
+    return nil, err
+  }
+  shades   := make([][]string, len(nChildren))
+  rgbChart := make([]string, len(parents))
+  for i, p := range parents {
+    if shades[p] == nil {
+      shades[p] = q.Shades(p, nChildren[p])
+    }
+    rgbChart[i] = shades[p][0]
+    shades  [p] = shades[p][1:]
+  }
+  return rgbChart, nil
+}
+
+// Export a segmentation at a given level of a hierarchical HMM. If no rgbChart
+// is given, colors are taken from the palette, or from the qualitative
+// palette if palette is nil.
+func ExportHierarchicalTrackSegmentation(config SessionConfig, track Track, bedFilename, bedName, bedDescription string, compress bool, stateNames, rgbChart []string, tree generic.HmmNode, level int, palette *Palette) error {
+  r, err := segmentationGRanges(track); if err != nil {
+    return err
+  }
+  rgbMap, parents, err := hierarchicalStateMap(tree, level); if err != nil {
+    return err
   }
   if len(stateNames) == 0 {
     stateNames = make([]string, len(rgbMap))
@@ -220,7 +526,9 @@ func ExportHierarchicalTrackSegmentation(config SessionConfig, track Track, bedF
     }
   }
   if len(rgbChart) == 0 {
-    rgbChart = getNColors(len(rgbMap))
+    if rgbChart, err = hierarchicalRgbChart(parents, palette); err != nil {
+      return err
+    }
   }
   if len(rgbMap) != len(stateNames) {
     return fmt.Errorf("invalid number of state names")
@@ -234,10 +542,10 @@ func ExportHierarchicalTrackSegmentation(config SessionConfig, track Track, bedF
     // convert score to state
     s := int(state_old[i])
     if s < 0 || math.Floor(state_old[i]) != state_old[i] {
-      return fmt.Errorf("invalid state `%f' at `%s:%d-%d", state_old[i], r.Seqnames[i], r.Ranges[i].From, r.Ranges[i].To)
+      return NewStateError(state_old[i], "invalid state `%f' at `%s:%d-%d'", state_old[i], r.Seqnames[i], r.Ranges[i].From, r.Ranges[i].To)
     }
     if t, ok := rgbMap[s]; !ok {
-      return fmt.Errorf("rgbChart has not enough colors; invalid level or tree")
+      return NewStateError(s, "rgbChart has not enough colors; invalid level or tree")
     } else {
       state_old[i] = float64(t)
     }
@@ -280,5 +588,39 @@ func ExportHierarchicalTrackSegmentation(config SessionConfig, track Track, bedF
   r.AddMeta("thickEnd",   thickEnd)
   r.AddMeta("itemRgb",    itemRgb)
   // write result to file
-  return exportTrackSegmentation(r, bedFilename, bedName, bedDescription, compress)
+  task := BeginTask(config, fmt.Sprintf("Writing segmentation `%s'", bedFilename), "output", bedFilename)
+  if err := exportTrackSegmentation(r, bedFilename, bedName, bedDescription, compress); err != nil {
+    task.Failed(err)
+    return err
+  }
+  task.Done()
+  return nil
+}
+
+// Export the legend of a hierarchical segmentation, using the same colors as
+// ExportHierarchicalTrackSegmentation.
+func ExportHierarchicalTrackSegmentationLegend(config SessionConfig, filename string, stateNames, rgbChart []string, tree generic.HmmNode, level int, palette *Palette) error {
+  _, parents, err := hierarchicalStateMap(tree, level); if err != nil {
+    return err
+  }
+  if len(stateNames) == 0 {
+    stateNames = make([]string, len(parents))
+    for i := 0; i < len(stateNames); i++ {
+      stateNames[i] = fmt.Sprintf("s%d", i)
+    }
+  }
+  if len(rgbChart) == 0 {
+    if rgbChart, err = hierarchicalRgbChart(parents, palette); err != nil {
+      return err
+    }
+  }
+  if len(stateNames) < len(parents) || len(rgbChart) < len(parents) {
+    return fmt.Errorf("invalid number of state names or colors")
+  }
+  names  := stateNames[0:len(parents)]
+  rgbMap := make(map[string]string)
+  for i, name := range names {
+    rgbMap[name] = rgbChart[i]
+  }
+  return ExportSegmentationLegend(config, filename, names, rgbMap)
 }
@@ -20,6 +20,7 @@ package track
 
 import   "fmt"
 import   "io"
+import   "math"
 import   "sort"
 
 import . "github.com/pbenner/ngstat/config"
@@ -39,7 +40,14 @@ func segmentationHistogram(config SessionConfig, segmentation Track, tracks []Tr
   }
   err := (GenericMutableTrack{}).MapList(append([]Track{segmentation}, tracks...),
     func(seqname string, position int, v ...float64) float64 {
+      // skip bins not covered by the segmentation
+      if math.IsNaN(v[0]) {
+        return 0.0
+      }
       state := int(v[0])
+      if state < 0 || state >= nstates {
+        return 0.0
+      }
       for i := 1; i < len(v); i++ {
         values[i-1][state][v[i]] += 1
       }
@@ -59,13 +67,13 @@ func SegmentationHistogram(config SessionConfig, segmentationFilename string, tr
   for _, filename := range trackFilenames {
 
     if t, err := ImportLazyTrack(config, filename); err != nil {
-      panic(err)
+      return nil, err
     } else {
-      tracks = append(tracks, t)
+      tracks = append(tracks, t); defer t.Close()
     }
   }
   if segmentation, err := ImportTrackSegmentation(config, segmentationFilename, genome, stateMap); err != nil {
-    panic(err)
+    return nil, err
   } else {
     return segmentationHistogram(config, segmentation, tracks, nstates)
   }
@@ -0,0 +1,163 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package track
+
+/* -------------------------------------------------------------------------- */
+
+import   "errors"
+import   "io/ioutil"
+import   "math"
+import   "path/filepath"
+import   "testing"
+
+import . "github.com/pbenner/ngstat/config"
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+func segmentationTestConfig() SessionConfig {
+  config := DefaultSessionConfig()
+  config.BinSize = 10
+  config.Verbose = 0
+  return config
+}
+
+func segmentationTestImport(test *testing.T, config SessionConfig, filename string, genome Genome) (Track, []string) {
+  track, names, err := ImportTrackSegmentationWithStates(config, filename, genome, nil); if err != nil {
+    test.Fatalf("importing `%s' failed: %v", filename, err)
+  }
+  return track, names
+}
+
+func segmentationTestEqual(a, b Track) bool {
+  for _, name := range a.GetSeqNames() {
+    s1, err1 := a.GetSequence(name)
+    s2, err2 := b.GetSequence(name)
+    if err1 != nil || err2 != nil || s1.NBins() != s2.NBins() {
+      return false
+    }
+    for i := 0; i < s1.NBins(); i++ {
+      if v1, v2 := s1.AtBin(i), s2.AtBin(i); v1 != v2 && !(math.IsNaN(v1) && math.IsNaN(v2)) {
+        return false
+      }
+    }
+  }
+  return true
+}
+
+/* -------------------------------------------------------------------------- */
+
+func TestSegmentationRoundTrip(test *testing.T) {
+  config := segmentationTestConfig()
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{100, 55})
+  dir    := test.TempDir()
+  input  := filepath.Join(dir, "input.bed")
+  output := filepath.Join(dir, "output.bed")
+  // segmentation with gaps at the beginning, in the middle and at the end
+  // of sequences
+  if err := ioutil.WriteFile(input, []byte(
+    "track name=\"test\"\n" +
+    "chr1\t10\t30\tpromoter\n" +
+    "chr1\t50\t60\tenhancer\n" +
+    "chr1\t60\t80\tpromoter\n" +
+    "chr2\t0\t20\tquiescent\n" +
+    "chr2\t40\t55\tenhancer\n"), 0666); err != nil {
+    test.Fatal(err)
+  }
+  track1, names1 := segmentationTestImport(test, config, input, genome)
+  if err := ExportTrackSegmentation(config, track1, output, "test", "", false, names1, nil, nil, nil); err != nil {
+    test.Fatalf("exporting segmentation failed: %v", err)
+  }
+  track2, names2 := segmentationTestImport(test, config, output, genome)
+  if len(names1) != len(names2) {
+    test.Fatalf("got state names %v, expected %v", names2, names1)
+  }
+  for i := range names1 {
+    if names1[i] != names2[i] {
+      test.Fatalf("got state names %v, expected %v", names2, names1)
+    }
+  }
+  if !segmentationTestEqual(track1, track2) {
+    test.Error("segmentation changed after export and import")
+  }
+  // export without state names
+  if err := ExportTrackSegmentation(config, track1, output, "test", "", false, nil, nil, nil, nil); err != nil {
+    test.Fatalf("exporting segmentation without state names failed: %v", err)
+  }
+  track3, names3 := segmentationTestImport(test, config, output, genome)
+  if r := []string{"s0", "s1", "s2"}; len(names3) != len(r) || names3[0] != r[0] || names3[2] != r[2] {
+    test.Errorf("got state names %v, expected %v", names3, r)
+  }
+  if !segmentationTestEqual(track1, track3) {
+    test.Error("segmentation without state names changed after export and import")
+  }
+}
+
+func TestImportTrackSegmentationErrors(test *testing.T) {
+  config := segmentationTestConfig()
+  genome := NewGenome([]string{"chr1", "chr2"}, []int{100, 55})
+  dir    := test.TempDir()
+  for _, c := range []struct {
+    name     string
+    content  string
+    stateMap map[string]int
+    line     int
+    err      error
+  }{
+    { "missing name column",
+      "track name=\"test\"\nchr1\t0\t10\tA\nchr1\t10\t20\n", nil, 3, ErrInvalidFormat },
+    { "invalid start",
+      "chr1\tx\t10\tA\n", nil, 1, ErrInvalidFormat },
+    { "invalid end",
+      "# comment\n\nchr1\t0\t1e2\tA\n", nil, 3, ErrInvalidFormat },
+    { "invalid range",
+      "chr1\t20\t10\tA\n", nil, 1, ErrInvalidFormat },
+    { "overlapping records",
+      "chr1\t0\t20\tA\nchr1\t10\t30\tB\n", nil, 0, ErrInvalidFormat },
+    { "unaligned record",
+      "chr1\t0\t10\tA\nchr1\t10\t25\tB\n", nil, 2, ErrBinSizeMismatch },
+    { "record exceeds sequence",
+      "chr2\t0\t50\tA\nchr2\t50\t60\tB\n", nil, 2, ErrInvalidFormat },
+    { "unknown sequence",
+      "chr1\t0\t10\tA\nchr3\t0\t10\tA\n", nil, 2, ErrUnknownSequence },
+    { "unknown state",
+      "chr1\t0\t10\tA\nchr1\t10\t20\tC\n", map[string]int{"A": 0, "B": 1}, 2, ErrInvalidState },
+    { "negative state",
+      "chr1\t0\t10\tA\n", map[string]int{"A": -1}, 0, ErrInvalidState },
+  } {
+    filename := filepath.Join(dir, "input.bed")
+    if err := ioutil.WriteFile(filename, []byte(c.content), 0666); err != nil {
+      test.Fatal(err)
+    }
+    _, _, err := ImportTrackSegmentationWithStates(config, filename, genome, c.stateMap)
+    if err == nil {
+      test.Errorf("%s: invalid segmentation not rejected", c.name); continue
+    }
+    if !errors.Is(err, c.err) {
+      test.Errorf("%s: got error `%v', expected `%v'", c.name, err, c.err)
+    }
+    line := 0
+    if e := (FormatError{}); errors.As(err, &e) {
+      line = e.Line
+    }
+    if line != c.line {
+      test.Errorf("%s: got error `%v' at line `%d', expected line `%d'", c.name, err, line, c.line)
+    }
+  }
+}
@@ -23,6 +23,7 @@ import   "os"
 
 import . "github.com/pbenner/ngstat/config"
 import . "github.com/pbenner/ngstat/io"
+import . "github.com/pbenner/ngstat/utility"
 
 import . "github.com/pbenner/autodiff"
 import . "github.com/pbenner/gonetics"
@@ -31,67 +32,69 @@ import . "github.com/pbenner/gonetics"
 
 func ImportTrack(config SessionConfig, trackFilename string) (SimpleTrack, error) {
   track := SimpleTrack{}
-  PrintStderr(config, 1, "Reading track `%s'... ", trackFilename)
+  task  := BeginTask(config, fmt.Sprintf("Reading track `%s'", trackFilename), "input", trackFilename)
   if l, err := config.GetBinSummaryStatistics(); err != nil {
+    task.Failed(err)
     return track, err
   } else {
     if err := track.ImportBigWig(trackFilename, "", l, config.BinSize, config.BinOverlap, config.TrackInit); err != nil {
-      PrintStderr(config, 1, "failed\n")
+      task.Failed(err)
       return track, err
     }
   }
-  PrintStderr(config, 1, "done\n")
+  task.Done()
   return track, nil
 }
 
 func ImportLazyTrack(config SessionConfig, trackFilename string) (LazyTrackFile, error) {
   track := LazyTrackFile{}
-  PrintStderr(config, 1, "Lazy importing track `%s'... ", trackFilename)
+  task  := BeginTask(config, fmt.Sprintf("Lazy importing track `%s'", trackFilename), "input", trackFilename)
   if l, err := config.GetBinSummaryStatistics(); err != nil {
+    task.Failed(err)
     return track, err
   } else {
     if err := track.ImportBigWig(trackFilename, "", l, config.BinSize, config.BinOverlap, config.TrackInit); err != nil {
-      PrintStderr(config, 1, "failed\n")
+      task.Failed(err)
       return track, err
     }
   }
-  PrintStderr(config, 1, "done\n")
+  task.Done()
   return track, nil
 }
 
 func ImportTrackRegions(config SessionConfig, trackFilename, bedFilename string) (GRanges, error) {
   r := GRanges{}
-  PrintStderr(config, 1, "Reading bed file `%s'... ", bedFilename)
+  task := BeginTask(config, fmt.Sprintf("Reading bed file `%s'", bedFilename), "input", bedFilename)
   if err := r.ImportBed3(bedFilename); err != nil {
-    PrintStderr(config, 1, "failed\n")
+    task.Failed(err)
     return r, err
   } else {
-    PrintStderr(config, 1, "done\n")
+    task.Done()
   }
 
-  PrintStderr(config, 1, "Importing regions from track `%s'... ", trackFilename)
+  task = BeginTask(config, fmt.Sprintf("Importing regions from track `%s'", trackFilename), "input", trackFilename)
   if l, err := config.GetBinSummaryStatistics(); err != nil {
-    PrintStderr(config, 1, "failed\n")
+    task.Failed(err)
     return r, err
   } else {
     if err := r.ImportBigWig(trackFilename, "counts", l, config.BinSize, config.BinOverlap, config.TrackInit, false); err != nil {
-      PrintStderr(config, 1, "failed\n")
+      task.Failed(err)
       return r, err
     }
   }
-  PrintStderr(config, 1, "done\n")
+  task.Done()
   return r, nil
 }
 
 func ExportTrack(config SessionConfig, track Track, trackFilename string) error {
-  PrintStderr(config, 1, "Writing track `%s'... ", trackFilename)
+  task := BeginTask(config, fmt.Sprintf("Writing track `%s'", trackFilename), "output", trackFilename)
   parameters := DefaultBigWigParameters()
   parameters.ReductionLevels = config.BWZoomLevels
-  if err := (GenericTrack{track}).ExportBigWig(trackFilename, parameters); err != nil {
-    PrintStderr(config, 1, "failed\n")
+  if err := (GenericTrack{Track: track}).ExportBigWig(trackFilename, parameters); err != nil {
+    task.Failed(err)
     return err
   } else {
-    PrintStderr(config, 1, "done\n")
+    task.Done()
   }
   return nil
 }
@@ -109,25 +112,25 @@ func ImportSingleTrackData(config SessionConfig, t ScalarType, filenameBw string
     s = t
   }
 
-  PrintStderr(config, 1, "Opening track file `%s'... ", filenameBw)
+  task := BeginTask(config, fmt.Sprintf("Opening track file `%s'", filenameBw), "input", filenameBw)
   // create a reader for each bigWig file
   f, err := os.Open(filenameBw)
   if err != nil {
-    PrintStderr(config, 1, "failed\n")
+    task.Failed(err)
     return nil, err
   }
   defer f.Close()
 
   bwr, err := NewBigWigReader(f); if err != nil {
-    PrintStderr(config, 1, "failed\n")
+    task.Failed(err)
     return nil, err
   }
-  PrintStderr(config, 1, "done\n")
+  task.Done()
 
-  PrintStderr(config, 1, "Importing data... ")
+  task = BeginTask(config, "Importing data", "regions", n)
   for i := 0; i < n; i++ {
     if slice, _, err := bwr.QuerySlice(regions.Seqnames[i], regions.Ranges[i].From, regions.Ranges[i].To, s, config.BinSize, config.BinOverlap, config.TrackInit); err != nil {
-      PrintStderr(config, 1, "failed\n")
+      task.Failed(err)
       return nil, err
     } else {
       v := NullDenseVector(t, len(slice))
@@ -137,7 +140,7 @@ func ImportSingleTrackData(config SessionConfig, t ScalarType, filenameBw string
       r[i] = v
     }
   }
-  PrintStderr(config, 1, "done\n")
+  task.Done()
 
   return r, nil
 }
@@ -157,29 +160,30 @@ func ImportMultiTrackData(config SessionConfig, t ScalarType, filenamesBw []stri
 
   // create a reader for each bigWig file
   for j, filename := range filenamesBw {
-    PrintStderr(config, 1, "Opening track file `%s'... ", filename)
+    task := BeginTask(config, fmt.Sprintf("Opening track file `%s'", filename), "input", filename)
     f, err := os.Open(filename)
     if err != nil {
-      PrintStderr(config, 1, "failed\n")
+      task.Failed(err)
       return nil, err
     }
     defer f.Close()
 
     if reader, err := NewBigWigReader(f); err != nil {
-      PrintStderr(config, 1, "failed\n")
+      task.Failed(err)
       return nil, err
     } else {
       bwr[j] = reader
     }
-    PrintStderr(config, 1, "done\n")
+    task.Done()
   }
 
-  PrintStderr(config, 1, "Importing data... ")
+  task := BeginTask(config, "Importing data", "regions", n)
   for i := 0; i < n; i++ {
     values  := []float64{}
     binSize := config.BinSize
     for j := 0; j < m; j++ {
       if slice, bs, err := bwr[j].QuerySlice(regions.Seqnames[i], regions.Ranges[i].From, regions.Ranges[i].To, s, binSize, config.BinOverlap, config.TrackInit); err != nil {
+        task.Failed(err)
         return nil, err
       } else {
         values = append(values, slice...)
@@ -189,8 +193,9 @@ func ImportMultiTrackData(config SessionConfig, t ScalarType, filenamesBw []stri
       }
     }
     if len(values) % m != 0 {
-      PrintStderr(config, 1, "failed\n")
-      return nil, fmt.Errorf("received data of varying lengths from bigWig files")
+      err := NewDimensionError(0, len(values), "received data of varying lengths from bigWig files")
+      task.Failed(err)
+      return nil, err
     }
     v := NullDenseVector(t, len(values))
     for k := 0; k < len(values); k++ {
@@ -198,7 +203,7 @@ func ImportMultiTrackData(config SessionConfig, t ScalarType, filenamesBw []stri
     }
     r[i] = v.AsMatrix(m, len(values)/m)
   }
-  PrintStderr(config, 1, "done\n")
+  task.Done()
 
   return r, nil
 }
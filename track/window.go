@@ -0,0 +1,628 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package track
+
+/* -------------------------------------------------------------------------- */
+
+import   "math"
+import   "sort"
+
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/autodiff"
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+// Position of the bin to which a window is assigned (anchor) relative to
+// the window.
+type WindowAnchor int
+
+const (
+  // windows are assigned to their center bin, for even window sizes the
+  // bin right of the center is used
+  WindowAnchorCenter WindowAnchor = iota
+  // windows are assigned to their first bin
+  WindowAnchorStart
+  // windows are assigned to their last bin
+  WindowAnchorEnd
+)
+
+// Treatment of windows that contain missing values.
+type WindowNaNPolicy int
+
+const (
+  // windows with missing values are returned as any other window
+  WindowKeepNaN WindowNaNPolicy = iota
+  // windows with missing values are skipped
+  WindowSkipNaN
+)
+
+// Treatment of windows that extend beyond the ends of a sequence.
+type WindowPadding int
+
+const (
+  // only complete windows are returned
+  WindowPadNone WindowPadding = iota
+  // windows are padded with zeros
+  WindowPadZero
+  // windows are padded with the first or last value of the sequence
+  WindowPadReplicate
+  // windows are padded by mirroring the sequence at its ends
+  WindowPadReflect
+)
+
+// Mode for assigning results of windows to bins.
+type WindowAggregation int
+
+const (
+  // the result of a window is assigned to its anchor, or to the bins
+  // around the anchor that are closest to this window if the step size
+  // is larger than one
+  WindowAggregateCenter WindowAggregation = iota
+  // each bin is assigned the maximum result of all windows covering it
+  WindowAggregateMax
+  // each bin is assigned the mean result of all windows covering it
+  WindowAggregateMean
+)
+
+type WindowParameters struct {
+  // window size in bins
+  Size       int
+  // distance (in bins) between the anchors of two consecutive windows,
+  // anchors are placed at multiples of the step size starting at the
+  // first complete window of a sequence
+  Step       int
+  // bin to which a window is assigned
+  Anchor     WindowAnchor
+  // multi-track windows are size x tracks instead of
+  // tracks x size matrices
+  Transposed bool
+  // treatment of windows with missing values
+  NaN        WindowNaNPolicy
+  // treatment of windows at the ends of a sequence
+  Padding    WindowPadding
+  // if not empty, only windows that lie entirely within one of the
+  // regions are returned
+  Regions    GRanges
+}
+
+func DefaultWindowParameters(size int) WindowParameters {
+  return WindowParameters{
+    Size      : size,
+    Step      : 1,
+    Anchor    : WindowAnchorCenter,
+    Transposed: false,
+    NaN       : WindowKeepNaN,
+    Padding   : WindowPadNone }
+}
+
+// Number of bins of a window before and after the anchor. The window size
+// may also be given in base pairs, in which case offsets are in base pairs.
+func WindowOffsets(size int, anchor WindowAnchor) (int, int) {
+  if size < 1 {
+    return 0, 0
+  }
+  switch anchor {
+  case WindowAnchorStart:
+    return 0, size-1
+  case WindowAnchorEnd:
+    return size-1, 0
+  default:
+    return DivIntUp(size-1, 2), DivIntDown(size-1, 2)
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Window of one or more tracks. Vectors and matrices are views into the
+// memory of the current sequence and must not be modified.
+type Window struct {
+  Seqname  string
+  // anchor of the window
+  Position int
+  // first bin of the window, which is negative if the window is padded
+  From     int
+  // last bin of the window plus one, which is larger than the sequence
+  // length if the window is padded
+  To       int
+  // window of single-track iterators
+  Vector   Vector
+  // window of multi-track iterators
+  Matrix   Matrix
+}
+
+/* -------------------------------------------------------------------------- */
+
+// interval [from, to) of anchor positions
+type windowSpan struct {
+  from, to int
+}
+
+// Compute the union of a set of intervals.
+func windowSpanUnion(spans []windowSpan) []windowSpan {
+  sort.Slice(spans, func(i, j int) bool { return spans[i].from < spans[j].from })
+  r := []windowSpan{}
+  for _, s := range spans {
+    if s.from >= s.to {
+      continue
+    }
+    if n := len(r); n > 0 && s.from <= r[n-1].to {
+      if s.to > r[n-1].to {
+        r[n-1].to = s.to
+      }
+    } else {
+      r = append(r, s)
+    }
+  }
+  return r
+}
+
+// Compute the intersection of two sorted sets of disjoint intervals.
+func windowSpanIntersection(a, b []windowSpan) []windowSpan {
+  r := []windowSpan{}
+  for i, j := 0, 0; i < len(a) && j < len(b); {
+    from := a[i].from
+    to   := a[i].to
+    if b[j].from > from {
+      from = b[j].from
+    }
+    if b[j].to < to {
+      to = b[j].to
+    }
+    if from < to {
+      r = append(r, windowSpan{from, to})
+    }
+    if a[i].to < b[j].to {
+      i++
+    } else {
+      j++
+    }
+  }
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Windows of a single sequence, which may be accessed in arbitrary order
+// (e.g. from several threads). Positions of windows are computed when the
+// sequence is created, whereas track data is only converted when Load is
+// called, which allows to reserve memory in advance.
+type WindowSequence struct {
+  Seqname    string
+  Sequences  []TrackSequence
+  scalarType ScalarType
+  parameters WindowParameters
+  multi      bool
+  offset1    int
+  offset2    int
+  // anchor of the first complete window, which is the origin of
+  // the grid of anchors
+  origin     int
+  spans      []windowSpan
+  // cumulative number of windows up to each span
+  counts     []int
+  vector     Vector
+  matrix     Matrix
+}
+
+func newWindowSequence(t ScalarType, seqname string, sequences []TrackSequence, regions []windowSpan, parameters WindowParameters, multi bool) *WindowSequence {
+  s := WindowSequence{}
+  s.Seqname    = seqname
+  s.Sequences  = sequences
+  s.scalarType = t
+  s.parameters = parameters
+  s.multi      = multi
+  s.offset1, s.offset2 = WindowOffsets(parameters.Size, parameters.Anchor)
+
+  n := s.NBins()
+  // range of bins including padding
+  from, to := 0, n
+  if parameters.Padding != WindowPadNone && n > 0 {
+    from, to = -s.offset1, n+s.offset2
+  }
+  // anchors of complete windows
+  s.origin = from+s.offset1
+  if to-from >= parameters.Size {
+    s.spans = []windowSpan{{from+s.offset1, to-s.offset2}}
+  }
+  if regions != nil {
+    r := make([]windowSpan, len(regions))
+    for i, region := range regions {
+      // regions at the ends of the sequence are padded
+      if region.from <= 0 {
+        region.from = from
+      }
+      if region.to >= n {
+        region.to = to
+      }
+      r[i] = windowSpan{region.from+s.offset1, region.to-s.offset2}
+    }
+    s.spans = windowSpanIntersection(s.spans, windowSpanUnion(r))
+  }
+  if parameters.NaN == WindowSkipNaN {
+    r := []windowSpan{}
+    // anchors of windows within runs of bins without missing values
+    for i := from; i < to; {
+      for i < to && s.hasNaN(i) {
+        i++
+      }
+      j := i
+      for i < to && !s.hasNaN(i) {
+        i++
+      }
+      if i-j >= parameters.Size {
+        r = append(r, windowSpan{j+s.offset1, i-s.offset2})
+      }
+    }
+    s.spans = windowSpanIntersection(s.spans, r)
+  }
+  // count windows, anchors are aligned to the first complete window
+  s.counts = make([]int, len(s.spans)+1)
+  for i, span := range s.spans {
+    s.counts[i+1] = s.counts[i]
+    if first := s.first(span); first < span.to {
+      s.counts[i+1] += (span.to-1-first)/parameters.Step + 1
+    }
+  }
+  return &s
+}
+
+// Index of the bin from which the value of bin i is taken, or -1 if bin i
+// is padded with zeros.
+func (s *WindowSequence) source(i int) int {
+  n := s.NBins()
+  if i >= 0 && i < n {
+    return i
+  }
+  switch s.parameters.Padding {
+  case WindowPadReplicate:
+    if i < 0 {
+      return 0
+    }
+    return n-1
+  case WindowPadReflect:
+    if n == 1 {
+      return 0
+    }
+    p := 2*(n-1)
+    if i = ((i % p) + p) % p; i >= n {
+      i = p-i
+    }
+    return i
+  default:
+    return -1
+  }
+}
+
+// Value of bin i of the j-th sequence, including padding.
+func (s *WindowSequence) at(j, i int) float64 {
+  if i = s.source(i); i < 0 {
+    return 0.0
+  }
+  return s.Sequences[j].AtBin(i)
+}
+
+func (s *WindowSequence) hasNaN(i int) bool {
+  for j := range s.Sequences {
+    if math.IsNaN(s.at(j, i)) {
+      return true
+    }
+  }
+  return false
+}
+
+// Number of padded bins at the beginning and end of the sequence.
+func (s *WindowSequence) padding() (int, int) {
+  if s.parameters.Padding == WindowPadNone {
+    return 0, 0
+  }
+  return s.offset1, s.offset2
+}
+
+// first anchor within a span
+func (s *WindowSequence) first(span windowSpan) int {
+  return s.origin + DivIntUp(span.from-s.origin, s.parameters.Step)*s.parameters.Step
+}
+
+// Number of bins of the sequence.
+func (s *WindowSequence) NBins() int {
+  if len(s.Sequences) == 0 {
+    return 0
+  }
+  return s.Sequences[0].NBins()
+}
+
+// Number of windows of the sequence.
+func (s *WindowSequence) Len() int {
+  return s.counts[len(s.counts)-1]
+}
+
+// Anchor of the k-th window.
+func (s *WindowSequence) Position(k int) int {
+  i := sort.SearchInts(s.counts, k+1) - 1
+  return s.first(s.spans[i]) + (k-s.counts[i])*s.parameters.Step
+}
+
+// Memory (in bytes) required for converting track data.
+func (s *WindowSequence) Bytes() int64 {
+  p1, p2 := s.padding()
+  return 8*int64(s.NBins()+p1+p2)*int64(len(s.Sequences))
+}
+
+// Convert track data of the sequence, which is required before windows
+// can be accessed. Calling Load more than once has no effect.
+func (s *WindowSequence) Load() {
+  if s.vector != nil || s.matrix != nil {
+    return
+  }
+  p1, p2 := s.padding()
+  n := s.NBins()+p1+p2
+  if s.multi {
+    if s.parameters.Transposed {
+      s.matrix = NullDenseMatrix(s.scalarType, n, len(s.Sequences))
+    } else {
+      s.matrix = NullDenseMatrix(s.scalarType, len(s.Sequences), n)
+    }
+    for j := range s.Sequences {
+      for i := 0; i < n; i++ {
+        if s.parameters.Transposed {
+          s.matrix.At(i, j).SetFloat64(s.at(j, i-p1))
+        } else {
+          s.matrix.At(j, i).SetFloat64(s.at(j, i-p1))
+        }
+      }
+    }
+  } else {
+    s.vector = NullDenseVector(s.scalarType, n)
+    for i := 0; i < n; i++ {
+      s.vector.At(i).SetFloat64(s.at(0, i-p1))
+    }
+  }
+}
+
+// Get the k-th window of the sequence. The sequence must be loaded.
+func (s *WindowSequence) Window(k int) Window {
+  i := s.Position(k)
+  w := Window{Seqname: s.Seqname, Position: i, From: i-s.offset1, To: i+s.offset2+1}
+  // position of the window in memory
+  p, _ := s.padding()
+  from := w.From+p
+  to   := w.To  +p
+  if s.multi {
+    if s.parameters.Transposed {
+      _, ncols := s.matrix.Dims()
+      w.Matrix = s.matrix.Slice(from, to, 0, ncols)
+    } else {
+      nrows, _ := s.matrix.Dims()
+      w.Matrix = s.matrix.Slice(0, nrows, from, to)
+    }
+  } else {
+    w.Vector = s.vector.Slice(from, to)
+  }
+  return w
+}
+
+// Assign results of all windows to the bins of dst, where results[k] is the
+// result of the k-th window. Bins not covered by any window are set to NaN.
+func (s *WindowSequence) Aggregate(dst TrackSequence, results []float64, aggregation WindowAggregation) {
+  n := s.NBins()
+  for i := 0; i < n; i++ {
+    dst.SetBin(i, math.NaN())
+  }
+  if aggregation == WindowAggregateCenter {
+    // bins closest to the anchor within the window
+    d1, d2 := WindowOffsets(s.parameters.Step, WindowAnchorCenter)
+    for k := 0; k < s.Len(); k++ {
+      i := s.Position(k)
+      for j := MaxInt(i-d1, i-s.offset1, 0); j <= MinInt(i+d2, i+s.offset2, n-1); j++ {
+        dst.SetBin(j, results[k])
+      }
+    }
+    return
+  }
+  // results at anchor positions
+  x := make([]float64, n)
+  for i := 0; i < n; i++ {
+    x[i] = math.NaN()
+  }
+  for k := 0; k < s.Len(); k++ {
+    x[s.Position(k)] = results[k]
+  }
+  // bin i is covered by windows with anchors in [i-offset2, i+offset1],
+  // which is a range that slides over the sequence
+  switch aggregation {
+  case WindowAggregateMax:
+    // indices of candidates for the maximum in decreasing order of their
+    // values
+    q := []int{}
+    for i, j := 0, 0; i < n; i++ {
+      for ; j < n && j <= i+s.offset1; j++ {
+        if math.IsNaN(x[j]) {
+          continue
+        }
+        for len(q) > 0 && x[q[len(q)-1]] <= x[j] {
+          q = q[:len(q)-1]
+        }
+        q = append(q, j)
+      }
+      for len(q) > 0 && q[0] < i-s.offset2 {
+        q = q[1:]
+      }
+      if len(q) > 0 {
+        dst.SetBin(i, x[q[0]])
+      }
+    }
+  case WindowAggregateMean:
+    sum := 0.0
+    cnt := 0
+    for i, j := 0, 0; i < n; i++ {
+      for ; j < n && j <= i+s.offset1; j++ {
+        if !math.IsNaN(x[j]) {
+          sum += x[j]; cnt++
+        }
+      }
+      if k := i-s.offset2-1; k >= 0 && !math.IsNaN(x[k]) {
+        sum -= x[k]; cnt--
+      }
+      if cnt > 0 {
+        dst.SetBin(i, sum/float64(cnt))
+      }
+    }
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Iterator over the windows of one or more tracks. Windows can either be
+// visited one by one using Next, or sequence-wise using NextSequence:
+//
+//   for it.Next() {
+//     w := it.Window()
+//     ...
+//   }
+//   if err := it.Err(); err != nil {
+//     ...
+//   }
+//
+// Tracks must have the same bin size and sequences must have the same
+// lengths on all tracks.
+type WindowIterator struct {
+  tracks     []Track
+  scalarType ScalarType
+  parameters WindowParameters
+  multi      bool
+  seqnames   []string
+  // regions in bins
+  regions    map[string][]windowSpan
+  i          int
+  k          int
+  sequence   *WindowSequence
+  err        error
+}
+
+func newWindowIterator(t ScalarType, tracks []Track, parameters WindowParameters, multi bool) (*WindowIterator, error) {
+  if len(tracks) == 0 {
+    return nil, NewArgumentError("no tracks given")
+  }
+  if parameters.Size < 1 {
+    return nil, NewArgumentError("invalid window size `%d'", parameters.Size)
+  }
+  if parameters.Step < 0 {
+    return nil, NewArgumentError("invalid step size `%d'", parameters.Step)
+  }
+  if parameters.Step == 0 {
+    parameters.Step = 1
+  }
+  binSize := tracks[0].GetBinSize()
+  for j := 1; j < len(tracks); j++ {
+    if tracks[j].GetBinSize() != binSize {
+      return nil, NewBinSizeError(binSize, tracks[j].GetBinSize(), "tracks `1' and `%d' have different bin sizes (`%d' and `%d')", j+1, binSize, tracks[j].GetBinSize())
+    }
+  }
+  it := WindowIterator{}
+  it.tracks     = tracks
+  it.scalarType = t
+  it.parameters = parameters
+  it.multi      = multi
+  it.seqnames   = tracks[0].GetSeqNames()
+  if parameters.Regions.Length() > 0 {
+    it.regions = make(map[string][]windowSpan)
+    for i := 0; i < parameters.Regions.Length(); i++ {
+      // bins that are entirely within the region
+      r := parameters.Regions.Ranges[i]
+      s := windowSpan{DivIntUp(r.From, binSize), r.To/binSize}
+      it.regions[parameters.Regions.Seqnames[i]] = append(it.regions[parameters.Regions.Seqnames[i]], s)
+    }
+  }
+  return &it, nil
+}
+
+// Iterate over windows of a single track. Windows are returned as vectors.
+func NewSingleTrackWindowIterator(t ScalarType, track Track, parameters WindowParameters) (*WindowIterator, error) {
+  return newWindowIterator(t, []Track{track}, parameters, false)
+}
+
+// Iterate over windows of multiple tracks. Windows are returned as tracks x size
+// matrices, or size x tracks matrices if transposed.
+func NewMultiTrackWindowIterator(t ScalarType, tracks []Track, parameters WindowParameters) (*WindowIterator, error) {
+  return newWindowIterator(t, tracks, parameters, true)
+}
+
+// Advance to the next sequence. Track data of the sequence is not loaded.
+func (it *WindowIterator) NextSequence() bool {
+  if it.err != nil || it.i >= len(it.seqnames) {
+    it.sequence = nil
+    return false
+  }
+  name := it.seqnames[it.i]
+  sequences := make([]TrackSequence, len(it.tracks))
+  for j, track := range it.tracks {
+    seq, err := track.GetSequence(name); if err != nil {
+      it.err = SequenceError{Seqname: name, Err: err}
+      it.sequence = nil
+      return false
+    }
+    if j > 0 && seq.NBins() != sequences[0].NBins() {
+      it.err = NewDimensionError(sequences[0].NBins(), seq.NBins(), "lengths of sequence `%s' varies between tracks", name)
+      it.sequence = nil
+      return false
+    }
+    sequences[j] = seq
+  }
+  var regions []windowSpan
+  if it.regions != nil {
+    // sequences without regions have no windows
+    regions = append([]windowSpan{}, it.regions[name]...)
+  }
+  it.sequence = newWindowSequence(it.scalarType, name, sequences, regions, it.parameters, it.multi)
+  it.i++
+  it.k = -1
+  return true
+}
+
+// Current sequence.
+func (it *WindowIterator) Sequence() *WindowSequence {
+  return it.sequence
+}
+
+// Advance to the next window. Sequences are loaded as required.
+func (it *WindowIterator) Next() bool {
+  if it.sequence != nil && it.k+1 < it.sequence.Len() {
+    it.k++
+    return true
+  }
+  for it.NextSequence() {
+    if it.sequence.Len() > 0 {
+      it.sequence.Load()
+      it.k = 0
+      return true
+    }
+  }
+  return false
+}
+
+// Current window.
+func (it *WindowIterator) Window() Window {
+  return it.sequence.Window(it.k)
+}
+
+// Error that stopped the iteration, if any.
+func (it *WindowIterator) Err() error {
+  return it.err
+}
@@ -0,0 +1,333 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package track
+
+/* -------------------------------------------------------------------------- */
+
+import   "errors"
+import   "fmt"
+import   "math"
+import   "testing"
+
+import . "github.com/pbenner/ngstat/utility"
+
+import . "github.com/pbenner/autodiff"
+import . "github.com/pbenner/gonetics"
+
+/* -------------------------------------------------------------------------- */
+
+const windowTestBinSize = 10
+
+func windowTestTrack(sequences ...[]float64) Track {
+  seqnames := make([]string, len(sequences))
+  lengths  := make([]int,    len(sequences))
+  for i, x := range sequences {
+    seqnames[i] = fmt.Sprintf("chr%d", i+1)
+    lengths [i] = len(x)*windowTestBinSize
+  }
+  track, err := NewSimpleTrack("test", sequences, NewGenome(seqnames, lengths), windowTestBinSize)
+  if err != nil {
+    panic(err)
+  }
+  return track
+}
+
+func windowTestEqual(a, b []float64) bool {
+  if len(a) != len(b) {
+    return false
+  }
+  for i := range a {
+    if math.IsNaN(a[i]) && math.IsNaN(b[i]) {
+      continue
+    }
+    if math.Abs(a[i]-b[i]) > 1e-12 {
+      return false
+    }
+  }
+  return true
+}
+
+// Collect anchors (prefixed by the sequence name) and values of all windows.
+func windowTestCollect(it *WindowIterator) ([]string, [][]float64) {
+  positions := []string{}
+  windows   := [][]float64{}
+  for it.Next() {
+    w := it.Window()
+    x := []float64{}
+    if w.Vector != nil {
+      for i := 0; i < w.Vector.Dim(); i++ {
+        x = append(x, w.Vector.Float64At(i))
+      }
+    } else {
+      n, m := w.Matrix.Dims()
+      for i := 0; i < n; i++ {
+        for j := 0; j < m; j++ {
+          x = append(x, w.Matrix.Float64At(i, j))
+        }
+      }
+    }
+    positions = append(positions, fmt.Sprintf("%s:%d", w.Seqname, w.Position))
+    windows   = append(windows, x)
+  }
+  return positions, windows
+}
+
+/* -------------------------------------------------------------------------- */
+
+func TestWindowSpan(test *testing.T) {
+  union := windowSpanUnion([]windowSpan{{5, 7}, {0, 2}, {1, 3}, {8, 8}, {3, 4}})
+  if r := []windowSpan{{0, 4}, {5, 7}}; fmt.Sprint(union) != fmt.Sprint(r) {
+    test.Errorf("union: got %v, expected %v", union, r)
+  }
+  for _, c := range []struct {
+    a, b, r []windowSpan
+  }{
+    {[]windowSpan{{0, 4}, {6, 10}}, []windowSpan{{2, 7}, {9, 12}}, []windowSpan{{2, 4}, {6, 7}, {9, 10}}},
+    {[]windowSpan{{0, 4}, {6, 10}}, []windowSpan{{4, 6}},          []windowSpan{}},
+    {[]windowSpan{{0, 4}},          []windowSpan{},                []windowSpan{}},
+    {[]windowSpan{{0, 10}},         []windowSpan{{1, 2}, {3, 5}},  []windowSpan{{1, 2}, {3, 5}}},
+  } {
+    if r := windowSpanIntersection(c.a, c.b); fmt.Sprint(r) != fmt.Sprint(c.r) {
+      test.Errorf("intersection of %v and %v: got %v, expected %v", c.a, c.b, r, c.r)
+    }
+  }
+}
+
+func TestWindowIterator(test *testing.T) {
+  nan := math.NaN()
+  x   := []float64{1, 2, 3, 4, 5, 6, 7}
+  parameters := func(size int, f func(*WindowParameters)) WindowParameters {
+    p := DefaultWindowParameters(size)
+    if f != nil {
+      f(&p)
+    }
+    return p
+  }
+  for _, c := range []struct {
+    name       string
+    data       [][]float64
+    parameters WindowParameters
+    positions  []string
+    windows    [][]float64
+  }{
+    { "center",
+      [][]float64{x}, parameters(3, nil),
+      []string{"chr1:1", "chr1:2", "chr1:3", "chr1:4", "chr1:5"},
+      [][]float64{{1, 2, 3}, {2, 3, 4}, {3, 4, 5}, {4, 5, 6}, {5, 6, 7}} },
+    { "center (even size)",
+      [][]float64{x}, parameters(4, nil),
+      []string{"chr1:2", "chr1:3", "chr1:4", "chr1:5"},
+      [][]float64{{1, 2, 3, 4}, {2, 3, 4, 5}, {3, 4, 5, 6}, {4, 5, 6, 7}} },
+    { "anchor start",
+      [][]float64{x}, parameters(3, func(p *WindowParameters) { p.Anchor = WindowAnchorStart }),
+      []string{"chr1:0", "chr1:1", "chr1:2", "chr1:3", "chr1:4"},
+      [][]float64{{1, 2, 3}, {2, 3, 4}, {3, 4, 5}, {4, 5, 6}, {5, 6, 7}} },
+    { "anchor end",
+      [][]float64{x}, parameters(3, func(p *WindowParameters) { p.Anchor = WindowAnchorEnd }),
+      []string{"chr1:2", "chr1:3", "chr1:4", "chr1:5", "chr1:6"},
+      [][]float64{{1, 2, 3}, {2, 3, 4}, {3, 4, 5}, {4, 5, 6}, {5, 6, 7}} },
+    { "step 2",
+      [][]float64{x}, parameters(3, func(p *WindowParameters) { p.Step = 2 }),
+      []string{"chr1:1", "chr1:3", "chr1:5"},
+      [][]float64{{1, 2, 3}, {3, 4, 5}, {5, 6, 7}} },
+    { "step 3",
+      [][]float64{x}, parameters(3, func(p *WindowParameters) { p.Step = 3 }),
+      []string{"chr1:1", "chr1:4"},
+      [][]float64{{1, 2, 3}, {4, 5, 6}} },
+    { "size equals sequence length",
+      [][]float64{x}, parameters(7, nil),
+      []string{"chr1:3"},
+      [][]float64{x} },
+    { "sequence shorter than window",
+      [][]float64{x, {1, 2, 3}}, parameters(5, nil),
+      []string{"chr1:2", "chr1:3", "chr1:4"},
+      [][]float64{{1, 2, 3, 4, 5}, {2, 3, 4, 5, 6}, {3, 4, 5, 6, 7}} },
+    { "sequence shorter than window (zero padding)",
+      [][]float64{{1, 2, 3}}, parameters(5, func(p *WindowParameters) { p.Padding = WindowPadZero }),
+      []string{"chr1:0", "chr1:1", "chr1:2"},
+      [][]float64{{0, 0, 1, 2, 3}, {0, 1, 2, 3, 0}, {1, 2, 3, 0, 0}} },
+    { "replicate padding",
+      [][]float64{x}, parameters(5, func(p *WindowParameters) { p.Padding = WindowPadReplicate; p.Step = 6 }),
+      []string{"chr1:0", "chr1:6"},
+      [][]float64{{1, 1, 1, 2, 3}, {5, 6, 7, 7, 7}} },
+    { "reflect padding",
+      [][]float64{x}, parameters(5, func(p *WindowParameters) { p.Padding = WindowPadReflect; p.Step = 6 }),
+      []string{"chr1:0", "chr1:6"},
+      [][]float64{{3, 2, 1, 2, 3}, {5, 6, 7, 6, 5}} },
+    { "reflect padding (single bin)",
+      [][]float64{{4}}, parameters(3, func(p *WindowParameters) { p.Padding = WindowPadReflect }),
+      []string{"chr1:0"},
+      [][]float64{{4, 4, 4}} },
+    { "padding with step 2",
+      [][]float64{x}, parameters(3, func(p *WindowParameters) { p.Padding = WindowPadReplicate; p.Step = 2 }),
+      []string{"chr1:0", "chr1:2", "chr1:4", "chr1:6"},
+      [][]float64{{1, 1, 2}, {2, 3, 4}, {4, 5, 6}, {6, 7, 7}} },
+    { "skip NaN",
+      [][]float64{{1, 2, nan, 4, 5, 6, 7}}, parameters(3, func(p *WindowParameters) { p.NaN = WindowSkipNaN }),
+      []string{"chr1:4", "chr1:5"},
+      [][]float64{{4, 5, 6}, {5, 6, 7}} },
+    { "regions",
+      // bins [2,5), the partially covered bin 5 is excluded
+      [][]float64{x, x}, parameters(3, func(p *WindowParameters) { p.Regions = NewGRanges([]string{"chr1"}, []int{15}, []int{52}, nil) }),
+      []string{"chr1:3"},
+      [][]float64{{3, 4, 5}} },
+    { "regions with step 2",
+      // windows remain on the grid starting at the first complete window
+      [][]float64{x}, parameters(3, func(p *WindowParameters) { p.Regions = NewGRanges([]string{"chr1"}, []int{30}, []int{70}, nil); p.Step = 2 }),
+      []string{"chr1:5"},
+      [][]float64{{5, 6, 7}} },
+    { "regions at sequence ends with padding",
+      [][]float64{x}, parameters(3, func(p *WindowParameters) { p.Regions = NewGRanges([]string{"chr1", "chr1"}, []int{0, 50}, []int{20, 70}, nil); p.Padding = WindowPadZero }),
+      []string{"chr1:0", "chr1:6"},
+      [][]float64{{0, 1, 2}, {6, 7, 0}} },
+    { "skip NaN within regions",
+      [][]float64{{1, 2, 3, nan, 5, 6, 7, 8, 9}, x},
+      parameters(3, func(p *WindowParameters) {
+        p.NaN     = WindowSkipNaN
+        p.Regions = NewGRanges([]string{"chr1", "chr1"}, []int{0, 40}, []int{50, 90}, nil)
+      }),
+      []string{"chr1:1", "chr1:5", "chr1:6", "chr1:7"},
+      [][]float64{{1, 2, 3}, {5, 6, 7}, {6, 7, 8}, {7, 8, 9}} },
+  } {
+    it, err := NewSingleTrackWindowIterator(Float64Type, windowTestTrack(c.data...), c.parameters)
+    if err != nil {
+      test.Fatalf("%s: %v", c.name, err)
+    }
+    positions, windows := windowTestCollect(it)
+    if err := it.Err(); err != nil {
+      test.Errorf("%s: %v", c.name, err)
+    }
+    if fmt.Sprint(positions) != fmt.Sprint(c.positions) {
+      test.Errorf("%s: got windows at %v, expected %v", c.name, positions, c.positions)
+      continue
+    }
+    for k := range windows {
+      if !windowTestEqual(windows[k], c.windows[k]) {
+        test.Errorf("%s: window at %s is %v, expected %v", c.name, positions[k], windows[k], c.windows[k])
+      }
+    }
+  }
+}
+
+func TestWindowIteratorMultiTrack(test *testing.T) {
+  nan := math.NaN()
+  tracks := []Track{
+    windowTestTrack([]float64{1, 2, 3, 4, 5}),
+    windowTestTrack([]float64{6, 7, 8, nan, 9}) }
+  for _, c := range []struct {
+    name      string
+    transposed bool
+    positions []string
+    windows   [][]float64
+  }{
+    { "tracks x size", false, []string{"chr1:1"}, [][]float64{{1, 2, 3, 6, 7, 8}} },
+    { "size x tracks", true,  []string{"chr1:1"}, [][]float64{{1, 6, 2, 7, 3, 8}} },
+  } {
+    parameters := DefaultWindowParameters(3)
+    parameters.Transposed = c.transposed
+    // missing values on any track exclude a window
+    parameters.NaN        = WindowSkipNaN
+    it, err := NewMultiTrackWindowIterator(Float64Type, tracks, parameters)
+    if err != nil {
+      test.Fatalf("%s: %v", c.name, err)
+    }
+    positions, windows := windowTestCollect(it)
+    if fmt.Sprint(positions) != fmt.Sprint(c.positions) {
+      test.Errorf("%s: got windows at %v, expected %v", c.name, positions, c.positions)
+      continue
+    }
+    for k := range windows {
+      if !windowTestEqual(windows[k], c.windows[k]) {
+        test.Errorf("%s: window at %s is %v, expected %v", c.name, positions[k], windows[k], c.windows[k])
+      }
+    }
+  }
+}
+
+func TestWindowIteratorErrors(test *testing.T) {
+  track1 := windowTestTrack([]float64{1, 2, 3})
+  track2, _ := NewSimpleTrack("test", [][]float64{{1}}, NewGenome([]string{"chr1"}, []int{30}), 30)
+  for _, c := range []struct {
+    name       string
+    tracks     []Track
+    parameters WindowParameters
+    err        error
+  }{
+    { "no tracks",          []Track{},               DefaultWindowParameters(1), ErrInvalidArgument },
+    { "invalid size",       []Track{track1},         DefaultWindowParameters(0), ErrInvalidArgument },
+    { "invalid step",       []Track{track1},         WindowParameters{Size: 1, Step: -1}, ErrInvalidArgument },
+    { "different bin size", []Track{track1, track2}, DefaultWindowParameters(1), ErrBinSizeMismatch },
+  } {
+    if _, err := NewMultiTrackWindowIterator(Float64Type, c.tracks, c.parameters); !errors.Is(err, c.err) {
+      test.Errorf("%s: got error `%v', expected `%v'", c.name, err, c.err)
+    }
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+func TestWindowAggregate(test *testing.T) {
+  nan := math.NaN()
+  x   := []float64{1, 2, 3, 4, 5, 6, 7}
+  for _, c := range []struct {
+    name        string
+    size        int
+    step        int
+    padding     WindowPadding
+    aggregation WindowAggregation
+    results     []float64
+    expected    []float64
+  }{
+    { "center",              3, 1, WindowPadNone, WindowAggregateCenter, []float64{1, 5, 2, 0, 3},        []float64{nan, 1, 5, 2, 0, 3, nan} },
+    { "center (step 2)",     3, 2, WindowPadNone, WindowAggregateCenter, []float64{1, 2, 3},              []float64{1, 1, 2, 2, 3, 3, nan} },
+    { "center (padding)",    3, 1, WindowPadZero, WindowAggregateCenter, []float64{1, 2, 3, 4, 5, 6, 7},  []float64{1, 2, 3, 4, 5, 6, 7} },
+    { "max",                 3, 1, WindowPadNone, WindowAggregateMax,    []float64{1, 5, 2, 0, 3},        []float64{1, 5, 5, 5, 3, 3, 3} },
+    { "max (even size)",     4, 1, WindowPadNone, WindowAggregateMax,    []float64{4, 1, 3, 2},           []float64{4, 4, 4, 4, 3, 3, 2} },
+    { "max (step 3)",        3, 3, WindowPadNone, WindowAggregateMax,    []float64{2, 1},                 []float64{2, 2, 2, 1, 1, 1, nan} },
+    { "max (padding)",       3, 1, WindowPadZero, WindowAggregateMax,    []float64{7, 1, 1, 1, 1, 1, 7},  []float64{7, 7, 1, 1, 1, 7, 7} },
+    { "mean",                3, 1, WindowPadNone, WindowAggregateMean,   []float64{1, 5, 2, 0, 3},        []float64{1, 3, 8.0/3.0, 7.0/3.0, 5.0/3.0, 1.5, 3} },
+    { "mean (even size)",    4, 1, WindowPadNone, WindowAggregateMean,   []float64{4, 1, 3, 2},           []float64{4, 2.5, 8.0/3.0, 2.5, 2, 2.5, 2} },
+    { "mean (step 3)",       3, 3, WindowPadNone, WindowAggregateMean,   []float64{2, 1},                 []float64{2, 2, 2, 1, 1, 1, nan} },
+  } {
+    parameters := DefaultWindowParameters(c.size)
+    parameters.Step    = c.step
+    parameters.Padding = c.padding
+    it, err := NewSingleTrackWindowIterator(Float64Type, windowTestTrack(x), parameters)
+    if err != nil {
+      test.Fatalf("%s: %v", c.name, err)
+    }
+    if !it.NextSequence() {
+      test.Fatalf("%s: %v", c.name, it.Err())
+    }
+    s := it.Sequence()
+    if s.Len() != len(c.results) {
+      test.Errorf("%s: got `%d' windows, expected `%d'", c.name, s.Len(), len(c.results))
+      continue
+    }
+    dst := windowTestTrack(make([]float64, len(x)))
+    seq, _ := dst.GetSequence("chr1")
+    s.Aggregate(seq, c.results, c.aggregation)
+    r := make([]float64, seq.NBins())
+    for i := range r {
+      r[i] = seq.AtBin(i)
+    }
+    if !windowTestEqual(r, c.expected) {
+      test.Errorf("%s: got %v, expected %v", c.name, r, c.expected)
+    }
+  }
+}
@@ -0,0 +1,50 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+package utility
+
+/* -------------------------------------------------------------------------- */
+
+import "context"
+import "fmt"
+
+/* -------------------------------------------------------------------------- */
+
+// Error returned by context-aware functions if the context is canceled or
+// its deadline is exceeded. The error of the context is wrapped, i.e.
+//   errors.Is(err, context.Canceled)
+//   errors.Is(err, context.DeadlineExceeded)
+// can be used to distinguish both cases.
+type CanceledError struct {
+  Err error
+}
+
+func (err CanceledError) Error() string {
+  return fmt.Sprintf("operation canceled: %v", err.Err)
+}
+
+func (err CanceledError) Unwrap() error {
+  return err.Err
+}
+
+// Return a CanceledError if the context is done, and nil otherwise.
+func ContextError(ctx context.Context) error {
+  if err := ctx.Err(); err != nil {
+    return CanceledError{err}
+  }
+  return nil
+}
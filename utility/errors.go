@@ -0,0 +1,173 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utility
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "fmt"
+
+/* -------------------------------------------------------------------------- */
+
+// Sentinel errors for classes of failures. Errors returned by library
+// functions can be tested with errors.Is, i.e.
+//   errors.Is(err, ErrDimensionMismatch)
+// and the typed errors below provide details through errors.As.
+var (
+  ErrDimensionMismatch = errors.New("dimension mismatch")
+  ErrBinSizeMismatch   = errors.New("inconsistent bin size")
+  ErrUnknownSequence   = errors.New("unknown sequence")
+  ErrInvalidState      = errors.New("invalid state")
+  ErrInvalidFormat     = errors.New("invalid format")
+  ErrInvalidArgument   = errors.New("invalid argument")
+)
+
+/* -------------------------------------------------------------------------- */
+
+// Dimensions of data, transforms, estimators or classifiers do not match.
+// Expected and Got are zero if the dimensions are not known.
+type DimensionError struct {
+  Msg      string
+  Expected int
+  Got      int
+}
+
+func NewDimensionError(expected, got int, format string, args ...interface{}) error {
+  return DimensionError{fmt.Sprintf(format, args...), expected, got}
+}
+
+func (err DimensionError) Error() string {
+  return err.Msg
+}
+
+func (err DimensionError) Is(target error) bool {
+  return target == ErrDimensionMismatch
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Tracks have different bin sizes.
+type BinSizeError struct {
+  Msg      string
+  Expected int
+  Got      int
+}
+
+func NewBinSizeError(expected, got int, format string, args ...interface{}) error {
+  return BinSizeError{fmt.Sprintf(format, args...), expected, got}
+}
+
+func (err BinSizeError) Error() string {
+  return err.Msg
+}
+
+func (err BinSizeError) Is(target error) bool {
+  return target == ErrBinSizeMismatch
+}
+
+/* -------------------------------------------------------------------------- */
+
+// A sequence (chromosome) is missing in a track or genome. Err is the error
+// of the underlying track, if any.
+type SequenceError struct {
+  Seqname string
+  Err     error
+}
+
+func (err SequenceError) Error() string {
+  if err.Err != nil {
+    return fmt.Sprintf("sequence `%s': %v", err.Seqname, err.Err)
+  }
+  return fmt.Sprintf("sequence `%s' not found", err.Seqname)
+}
+
+func (err SequenceError) Is(target error) bool {
+  return target == ErrUnknownSequence
+}
+
+func (err SequenceError) Unwrap() error {
+  return err.Err
+}
+
+/* -------------------------------------------------------------------------- */
+
+// A segmentation contains a state that is not valid for the given model or
+// state map.
+type StateError struct {
+  Msg   string
+  State string
+}
+
+func NewStateError(state interface{}, format string, args ...interface{}) error {
+  return StateError{fmt.Sprintf(format, args...), fmt.Sprint(state)}
+}
+
+func (err StateError) Error() string {
+  return err.Msg
+}
+
+func (err StateError) Is(target error) bool {
+  return target == ErrInvalidState
+}
+
+/* -------------------------------------------------------------------------- */
+
+// A file could not be parsed. Line and Column are one-based and zero if the
+// position is unknown.
+type FormatError struct {
+  Filename string
+  Line     int
+  Column   int
+  Err      error
+}
+
+func (err FormatError) Error() string {
+  position := ""
+  switch {
+  case err.Line > 0 && err.Column > 0:
+    position = fmt.Sprintf("line %d, column %d", err.Line, err.Column)
+  case err.Line > 0:
+    position = fmt.Sprintf("line %d", err.Line)
+  }
+  switch {
+  case err.Filename != "" && err.Line > 0 && err.Column == 0:
+    return fmt.Sprintf("%s:%d: %v", err.Filename, err.Line, err.Err)
+  case err.Filename != "" && position != "":
+    return fmt.Sprintf("%s: %s: %v", err.Filename, position, err.Err)
+  case err.Filename != "":
+    return fmt.Sprintf("%s: %v", err.Filename, err.Err)
+  case position != "":
+    return fmt.Sprintf("%s: %v", position, err.Err)
+  default:
+    return err.Err.Error()
+  }
+}
+
+func (err FormatError) Is(target error) bool {
+  return target == ErrInvalidFormat
+}
+
+func (err FormatError) Unwrap() error {
+  return err.Err
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Return an error that wraps ErrInvalidArgument.
+func NewArgumentError(format string, args ...interface{}) error {
+  return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), ErrInvalidArgument)
+}
@@ -0,0 +1,227 @@
+/* Copyright (C) 2026 Philipp Benner
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utility
+
+/* -------------------------------------------------------------------------- */
+
+import "context"
+import "sync"
+
+import "github.com/pbenner/threadpool"
+
+/* -------------------------------------------------------------------------- */
+
+// Default size of the job queue of a threadpool with the given number of
+// threads. If the queue is full, jobs are executed by the submitting thread.
+func DefaultQueueSize(threads int) int {
+  if threads < 1 {
+    threads = 1
+  }
+  return 1000*threads
+}
+
+/* -------------------------------------------------------------------------- */
+
+// A MemoryBudget limits the number of bytes that are allocated concurrently
+// by jobs sharing an execution context. A nil budget is unlimited.
+type MemoryBudget struct {
+  Limit   int64
+  used    int64
+  mutex   sync.Mutex
+  waiting chan struct{}
+}
+
+func NewMemoryBudget(limit int64) *MemoryBudget {
+  if limit <= 0 {
+    return nil
+  }
+  return &MemoryBudget{Limit: limit}
+}
+
+// Reserve n bytes. Acquire blocks until enough memory is released by other
+// jobs or the context is canceled. Requests larger than the limit are granted
+// once no other memory is reserved, i.e. they are executed alone.
+func (obj *MemoryBudget) Acquire(ctx context.Context, n int64) error {
+  if obj == nil || n <= 0 {
+    return nil
+  }
+  if n > obj.Limit {
+    n = obj.Limit
+  }
+  for {
+    obj.mutex.Lock()
+    if obj.used+n <= obj.Limit {
+      obj.used += n
+      obj.mutex.Unlock()
+      return nil
+    }
+    if obj.waiting == nil {
+      obj.waiting = make(chan struct{})
+    }
+    waiting := obj.waiting
+    obj.mutex.Unlock()
+    select {
+    case <- waiting:
+    case <- ctx.Done():
+      return ContextError(ctx)
+    }
+  }
+}
+
+// Release n bytes previously reserved with Acquire.
+func (obj *MemoryBudget) Release(n int64) {
+  if obj == nil || n <= 0 {
+    return
+  }
+  if n > obj.Limit {
+    n = obj.Limit
+  }
+  obj.mutex.Lock()
+  defer obj.mutex.Unlock()
+  // ignore releases without matching acquire
+  if obj.used -= n; obj.used < 0 {
+    obj.used = 0
+  }
+  // wake up all waiting jobs
+  if obj.waiting != nil {
+    close(obj.waiting)
+    obj.waiting = nil
+  }
+}
+
+// Number of bytes currently reserved.
+func (obj *MemoryBudget) Used() int64 {
+  if obj == nil {
+    return 0
+  }
+  obj.mutex.Lock()
+  defer obj.mutex.Unlock()
+  return obj.used
+}
+
+/* -------------------------------------------------------------------------- */
+
+// A ScratchPool holds temporary objects (i.e. cloned classifiers and buffers)
+// that are reused by jobs. Contrary to arrays indexed by thread ids, a
+// ScratchPool is safe if several callers share the same threadpool.
+type ScratchPool struct {
+  free chan interface{}
+  new  func() interface{}
+}
+
+func NewScratchPool(n int, new func() interface{}) *ScratchPool {
+  if n < 1 {
+    n = 1
+  }
+  return &ScratchPool{free: make(chan interface{}, n), new: new}
+}
+
+// Get an object from the pool, a new object is allocated if the pool is
+// empty.
+func (obj *ScratchPool) Get() interface{} {
+  select {
+  case x := <- obj.free:
+    return x
+  default:
+    return obj.new()
+  }
+}
+
+// Return an object to the pool. Objects that exceed the capacity of the pool
+// are dropped.
+func (obj *ScratchPool) Put(x interface{}) {
+  select {
+  case obj.free <- x:
+  default:
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// An ExecutionContext holds the resources shared by estimation and
+// classification calls, i.e. the threadpool and a memory budget. Callers
+// create it once and pass it as optional argument to all functions, which
+// limits the number of threads and the amount of memory of all jobs in total.
+// Functions that receive no execution context create a private one.
+type ExecutionContext struct {
+  Pool      threadpool.ThreadPool
+  Threads   int
+  QueueSize int
+  Memory   *MemoryBudget
+  // private contexts are released by the function that created them
+  private   bool
+}
+
+// Create a new execution context with the given number of threads and queue
+// size. A queue size of zero selects the default. The memory budget is given
+// in bytes, zero means no limit.
+func NewExecutionContext(threads, queueSize int, memory int64) (*ExecutionContext, error) {
+  if threads < 1 {
+    return nil, NewArgumentError("invalid number of threads `%d'", threads)
+  }
+  if queueSize < 0 {
+    return nil, NewArgumentError("invalid queue size `%d'", queueSize)
+  }
+  if memory < 0 {
+    return nil, NewArgumentError("invalid memory budget `%d'", memory)
+  }
+  if queueSize == 0 {
+    queueSize = DefaultQueueSize(threads)
+  }
+  r := ExecutionContext{}
+  r.Pool      = threadpool.New(threads, queueSize)
+  r.Threads   = threads
+  r.QueueSize = queueSize
+  r.Memory    = NewMemoryBudget(memory)
+  return &r, nil
+}
+
+// Return the given execution context. If it is nil, a private context with
+// the given number of threads is created, which must be freed with Release.
+func GetExecutionContext(threads int, exec *ExecutionContext) *ExecutionContext {
+  if exec != nil {
+    return exec
+  }
+  if threads < 1 {
+    threads = 1
+  }
+  r := ExecutionContext{}
+  r.Pool      = threadpool.New(threads, DefaultQueueSize(threads))
+  r.Threads   = threads
+  r.QueueSize = DefaultQueueSize(threads)
+  r.private   = true
+  return &r
+}
+
+// Create a ScratchPool that retains at most one object per thread.
+func (obj *ExecutionContext) NewScratchPool(new func() interface{}) *ScratchPool {
+  return NewScratchPool(obj.Threads, new)
+}
+
+// Stop the threadpool of a private execution context. Release is a no-op for
+// contexts given by the caller, which must be closed by their owner. Functions
+// should therefore always defer Release after GetExecutionContext.
+func (obj *ExecutionContext) Release() {
+  if obj.private {
+    obj.Pool.Stop()
+  }
+}
+
+// Stop the threadpool. The context must not be used afterwards.
+func (obj *ExecutionContext) Close() {
+  obj.Pool.Stop()
+}
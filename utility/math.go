@@ -27,3 +27,23 @@ func DivIntDown(a, b int) int {
 func DivIntUp(a, b int) int {
   return (a+b-1)/b
 }
+
+// Minimum of a list of integers.
+func MinInt(a int, b ...int) int {
+  for _, x := range b {
+    if x < a {
+      a = x
+    }
+  }
+  return a
+}
+
+// Maximum of a list of integers.
+func MaxInt(a int, b ...int) int {
+  for _, x := range b {
+    if x > a {
+      a = x
+    }
+  }
+  return a
+}
@@ -21,61 +21,315 @@ package utility
 import "bytes"
 import "bufio"
 import "fmt"
+import "io"
 import "os"
+import "strings"
+import "sync"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// State of a (named) operation that consists of Total steps (i.e. bins), of
+// which Done steps are finished. Rate is given in steps per second, ETA is
+// negative if the remaining time is unknown.
+type ProgressEvent struct {
+  Name     string
+  Unit     string
+  Seqname  string
+  Done     int
+  Total    int
+  Elapsed  time.Duration
+  Rate     float64
+  ETA      time.Duration
+}
+
+func (event ProgressEvent) Fraction() float64 {
+  if event.Total <= 0 {
+    return 1.0
+  }
+  return float64(event.Done)/float64(event.Total)
+}
+
+func (event ProgressEvent) Finished() bool {
+  return event.Done >= event.Total
+}
+
+// Rate and ETA of the event, i.e. `1.25M bins/s, elapsed 00:00:12, eta 00:01:40'.
+func (event ProgressEvent) Timing() string {
+  unit := event.Unit
+  if unit != "" {
+    unit += "/s"
+  } else {
+    unit  = "/s"
+  }
+  eta := "--:--:--"
+  if event.ETA >= 0 {
+    eta = formatDuration(event.ETA)
+  }
+  return fmt.Sprintf("%s %s, elapsed %s, eta %s", formatRate(event.Rate), unit, formatDuration(event.Elapsed), eta)
+}
+
+func (event ProgressEvent) String() string {
+  var buffer bytes.Buffer
+  if event.Name != "" {
+    fmt.Fprintf(&buffer, "%s: ", event.Name)
+  }
+  fmt.Fprintf(&buffer, "%6.2f%% (%d/%d", event.Fraction()*100, event.Done, event.Total)
+  if event.Unit != "" {
+    fmt.Fprintf(&buffer, " %s", event.Unit)
+  }
+  fmt.Fprintf(&buffer, ", %s)", event.Timing())
+  return buffer.String()
+}
+
+func formatDuration(d time.Duration) string {
+  s := int64(d.Seconds())
+  return fmt.Sprintf("%02d:%02d:%02d", s/3600, (s/60)%60, s%60)
+}
+
+func formatRate(r float64) string {
+  switch {
+  case r >= 1e9:
+    return fmt.Sprintf("%.2fG", r/1e9)
+  case r >= 1e6:
+    return fmt.Sprintf("%.2fM", r/1e6)
+  case r >= 1e3:
+    return fmt.Sprintf("%.2fk", r/1e3)
+  default:
+    return fmt.Sprintf("%.2f", r)
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Callbacks receive progress events from long running operations, i.e.
+// BatchClassify* and BatchEstimate*, which allows to drive a custom user
+// interface.
+type ProgressCallback interface {
+  ProgressUpdate(event ProgressEvent)
+}
+
+// Use a function as progress callback.
+type ProgressFunc func(event ProgressEvent)
+
+func (f ProgressFunc) ProgressUpdate(event ProgressEvent) {
+  f(event)
+}
 
 /* -------------------------------------------------------------------------- */
 
 type Progress struct {
   N, K, LineWidth int
+  // name of the operation and unit of steps
+  Name  string
+  Unit  string
+  // start time used for computing rate and ETA
+  Start time.Time
 }
 
 /* -------------------------------------------------------------------------- */
 
 func NewProgress(n, k int) Progress {
-  progress := Progress{n, n/k, 40}
-  if k > n {
-    progress.K = 1
+  progress := Progress{N: n, K: 1, LineWidth: 40, Unit: "bins", Start: time.Now()}
+  if k > 0 && k <= n {
+    progress.K = n/k
   }
   return progress
 }
 
+func NewNamedProgress(name string, n, k int) Progress {
+  progress := NewProgress(n, k)
+  progress.Name = name
+  return progress
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Return the state of the operation after i steps.
+func (progress Progress) Event(i int) ProgressEvent {
+  event := ProgressEvent{
+    Name   : progress.Name,
+    Unit   : progress.Unit,
+    Done   : i,
+    Total  : progress.N,
+    Elapsed: time.Since(progress.Start),
+    ETA    : -1 }
+  if s := event.Elapsed.Seconds(); s > 0 {
+    event.Rate = float64(i)/s
+  }
+  if event.Rate > 0 {
+    event.ETA = time.Duration(float64(progress.N-i)/event.Rate*float64(time.Second))
+  }
+  return event
+}
+
+// Send the state of the operation after i steps to a callback, seqname is
+// the sequence that was processed last.
+func (progress Progress) Report(callback ProgressCallback, i int, seqname string) {
+  if callback == nil {
+    return
+  }
+  event := progress.Event(i)
+  event.Seqname = seqname
+  callback.ProgressUpdate(event)
+}
+
 /* -------------------------------------------------------------------------- */
 
 const __line_del__ = "\033[2K\r"
 
-func (progress Progress) Exec(i int) string {
+func formatProgressBar(event ProgressEvent, lineWidth int) string {
   var buffer bytes.Buffer
   writer := bufio.NewWriter(&buffer)
 
-  p := float64(i)/float64(progress.N)
-  // carriage return
-  fmt.Fprintf(writer, "%s|", __line_del__)
+  p := event.Fraction()
+  fmt.Fprintf(writer, "|")
 
-  for i := 1; i < progress.LineWidth-1; i++ {
-    if float64(i)/float64(progress.LineWidth) < p {
+  for i := 1; i < lineWidth-1; i++ {
+    if float64(i)/float64(lineWidth) < p {
       fmt.Fprintf(writer, ">")
     } else {
       fmt.Fprintf(writer, " ")
     }
   }
-  fmt.Fprintf(writer, "| %6.2f%%", p*100)
-  // add newline if finished
-  if p == 1.0 {
-    fmt.Fprintf(writer, "\n")
-  }
+  fmt.Fprintf(writer, "| %6.2f%% %s", p*100, event.Timing())
   writer.Flush()
 
   return buffer.String()
 }
 
-func (progress Progress) PrintStdout(i int) {
-  if i == 0 || i == progress.N || (i % progress.K == 0) {
-    fmt.Fprint(os.Stdout, progress.Exec(i))
+func (progress Progress) Exec(i int) string {
+  event := progress.Event(i)
+  // carriage return
+  s := __line_del__ + formatProgressBar(event, progress.LineWidth)
+  // add newline if finished
+  if event.Finished() {
+    s += "\n"
+  }
+  return s
+}
+
+// Plain text progress without escape sequences, i.e. for log files.
+func (progress Progress) ExecPlain(i int) string {
+  return progress.Event(i).String() + "\n"
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Minimal time between two plain text progress messages.
+var ProgressInterval = 10*time.Second
+
+var progressMutex sync.Mutex
+var progressLast  time.Time
+
+// Check if the writer is a terminal.
+func IsTerminal(w io.Writer) bool {
+  if f, ok := w.(*os.File); ok {
+    if info, err := f.Stat(); err == nil {
+      return info.Mode() & os.ModeCharDevice != 0
+    }
   }
+  return false
+}
+
+// Print progress to w. If w is a terminal a progress bar is printed, otherwise
+// plain text messages at most every ProgressInterval.
+func (progress Progress) Print(w io.Writer, i int) {
+  if !(i == 0 || i == progress.N || (i % progress.K == 0)) {
+    return
+  }
+  if IsTerminal(w) {
+    fmt.Fprint(w, progress.Exec(i))
+    return
+  }
+  progressMutex.Lock()
+  defer progressMutex.Unlock()
+  if i == 0 || i == progress.N || time.Since(progressLast) >= ProgressInterval {
+    fmt.Fprint(w, progress.ExecPlain(i))
+    progressLast = time.Now()
+  }
+}
+
+func (progress Progress) PrintStdout(i int) {
+  progress.Print(os.Stdout, i)
 }
 
 func (progress Progress) PrintStderr(i int) {
-  if i == 0 || i == progress.N || (i % progress.K == 0) {
-    fmt.Fprint(os.Stderr, progress.Exec(i))
+  progress.Print(os.Stderr, i)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// MultiProgress shows one progress bar for each named operation, which
+// allows to follow concurrent stages. On terminals all bars are redrawn on
+// each update, otherwise plain text messages are printed at most every
+// ProgressInterval for each operation. Bars are removed once all operations
+// are finished. MultiProgress is safe for concurrent use.
+type MultiProgress struct {
+  Writer    io.Writer
+  LineWidth int
+  mutex     sync.Mutex
+  names     []string
+  events    map[string]ProgressEvent
+  last      map[string]time.Time
+  lines     int
+}
+
+func NewMultiProgress(writer io.Writer) *MultiProgress {
+  return &MultiProgress{
+    Writer   : writer,
+    LineWidth: 40,
+    events   : make(map[string]ProgressEvent),
+    last     : make(map[string]time.Time) }
+}
+
+func (mp *MultiProgress) ProgressUpdate(event ProgressEvent) {
+  mp.mutex.Lock()
+  defer mp.mutex.Unlock()
+  if _, ok := mp.events[event.Name]; !ok {
+    mp.names = append(mp.names, event.Name)
+  }
+  mp.events[event.Name] = event
+  if IsTerminal(mp.Writer) {
+    mp.draw()
+  } else {
+    if event.Done == 0 || event.Finished() || time.Since(mp.last[event.Name]) >= ProgressInterval {
+      fmt.Fprintln(mp.Writer, event.String())
+      mp.last[event.Name] = time.Now()
+    }
+  }
+  // reset if all operations are finished
+  for _, name := range mp.names {
+    if !mp.events[name].Finished() {
+      return
+    }
+  }
+  mp.names  = nil
+  mp.events = make(map[string]ProgressEvent)
+  mp.last   = make(map[string]time.Time)
+  mp.lines  = 0
+}
+
+func (mp *MultiProgress) draw() {
+  var buffer bytes.Buffer
+  width := 0
+  for _, name := range mp.names {
+    if len(name) > width {
+      width = len(name)
+    }
+  }
+  // move cursor to the first bar
+  if mp.lines > 0 {
+    fmt.Fprintf(&buffer, "\033[%dA", mp.lines)
+  }
+  for _, name := range mp.names {
+    buffer.WriteString(__line_del__)
+    if width > 0 {
+      fmt.Fprintf(&buffer, "%s%s ", name, strings.Repeat(" ", width-len(name)))
+    }
+    buffer.WriteString(formatProgressBar(mp.events[name], mp.LineWidth))
+    buffer.WriteString("\n")
   }
+  mp.lines = len(mp.names)
+  mp.Writer.Write(buffer.Bytes())
 }
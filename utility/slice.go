@@ -165,6 +165,17 @@ func SequencesToMatrix(t ScalarType, sequences []TrackSequence, transposed bool)
   }
 }
 
+// Returns a view of the bins [from, to) of a matrix created by
+// SequencesToMatrix.
+func SliceSequencesMatrix(x Matrix, from, to int, transposed bool) Matrix {
+  n, m := x.Dims()
+  if transposed {
+    return x.Slice(from, to, 0, m)
+  } else {
+    return x.Slice(0, n, from, to)
+  }
+}
+
 /* -------------------------------------------------------------------------- */
 
 func SlicesToMatrix(t ScalarType, counts [][]float64, transposed bool) Matrix {